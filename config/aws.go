@@ -0,0 +1,85 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"net"
+	"net/http"
+	"time"
+)
+
+// NewSession builds the aws session of the config: profile, region, endpoints, http timeouts, retries and web
+// identity credentials. The ones left empty keep the defaults of the sdk
+func (cfg AWSConfig) NewSession() (*session.Session, error) {
+	awsConfig := aws.Config{}
+	if cfg.Region != "" {
+		awsConfig.Region = aws.String(cfg.Region)
+	}
+	if cfg.MaxRetries != nil {
+		awsConfig.MaxRetries = aws.Int(*cfg.MaxRetries)
+	}
+	if cfg.S3ForcePathStyle {
+		awsConfig.S3ForcePathStyle = aws.Bool(true)
+	}
+	if cfg.HTTPTimeout > 0 || cfg.HTTPConnectTimeout > 0 {
+		awsConfig.HTTPClient = cfg.httpClient()
+	}
+	if serviceEndpoints := cfg.Endpoints.byService(); len(serviceEndpoints) > 0 {
+		awsConfig.EndpointResolver = endpointResolver(serviceEndpoints)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            awsConfig,
+		Profile:           cfg.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to create the aws session, error: %s", err.Error()))
+	}
+
+	if cfg.WebIdentityTokenFile != "" {
+		sess.Config.Credentials = stscreds.NewWebIdentityCredentials(sess, cfg.WebIdentityRoleArn, cfg.RoleSessionName, cfg.WebIdentityTokenFile)
+	}
+	return sess, nil
+}
+
+func (cfg AWSConfig) httpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.HTTPConnectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: cfg.HTTPConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = cfg.HTTPConnectTimeout
+	}
+	return &http.Client{Transport: transport, Timeout: cfg.HTTPTimeout}
+}
+
+// byService maps the endpoints that are set by the id of their service in the sdk
+func (cfg EndpointsConfig) byService() map[string]string {
+	serviceEndpoints := map[string]string{}
+	for service, endpoint := range map[string]string{
+		endpoints.S3ServiceID:             cfg.S3,
+		endpoints.SqsServiceID:            cfg.SQS,
+		endpoints.StatesServiceID:         cfg.SFN,
+		endpoints.StsServiceID:            cfg.STS,
+		endpoints.SecretsmanagerServiceID: cfg.SecretsManager,
+		endpoints.SsmServiceID:            cfg.SSM,
+	} {
+		if endpoint != "" {
+			serviceEndpoints[service] = endpoint
+		}
+	}
+	return serviceEndpoints
+}
+
+// endpointResolver sends the services with an endpoint to it and the other ones to aws
+func endpointResolver(serviceEndpoints map[string]string) endpoints.ResolverFunc {
+	return func(service, region string, options ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		if endpoint, ok := serviceEndpoints[service]; ok {
+			return endpoints.ResolvedEndpoint{URL: endpoint, SigningRegion: region}, nil
+		}
+		return endpoints.DefaultResolver().EndpointFor(service, region, options...)
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewSession(t *testing.T) {
+	fmt.Println("name: Success when the session honors the region, endpoints, timeouts and retries")
+
+	retries := 7
+	cfg := AWSConfig{
+		Region:           "eu-west-1",
+		Endpoints:        EndpointsConfig{S3: "http://localhost:9000", SQS: "http://localhost:4566"},
+		S3ForcePathStyle: true,
+		HTTPTimeout:      30 * time.Second,
+		MaxRetries:       &retries,
+	}
+
+	sess, err := cfg.NewSession() //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, "eu-west-1", *sess.Config.Region)
+	assert.Equal(t, 7, *sess.Config.MaxRetries)
+	assert.True(t, *sess.Config.S3ForcePathStyle)
+	assert.Equal(t, 30*time.Second, sess.Config.HTTPClient.Timeout)
+
+	s3Endpoint, err := sess.Config.EndpointResolver.EndpointFor(endpoints.S3ServiceID, "eu-west-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:9000", s3Endpoint.URL)
+	assert.Equal(t, "eu-west-1", s3Endpoint.SigningRegion)
+
+	sfnEndpoint, err := sess.Config.EndpointResolver.EndpointFor(endpoints.StatesServiceID, "eu-west-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://states.eu-west-1.amazonaws.com", sfnEndpoint.URL)
+}
+
+func TestNewSessionWithWebIdentity(t *testing.T) {
+	fmt.Println("name: Success when the credentials are assumed with the web identity token file")
+
+	cfg := AWSConfig{
+		Region:               "eu-west-1",
+		WebIdentityTokenFile: t.TempDir() + "/missing-token",
+		WebIdentityRoleArn:   "arn:aws:iam::123456789012:role/etl",
+	}
+
+	sess, err := cfg.NewSession() //<--- function under test
+
+	assert.Nil(t, err)
+	_, err = sess.Config.Credentials.Get()
+	assert.Contains(t, err.Error(), "unable to read file")
+}
+
+func TestNewSessionFailure(t *testing.T) {
+	fmt.Println("name: Fail instead of exiting when the profile cannot be used")
+	t.Setenv("AWS_CONFIG_FILE", writeConfigFile(t, "config", "[profile broken]\nrole_arn = arn:aws:iam::123456789012:role/etl\nsource_profile = missing\n"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", t.TempDir()+"/credentials")
+
+	_, err := AWSConfig{Profile: "broken", Region: "eu-west-1"}.NewSession() //<--- function under test
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "failed to create the aws session")
+	}
+}
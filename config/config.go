@@ -1,44 +1,171 @@
 package config
 
 import (
-	"github.com/anhamdan/etl-base/helpers"
+	"github.com/anhamdan/etl-base/config/settings"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Config struct {
-	LandingZoneConfig     helpers.LandingZoneConfig
-	LoadingZoneConfig     helpers.LoadingZoneConfig
-	WorkflowManagerConfig helpers.WorkflowManagerConfig
-	AWSConfig             AWSConfig
+	LandingZoneConfig     settings.LandingZoneConfig     `yaml:"landingZone"`
+	LoadingZoneConfig     settings.LoadingZoneConfig     `yaml:"loadingZone"`
+	WorkflowManagerConfig settings.WorkflowManagerConfig `yaml:"workflowManager"`
+	AWSConfig             AWSConfig                      `yaml:"aws"`
+	StateStoreConfig      StateStoreConfig               `yaml:"stateStore"`
+	LoggingConfig         LoggingConfig                  `yaml:"logging"`
+	MetricsConfig         MetricsConfig                  `yaml:"metrics"`
+	TracingConfig         TracingConfig                  `yaml:"tracing"`
+	HealthConfig          HealthConfig                   `yaml:"health"`
+	RetryConfig           RetryConfig                    `yaml:"retry"`
+	MappingConfig         MappingConfig                  `yaml:"mapping"`
 }
 
 type AWSConfig struct {
-	Profile string
-	Region  string
-}
-
-func Initialize(Type string) Config {
-	if Type == "analyst" {
-		return Config{
-			LandingZoneConfig: helpers.LandingZoneConfig{
-				S3Bucket: GetAsString("S3_BUCKET_LANDING_ZONE", "landing-zone-poc"),
-			},
-			LoadingZoneConfig: helpers.LoadingZoneConfig{
-				S3Bucket:        GetAsString("S3_BUCKET_LOADING_ZONE", "enlight-loading-zone-poc"),
-				LZHelperEnabled: GetAsBool("LOADING_ZONE_HELPER_ENABLED", true),
-			},
-			WorkflowManagerConfig: helpers.WorkflowManagerConfig{
-				// todo this needs to be changed when we get notified of the real sqs queue
-				SQSURL: GetAsString("SQS_URL", ""),
-				// todo this needs to be changed when we send event to the real topic
-				TopicARN:               GetAsString("MANAGER_TOPIC_ARN", ""),
-				GroupID:                GetAsString("MANAGER_GROUP_ID", "123"),
-				WorkFlowManagerEnabled: GetAsBool("MANAGER_ENABLED", true),
-			},
-			AWSConfig: AWSConfig{
-				Profile: GetAsString("AWS_PROFILE", "default"),
-				Region:  GetAsString("AWS_REGION", "eu-west-1"),
-			},
+	Profile string `yaml:"profile" env:"AWS_PROFILE"`
+	Region  string `yaml:"region" env:"AWS_REGION"`
+	// S3Backend selects "aws" for real buckets or "fs" to map every bucket to a directory under S3LocalRoot
+	S3Backend   string `yaml:"s3Backend" env:"S3_BACKEND"`
+	S3LocalRoot string `yaml:"s3LocalRoot" env:"S3_LOCAL_ROOT"`
+	// Endpoints replace the aws endpoint of a service, like a LocalStack or MinIO url
+	Endpoints EndpointsConfig `yaml:"endpoints" prefix:"AWS_ENDPOINT_"`
+	// S3ForcePathStyle addresses buckets as endpoint/bucket, which MinIO and LocalStack need
+	S3ForcePathStyle bool `yaml:"s3ForcePathStyle" env:"AWS_S3_FORCE_PATH_STYLE"`
+	// HTTPTimeout bounds a whole request, it must be longer than the sqs long polling
+	HTTPTimeout        time.Duration `yaml:"httpTimeout" env:"AWS_HTTP_TIMEOUT"`
+	HTTPConnectTimeout time.Duration `yaml:"httpConnectTimeout" env:"AWS_HTTP_CONNECT_TIMEOUT"`
+	// MaxRetries keeps the default of the sdk when it is not set. The s3, sqs and step functions clients are not
+	// retried by the sdk but by the policies of RetryConfig
+	MaxRetries *int `yaml:"maxRetries" env:"AWS_MAX_RETRIES"`
+	// WebIdentityTokenFile and WebIdentityRoleArn assume the role with the token of the pod, like IRSA on EKS
+	WebIdentityTokenFile string `yaml:"webIdentityTokenFile" env:"AWS_WEB_IDENTITY_TOKEN_FILE"`
+	WebIdentityRoleArn   string `yaml:"webIdentityRoleArn" env:"AWS_ROLE_ARN"`
+	RoleSessionName      string `yaml:"roleSessionName" env:"AWS_ROLE_SESSION_NAME"`
+	// S3Get and S3Put limit the gets and the puts to every prefix of a bucket
+	S3Get S3LimitConfig `yaml:"s3Get" prefix:"S3_GET_"`
+	S3Put S3LimitConfig `yaml:"s3Put" prefix:"S3_PUT_"`
+}
+
+type EndpointsConfig struct {
+	S3             string `yaml:"s3" env:"S3"`
+	SQS            string `yaml:"sqs" env:"SQS"`
+	SFN            string `yaml:"sfn" env:"SFN"`
+	STS            string `yaml:"sts" env:"STS"`
+	SecretsManager string `yaml:"secretsManager" env:"SECRETS_MANAGER"`
+	SSM            string `yaml:"ssm" env:"SSM"`
+}
+
+// S3LimitConfig fields left to zero take the request rate of s3 for a prefix, a burst of one second of requests and no
+// concurrency cap
+type S3LimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requestsPerSecond" env:"REQUESTS_PER_SECOND"`
+	Burst             int     `yaml:"burst" env:"BURST"`
+	MaxConcurrency    int     `yaml:"maxConcurrency" env:"MAX_CONCURRENCY"`
+}
+
+// StateStoreConfig selects where the runtime keeps the state of the processed import jobs
+type StateStoreConfig struct {
+	Backend  string `yaml:"backend" env:"STATE_STORE_BACKEND"`
+	S3Bucket string `yaml:"s3Bucket" env:"STATE_STORE_S3_BUCKET"`
+	Prefix   string `yaml:"prefix" env:"STATE_STORE_PREFIX"`
+}
+
+type LoggingConfig struct {
+	// Level is debug, info, warn or error, info when it is empty
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+}
+
+// MetricsConfig selects where the metrics of the helpers are exported: "prometheus" serves them on Address at
+// /metrics, "emf" writes CloudWatch Embedded Metric Format lines to stdout every FlushInterval, "none" or empty drops them
+type MetricsConfig struct {
+	Exporter      string        `yaml:"exporter" env:"METRICS_EXPORTER"`
+	Address       string        `yaml:"address" env:"METRICS_ADDRESS"`
+	Namespace     string        `yaml:"namespace" env:"METRICS_NAMESPACE"`
+	FlushInterval time.Duration `yaml:"flushInterval" env:"METRICS_FLUSH_INTERVAL"`
+}
+
+// TracingConfig selects where the spans are exported: "otlp" posts them to the collector on Endpoint, host:port, while
+// "none" or empty drops them
+type TracingConfig struct {
+	Exporter    string `yaml:"exporter" env:"TRACING_EXPORTER"`
+	Endpoint    string `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	Insecure    bool   `yaml:"insecure" env:"OTEL_EXPORTER_OTLP_INSECURE"`
+	ServiceName string `yaml:"serviceName" env:"OTEL_SERVICE_NAME"`
+}
+
+// HealthConfig serves /healthz, /readyz and /status on Address when it is enabled. The worker is not ready when its
+// last successful poll of the queue is older than PollMaxAge
+type HealthConfig struct {
+	Enabled    bool          `yaml:"enabled" env:"HEALTH_ENABLED"`
+	Address    string        `yaml:"address" env:"HEALTH_ADDRESS"`
+	PollMaxAge time.Duration `yaml:"pollMaxAge" env:"HEALTH_POLL_MAX_AGE"`
+}
+
+// RetryConfig is the backoff of the aws calls after a retryable error, on top of the retries of the sdk. Operations
+// override the default policy for an operation of the aws api, like GetObject or SendTaskSuccess
+type RetryConfig struct {
+	Default    RetryPolicy            `yaml:"default" prefix:"RETRY_"`
+	Operations map[string]RetryPolicy `yaml:"operations"`
+}
+
+// RetryPolicy fields left to zero take the ones of retry.DefaultPolicy
+type RetryPolicy struct {
+	InitialInterval time.Duration `yaml:"initialInterval" env:"INITIAL_INTERVAL"`
+	MaxInterval     time.Duration `yaml:"maxInterval" env:"MAX_INTERVAL"`
+	Multiplier      float64       `yaml:"multiplier" env:"MULTIPLIER"`
+	Jitter          float64       `yaml:"jitter" env:"JITTER"`
+	MaxElapsedTime  time.Duration `yaml:"maxElapsedTime" env:"MAX_ELAPSED_TIME"`
+	MaxAttempts     int           `yaml:"maxAttempts" env:"MAX_ATTEMPTS"`
+}
+
+// MappingConfig maps the records of a type without a registered ETL with the spec of SpecPath, a yaml or json file, so
+// the type needs no Go code
+type MappingConfig struct {
+	SpecPath string `yaml:"specPath" env:"MAPPING_SPEC_PATH"`
+}
+
+var (
+	// defaultConfigs are the registered configs of the ETL types, the lowest config source
+	defaultConfigs = map[string]Config{}
+	defaultsMutex  sync.RWMutex
+)
+
+// RegisterDefaults sets the built-in config of an ETL type, the type name is case insensitive. ETL types
+// registered with helpers.RegisterEtl do not need to call it
+func RegisterDefaults(Type string, cfg Config) {
+	defaultsMutex.Lock()
+	defer defaultsMutex.Unlock()
+
+	defaultConfigs[strings.ToLower(Type)] = cfg
+}
+
+func defaults(Type string) (Config, bool) {
+	defaultsMutex.RLock()
+	defer defaultsMutex.RUnlock()
+
+	cfg, ok := defaultConfigs[strings.ToLower(Type)]
+	return cfg, ok
+}
+
+// Initialize builds the config of the ETL type from its registered defaults, the file in CONFIG_FILE, the
+// environment variables and the command line flags of args, like os.Args[1:], then validates it. With SECRETS_FILE
+// set, the secret references are read from that file instead of aws
+func Initialize(Type string, args []string) (Config, error) {
+	if secretsFile := GetAsString("SECRETS_FILE", ""); secretsFile != "" {
+		resolver, err := NewFileResolver(secretsFile)
+		if err != nil {
+			return Config{}, err
 		}
+		RegisterResolver(SecretsManagerScheme, resolver)
+		RegisterResolver(SSMScheme, resolver)
+	}
+
+	cfg, err := Build(Options{Type: Type, File: GetAsString("CONFIG_FILE", ""), Args: args})
+	if err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
 	}
-	return Config{}
+	return cfg, nil
 }
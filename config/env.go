@@ -1,18 +1,18 @@
 package config
 
 import (
-	"log"
+	"fmt"
 	"os"
 	"strconv"
 )
 
-// MustGetAsString returns value for given environment variable
-func MustGetAsString(variableName string) string {
+// MustGetAsString returns value for given environment variable, the error is a FieldError when it is not set
+func MustGetAsString(variableName string) (string, error) {
 	value := os.Getenv(variableName)
 	if value == "" {
-		log.Panicf("System variable %s not set", variableName)
+		return "", FieldError{Field: variableName, Message: "is required"}
 	}
-	return value
+	return value, nil
 }
 
 // GetAsString returns value for given environment variable, with default if not found
@@ -34,41 +34,49 @@ func EnsureValue(variableName string, defaultValue string) string {
 	return value
 }
 
-// GetAsFloat returns value for given environment variable, with default if not found
-func GetAsFloat(variableName string, defaultValue float64) (floatValue float64) {
+// GetAsFloat returns value for given environment variable, with default if not found. The error is a FieldError
+// when the value is not a float
+func GetAsFloat(variableName string, defaultValue float64) (float64, error) {
 	stringValue := os.Getenv(variableName)
 	if stringValue == "" {
-		return defaultValue
+		return defaultValue, nil
 	}
-	var err error
-	if floatValue, err = strconv.ParseFloat(stringValue, 64); err != nil {
-		log.Panicf("Failed to parse string %s to float - %+v\n", stringValue, err)
+	floatValue, err := strconv.ParseFloat(stringValue, 64)
+	if err != nil {
+		return defaultValue, invalidValue(variableName, stringValue, err)
 	}
-	return
+	return floatValue, nil
 }
 
-// GetAsInt returns value for given environment variable, with default if not found
-func GetAsInt(variableName string, defaultValue int) (intValue int) {
+// GetAsInt returns value for given environment variable, with default if not found. The error is a FieldError when
+// the value is not an int
+func GetAsInt(variableName string, defaultValue int) (int, error) {
 	stringValue := os.Getenv(variableName)
 	if stringValue == "" {
-		return defaultValue
+		return defaultValue, nil
 	}
-	var err error
-	if intValue, err = strconv.Atoi(stringValue); err != nil {
-		log.Panicf("Failed to parse string %s to int - %+v\n", stringValue, err)
+	intValue, err := strconv.Atoi(stringValue)
+	if err != nil {
+		return defaultValue, invalidValue(variableName, stringValue, err)
 	}
-	return
+	return intValue, nil
 }
 
-// GetAsBool returns value for given environment variable, with default if not found
-func GetAsBool(variableName string, defaultValue bool) (boolValue bool) {
+// GetAsBool returns value for given environment variable, with default if not found. The error is a FieldError when
+// the value is not a bool
+func GetAsBool(variableName string, defaultValue bool) (bool, error) {
 	stringValue := os.Getenv(variableName)
 	if stringValue == "" {
-		return defaultValue
+		return defaultValue, nil
 	}
-	var err error
-	if boolValue, err = strconv.ParseBool(stringValue); err != nil {
-		log.Panicf("Failed to parse string %s to bool - %+v\n", stringValue, err)
+	boolValue, err := strconv.ParseBool(stringValue)
+	if err != nil {
+		return defaultValue, invalidValue(variableName, stringValue, err)
 	}
-	return
+	return boolValue, nil
+}
+
+// invalidValue reports a variable that could not be parsed like Load does, so it can be added to a ValidationError
+func invalidValue(variableName, stringValue string, err error) FieldError {
+	return FieldError{Field: variableName, Message: fmt.Sprintf("invalid value %q, error: %s", stringValue, err.Error())}
 }
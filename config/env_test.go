@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetters(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		get           func() (interface{}, error)
+		expectedValue interface{}
+		expectedError error
+	}{
+		{
+			name:          "Success when the int variable is not set",
+			get:           func() (interface{}, error) { return GetAsInt("ENV_TEST_VALUE", 3) },
+			expectedValue: 3,
+		},
+		{
+			name:          "Success when parsing the float variable",
+			value:         "0.5",
+			get:           func() (interface{}, error) { return GetAsFloat("ENV_TEST_VALUE", 1) },
+			expectedValue: 0.5,
+		},
+		{
+			name:          "Fail when the int variable is not an int",
+			value:         "many",
+			get:           func() (interface{}, error) { return GetAsInt("ENV_TEST_VALUE", 3) },
+			expectedValue: 3,
+			expectedError: FieldError{Field: "ENV_TEST_VALUE", Message: `invalid value "many", error: strconv.Atoi: parsing "many": invalid syntax`},
+		},
+		{
+			name:          "Fail when the bool variable is not a bool",
+			value:         "yes please",
+			get:           func() (interface{}, error) { return GetAsBool("ENV_TEST_VALUE", true) },
+			expectedValue: true,
+			expectedError: FieldError{Field: "ENV_TEST_VALUE", Message: `invalid value "yes please", error: strconv.ParseBool: parsing "yes please": invalid syntax`},
+		},
+		{
+			name:          "Fail when the required variable is not set",
+			get:           func() (interface{}, error) { return MustGetAsString("ENV_TEST_VALUE") },
+			expectedValue: "",
+			expectedError: FieldError{Field: "ENV_TEST_VALUE", Message: "is required"},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		t.Setenv("ENV_TEST_VALUE", test.value)
+
+		value, err := test.get() //<--- function under test
+
+		assert.Equal(t, test.expectedValue, value)
+		assert.Equal(t, test.expectedError, err)
+	}
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load populates the struct pointed by target from the environment, following the tags of its fields:
+//
+//	env:"NAME"       the environment variable of the field, an empty variable counts as not set
+//	default:"value"  the value used when the variable is not set
+//	required:"true"  the variable must be set when the field has no default
+//	prefix:"NAME_"   on a nested struct, prepended to the variables of its fields
+//
+// Fields can be strings, bools, numbers, time.Duration, pointers to them, slices as comma separated values and maps
+// as comma separated key=value pairs. Nested structs and pointers to structs are loaded recursively, a nil pointer
+// is only allocated when one of the variables of its struct is set. Every problem
+// is reported at once in a *ValidationError, fields without a variable or a default keep their value. The secret://
+// and ssm:// references are left as they are, ResolveSecrets resolves them with the aws config of the ETL
+func Load(target interface{}) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return errors.New(fmt.Sprintf("config: Load needs a pointer to a struct, got %T", target))
+	}
+
+	validation := &ValidationError{}
+	loadStruct(value.Elem(), "", validation)
+	return validation.orNil()
+}
+
+func loadStruct(value reflect.Value, prefix string, validation *ValidationError) {
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		field := value.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		name, hasEnv := structField.Tag.Lookup("env")
+		if !hasEnv && isNestedStruct(field.Type()) {
+			nestedPrefix := prefix + structField.Tag.Get("prefix")
+			if field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					// A nil section stays nil until one of its variables is set, so its required fields are only
+					// required when it is used
+					if !hasVariables(field.Type().Elem(), nestedPrefix) {
+						continue
+					}
+					field.Set(reflect.New(field.Type().Elem()))
+				}
+				field = field.Elem()
+			}
+			loadStruct(field, nestedPrefix, validation)
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		name = prefix + name
+
+		raw := os.Getenv(name)
+		if raw == "" {
+			var hasDefault bool
+			if raw, hasDefault = structField.Tag.Lookup("default"); !hasDefault {
+				if structField.Tag.Get("required") == "true" {
+					validation.add(name, "is required")
+				}
+				continue
+			}
+		}
+
+		if err := setValue(field, raw); err != nil {
+			validation.add(name, "invalid value %q, error: %s", raw, err.Error())
+		}
+	}
+}
+
+// hasVariables reports whether a variable of the fields of the struct type, or of its nested structs, is set
+func hasVariables(structType reflect.Type, prefix string) bool {
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+		name, hasEnv := structField.Tag.Lookup("env")
+		if !hasEnv && isNestedStruct(structField.Type) {
+			nestedType := structField.Type
+			if nestedType.Kind() == reflect.Ptr {
+				nestedType = nestedType.Elem()
+			}
+			if hasVariables(nestedType, prefix+structField.Tag.Get("prefix")) {
+				return true
+			}
+			continue
+		}
+		if name != "" && os.Getenv(prefix+name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isNestedStruct(fieldType reflect.Type) bool {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	return fieldType.Kind() == reflect.Struct && fieldType != reflect.TypeOf(time.Time{})
+}
+
+func setValue(value reflect.Value, raw string) error {
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Ptr:
+		elem := reflect.New(value.Type().Elem())
+		if err := setValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		value.Set(elem)
+	case reflect.Slice:
+		items := splitList(raw)
+		slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), item); err != nil {
+				return errors.New(fmt.Sprintf("item %d: %s", i, err.Error()))
+			}
+		}
+		value.Set(slice)
+	case reflect.Map:
+		entries := reflect.MakeMap(value.Type())
+		for _, item := range splitList(raw) {
+			pair := strings.SplitN(item, "=", 2)
+			if len(pair) != 2 {
+				return errors.New(fmt.Sprintf("%q is not a key=value pair", item))
+			}
+			key := reflect.New(value.Type().Key()).Elem()
+			if err := setValue(key, strings.TrimSpace(pair[0])); err != nil {
+				return errors.New(fmt.Sprintf("key %q: %s", pair[0], err.Error()))
+			}
+			entry := reflect.New(value.Type().Elem()).Elem()
+			if err := setValue(entry, strings.TrimSpace(pair[1])); err != nil {
+				return errors.New(fmt.Sprintf("value of %q: %s", pair[0], err.Error()))
+			}
+			entries.SetMapIndex(key, entry)
+		}
+		value.Set(entries)
+	default:
+		return errors.New(fmt.Sprintf("unsupported type %s", value.Type()))
+	}
+	return nil
+}
+
+// splitList splits comma separated values, ignoring the spaces around them and the empty ones
+func splitList(raw string) []string {
+	items := []string{}
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
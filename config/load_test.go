@@ -0,0 +1,143 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type databaseSettings struct {
+	Host string `env:"HOST" required:"true"`
+	Port int    `env:"PORT" default:"5432"`
+}
+
+type loadTarget struct {
+	Name      string            `env:"LOAD_NAME" required:"true"`
+	Enabled   bool              `env:"LOAD_ENABLED" default:"true"`
+	Ratio     float64           `env:"LOAD_RATIO"`
+	Workers   uint8             `env:"LOAD_WORKERS" default:"4"`
+	Timeout   time.Duration     `env:"LOAD_TIMEOUT" default:"30s"`
+	Buckets   []string          `env:"LOAD_BUCKETS"`
+	Ports     []int             `env:"LOAD_PORTS"`
+	Limits    map[string]int    `env:"LOAD_LIMITS"`
+	Labels    map[string]string `env:"LOAD_LABELS" default:"team=etl"`
+	Optional  *string           `env:"LOAD_OPTIONAL"`
+	Primary   databaseSettings  `prefix:"PRIMARY_DB_"`
+	Replica   *databaseSettings `prefix:"REPLICA_DB_"`
+	Untouched string
+}
+
+func TestLoad(t *testing.T) {
+	optional := "set"
+	tests := []struct {
+		name           string
+		env            map[string]string
+		expectedTarget loadTarget
+		expectedError  error
+	}{
+		{
+			name: "Success when loading every supported type with nested prefixes",
+			env: map[string]string{
+				"LOAD_NAME":          "analyst",
+				"LOAD_ENABLED":       "false",
+				"LOAD_RATIO":         "0.5",
+				"LOAD_TIMEOUT":       "1m30s",
+				"LOAD_BUCKETS":       "landing, loading,",
+				"LOAD_PORTS":         "80,443",
+				"LOAD_LIMITS":        "read=10, write=5",
+				"LOAD_OPTIONAL":      "set",
+				"PRIMARY_DB_HOST":    "primary.local",
+				"REPLICA_DB_HOST":    "replica.local",
+				"REPLICA_DB_PORT":    "6432",
+				"UNRELATED_VARIABLE": "ignored",
+			},
+			expectedTarget: loadTarget{
+				Name:      "analyst",
+				Enabled:   false,
+				Ratio:     0.5,
+				Workers:   4,
+				Timeout:   90 * time.Second,
+				Buckets:   []string{"landing", "loading"},
+				Ports:     []int{80, 443},
+				Limits:    map[string]int{"read": 10, "write": 5},
+				Labels:    map[string]string{"team": "etl"},
+				Optional:  &optional,
+				Primary:   databaseSettings{Host: "primary.local", Port: 5432},
+				Replica:   &databaseSettings{Host: "replica.local", Port: 6432},
+				Untouched: "kept",
+			},
+		},
+		{
+			name: "Success when a nested pointer struct without any variable set is left nil",
+			env: map[string]string{
+				"LOAD_NAME":       "analyst",
+				"PRIMARY_DB_HOST": "primary.local",
+			},
+			expectedTarget: loadTarget{
+				Name:      "analyst",
+				Enabled:   true,
+				Workers:   4,
+				Timeout:   30 * time.Second,
+				Labels:    map[string]string{"team": "etl"},
+				Primary:   databaseSettings{Host: "primary.local", Port: 5432},
+				Untouched: "kept",
+			},
+		},
+		{
+			name: "Fail when a nested pointer struct with a variable set misses a required one",
+			env: map[string]string{
+				"LOAD_NAME":       "analyst",
+				"PRIMARY_DB_HOST": "primary.local",
+				"REPLICA_DB_PORT": "6432",
+			},
+			expectedError: &ValidationError{Errors: []FieldError{
+				{Field: "REPLICA_DB_HOST", Message: "is required"},
+			}},
+		},
+		{
+			name: "Fail with every missing and invalid variable at once",
+			env: map[string]string{
+				"LOAD_WORKERS":    "300",
+				"LOAD_TIMEOUT":    "soon",
+				"LOAD_LIMITS":     "read",
+				"REPLICA_DB_HOST": "replica.local",
+			},
+			expectedError: &ValidationError{Errors: []FieldError{
+				{Field: "LOAD_NAME", Message: "is required"},
+				{Field: "LOAD_WORKERS", Message: `invalid value "300", error: strconv.ParseUint: parsing "300": value out of range`},
+				{Field: "LOAD_TIMEOUT", Message: `invalid value "soon", error: time: invalid duration "soon"`},
+				{Field: "LOAD_LIMITS", Message: `invalid value "read", error: "read" is not a key=value pair`},
+				{Field: "PRIMARY_DB_HOST", Message: "is required"},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		for key, value := range test.env {
+			t.Setenv(key, value)
+		}
+		target := loadTarget{Untouched: "kept"}
+
+		err := Load(&target) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		if test.expectedError == nil {
+			assert.Equal(t, test.expectedTarget, target)
+		}
+
+		for key := range test.env {
+			t.Setenv(key, "")
+		}
+	}
+}
+
+func TestLoadNeedsAPointerToAStruct(t *testing.T) {
+	fmt.Println("name: Fail when the target is not a pointer to a struct")
+
+	err := Load(loadTarget{}) //<--- function under test
+
+	assert.Equal(t, errors.New("config: Load needs a pointer to a struct, got config.loadTarget"), err)
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// variablePattern matches ${VAR} and ${VAR:-default}
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// Options selects the sources of the config. Every source overrides the previous one:
+// registered defaults < file < environment variables < flags. The secret:// and ssm:// references are resolved last
+type Options struct {
+	Type string
+	// File is a yaml or json config file, json being a subset of yaml
+	File string
+	// Args are command line flags, -config <file> replaces File and every -set <section.field>=<value> overrides a field
+	Args []string
+}
+
+// fileConfig is the layout of the config file, the top level sections are shared by every ETL type and the
+// sections under etls override them for a single type
+type fileConfig struct {
+	Config `yaml:",inline"`
+	ETLs   map[string]yaml.Node `yaml:"etls"`
+}
+
+// configField is a leaf of the config, key being its yaml path like loadingZone.s3Bucket
+type configField struct {
+	key   string
+	value reflect.Value
+}
+
+type overrideFlags []string
+
+func (flags *overrideFlags) String() string {
+	return strings.Join(*flags, ",")
+}
+
+func (flags *overrideFlags) Set(value string) error {
+	*flags = append(*flags, value)
+	return nil
+}
+
+// Build assembles the config of the ETL type. The type needs registered defaults or a section under etls in the file
+func Build(options Options) (Config, error) {
+	file, overrides, err := parseFlags(options.File, options.Args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg, known := defaults(options.Type)
+	if file != "" {
+		found, err := applyFile(&cfg, file, strings.ToLower(options.Type))
+		if err != nil {
+			return Config{}, err
+		}
+		known = known || found
+	}
+	if !known {
+		return Config{}, errors.New(fmt.Sprintf("unknown etl type %q, add a section for it under etls in the config file", options.Type))
+	}
+
+	if err := Load(&cfg); err != nil {
+		return Config{}, err
+	}
+	if err := applyOverrides(configFields(reflect.ValueOf(&cfg).Elem(), ""), overrides); err != nil {
+		return Config{}, err
+	}
+	// The references are resolved once every source is applied, with the aws config they set
+	if err := resolveSecrets(reflect.ValueOf(&cfg), cfg.AWSConfig); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func parseFlags(file string, args []string) (string, []string, error) {
+	var overrides overrideFlags
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	configFile := flags.String("config", file, "yaml or json config file")
+	flags.Var(&overrides, "set", "override of a config field as section.field=value, can be repeated")
+
+	if err := flags.Parse(args); err != nil {
+		return "", nil, errors.New(fmt.Sprintf("failed to parse the config flags, error: %s", err.Error()))
+	}
+	return *configFile, overrides, nil
+}
+
+// applyFile decodes the shared sections and then the section of the ETL type over cfg, fields missing from the
+// file keep their value. It returns whether the file has a section for the type
+func applyFile(cfg *Config, file, etlType string) (bool, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("failed to read the config file %s, error: %s", file, err.Error()))
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return false, errors.New(fmt.Sprintf("failed to parse the config file %s, error: %s", file, err.Error()))
+	}
+	if err := interpolate(&root); err != nil {
+		return false, errors.New(fmt.Sprintf("failed to interpolate the config file %s, error: %s", file, err.Error()))
+	}
+
+	parsed := fileConfig{Config: *cfg}
+	if err := decodeStrict(&root, &parsed); err != nil {
+		return false, errors.New(fmt.Sprintf("invalid config file %s, error: %s", file, err.Error()))
+	}
+	*cfg = parsed.Config
+
+	section, ok := parsed.ETLs[etlType]
+	if !ok {
+		return false, nil
+	}
+	if err := decodeStrict(&section, cfg); err != nil {
+		return false, errors.New(fmt.Sprintf("invalid section etls.%s in the config file %s, error: %s", etlType, file, err.Error()))
+	}
+	return true, nil
+}
+
+// decodeStrict decodes the node rejecting unknown fields, so typos in the file do not go unnoticed
+func decodeStrict(node *yaml.Node, out interface{}) error {
+	if node.Kind == 0 || (node.Kind == yaml.DocumentNode && len(node.Content) == 0) {
+		return nil
+	}
+
+	content, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	return decoder.Decode(out)
+}
+
+// interpolate replaces ${VAR} and ${VAR:-default} in every scalar with the environment variable, a variable that is
+// not set and has no default is an error
+func interpolate(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var missing []string
+		expanded := variablePattern.ReplaceAllStringFunc(node.Value, func(variable string) string {
+			match := variablePattern.FindStringSubmatch(variable)
+			if value, ok := os.LookupEnv(match[1]); ok {
+				return value
+			}
+			if match[2] != "" {
+				return match[3]
+			}
+			missing = append(missing, match[1])
+			return variable
+		})
+		if len(missing) > 0 {
+			return errors.New(fmt.Sprintf("line %d: variable %s is not set", node.Line, strings.Join(missing, ", ")))
+		}
+
+		if expanded != node.Value {
+			node.Value = expanded
+			// A plain scalar is resolved again, so ${ENABLED} can be decoded as a bool
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+		}
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := interpolate(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func configFields(value reflect.Value, prefix string) []configField {
+	fields := []configField{}
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		key := strings.Split(structField.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if value.Field(i).Kind() == reflect.Struct {
+			fields = append(fields, configFields(value.Field(i), key)...)
+			continue
+		}
+		fields = append(fields, configField{key: key, value: value.Field(i)})
+	}
+	return fields
+}
+
+func applyOverrides(fields []configField, overrides []string) error {
+	for _, override := range overrides {
+		parts := strings.SplitN(override, "=", 2)
+		if len(parts) != 2 {
+			return errors.New(fmt.Sprintf("invalid override %q, expected section.field=value", override))
+		}
+
+		field, ok := findField(fields, parts[0])
+		if !ok {
+			return errors.New(fmt.Sprintf("invalid override %q, unknown field %s", override, parts[0]))
+		}
+		if err := setValue(field.value, parts[1]); err != nil {
+			return errors.New(fmt.Sprintf("invalid override %q, error: %s", override, err.Error()))
+		}
+	}
+	return nil
+}
+
+func findField(fields []configField, key string) (configField, bool) {
+	for _, field := range fields {
+		if field.key == key {
+			return field, true
+		}
+	}
+	return configField{}, false
+}
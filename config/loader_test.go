@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"github.com/anhamdan/etl-base/config/settings"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testConfigFile = `
+landingZone:
+  s3Bucket: shared-landing-zone
+loadingZone:
+  s3Bucket: ${LOADING_BUCKET:-shared-loading-zone}
+  enabled: ${LOADING_ENABLED:-true}
+etls:
+  analyst:
+    landingZone:
+      s3Bucket: analyst-landing-zone
+  vibration:
+    workflowManager:
+      sqsURL: https://sqs.eu-west-1.amazonaws.com/123456789012/vibration
+    aws:
+      region: eu-central-1
+`
+
+var testDefaults = Config{
+	LandingZoneConfig: settings.LandingZoneConfig{S3Bucket: "landing-zone-poc"},
+	LoadingZoneConfig: settings.LoadingZoneConfig{
+		S3Bucket:        "enlight-loading-zone-poc",
+		LZHelperEnabled: true,
+		StagingPrefix:   "_staging",
+	},
+	WorkflowManagerConfig: settings.WorkflowManagerConfig{GroupID: "123", WorkFlowManagerEnabled: true},
+	AWSConfig:             AWSConfig{Profile: "default", Region: "eu-west-1", S3Backend: "aws", S3LocalRoot: "local-s3"},
+	StateStoreConfig:      StateStoreConfig{Backend: "memory", S3Bucket: "enlight-loading-zone-poc", Prefix: "_state"},
+}
+
+func init() {
+	RegisterDefaults("Analyst", testDefaults)
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, ioutil.WriteFile(file, []byte(content), 0644))
+	return file
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name          string
+		options       Options
+		env           map[string]string
+		expectedCheck func(t *testing.T, cfg Config)
+		expectedError string
+	}{
+		{
+			name:    "Success when building the registered analyst config without a file",
+			options: Options{Type: "analyst"},
+			expectedCheck: func(t *testing.T, cfg Config) {
+				assert.Equal(t, testDefaults, cfg)
+			},
+		},
+		{
+			name:    "Success when the etl section overrides the shared sections and the defaults",
+			options: Options{Type: "analyst", File: writeConfigFile(t, "config.yaml", testConfigFile)},
+			expectedCheck: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "analyst-landing-zone", cfg.LandingZoneConfig.S3Bucket)
+				assert.Equal(t, "shared-loading-zone", cfg.LoadingZoneConfig.S3Bucket)
+				assert.Equal(t, "_staging", cfg.LoadingZoneConfig.StagingPrefix)
+				assert.Equal(t, "eu-west-1", cfg.AWSConfig.Region)
+			},
+		},
+		{
+			name:    "Success when adding a new etl type only in the file",
+			options: Options{Type: "vibration", File: writeConfigFile(t, "config.yaml", testConfigFile)},
+			expectedCheck: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "shared-landing-zone", cfg.LandingZoneConfig.S3Bucket)
+				assert.Equal(t, "https://sqs.eu-west-1.amazonaws.com/123456789012/vibration", cfg.WorkflowManagerConfig.SQSURL)
+				assert.Equal(t, "eu-central-1", cfg.AWSConfig.Region)
+				assert.True(t, cfg.LoadingZoneConfig.LZHelperEnabled)
+				assert.Equal(t, "", cfg.StateStoreConfig.Backend)
+			},
+		},
+		{
+			name:    "Success when reading a json file",
+			options: Options{Type: "vibration", File: writeConfigFile(t, "config.json", `{"etls": {"vibration": {"aws": {"region": "eu-north-1"}}}}`)},
+			expectedCheck: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "eu-north-1", cfg.AWSConfig.Region)
+			},
+		},
+		{
+			name:    "Success when interpolating environment variables in the file",
+			options: Options{Type: "analyst", File: writeConfigFile(t, "config.yaml", testConfigFile)},
+			env:     map[string]string{"LOADING_BUCKET": "interpolated-bucket", "LOADING_ENABLED": "false"},
+			expectedCheck: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "interpolated-bucket", cfg.LoadingZoneConfig.S3Bucket)
+				assert.False(t, cfg.LoadingZoneConfig.LZHelperEnabled)
+			},
+		},
+		{
+			name:    "Success when environment variables override the file and flags override both",
+			options: Options{Type: "analyst", File: writeConfigFile(t, "config.yaml", testConfigFile), Args: []string{"-set", "aws.region=us-east-1"}},
+			env:     map[string]string{"S3_BUCKET_LANDING_ZONE": "env-landing-zone", "AWS_REGION": "eu-west-2"},
+			expectedCheck: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "env-landing-zone", cfg.LandingZoneConfig.S3Bucket)
+				assert.Equal(t, "us-east-1", cfg.AWSConfig.Region)
+			},
+		},
+		{
+			name:    "Success when the config flag replaces the file",
+			options: Options{Type: "vibration", File: "missing.yaml", Args: []string{"-config", writeConfigFile(t, "config.yaml", testConfigFile)}},
+			expectedCheck: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "eu-central-1", cfg.AWSConfig.Region)
+			},
+		},
+		{
+			name:          "Fail when the etl type is unknown",
+			options:       Options{Type: "unknown", File: writeConfigFile(t, "config.yaml", testConfigFile)},
+			expectedError: `unknown etl type "unknown", add a section for it under etls in the config file`,
+		},
+		{
+			name:          "Fail when a variable is not set and has no default",
+			options:       Options{Type: "analyst", File: writeConfigFile(t, "config.yaml", "aws:\n  region: ${MISSING_REGION}\n")},
+			expectedError: "line 2: variable MISSING_REGION is not set",
+		},
+		{
+			name:          "Fail when overriding an unknown field",
+			options:       Options{Type: "analyst", Args: []string{"-set", "aws.zone=a"}},
+			expectedError: `invalid override "aws.zone=a", unknown field aws.zone`,
+		},
+		{
+			name:          "Fail when an environment variable has an invalid value",
+			options:       Options{Type: "analyst"},
+			env:           map[string]string{"MANAGER_ENABLED": "maybe"},
+			expectedError: `MANAGER_ENABLED: invalid value "maybe", error: strconv.ParseBool: parsing "maybe": invalid syntax`,
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		for key, value := range test.env {
+			t.Setenv(key, value)
+		}
+
+		cfg, err := Build(test.options) //<--- function under test
+
+		if test.expectedError != "" {
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.expectedError)
+		} else {
+			assert.Nil(t, err)
+			test.expectedCheck(t, cfg)
+		}
+
+		for key := range test.env {
+			t.Setenv(key, "")
+		}
+	}
+}
+
+func TestBuildRejectsUnknownFields(t *testing.T) {
+	fmt.Println("name: Fail when the file has a field the config does not know")
+
+	file := writeConfigFile(t, "config.yaml", "etls:\n  analyst:\n    aws:\n      regoin: eu-west-1\n")
+
+	_, err := Build(Options{Type: "analyst", File: file}) //<--- function under test
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "field regoin not found")
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SecretsManagerScheme = "secret://"
+	SSMScheme            = "ssm://"
+	defaultSecretTTL     = 5 * time.Minute
+)
+
+// SecretResolver returns the value of a reference like secret://name or ssm:///path, scheme included
+type SecretResolver interface {
+	Resolve(reference string) (string, error)
+}
+
+var (
+	resolvers = map[string]SecretResolver{}
+	// awsResolvers are created on first use for every aws account and endpoint the references are read from
+	awsResolvers   = map[awsResolverKey]SecretResolver{}
+	resolversMutex sync.RWMutex
+)
+
+type awsResolverKey struct {
+	scheme   string
+	profile  string
+	region   string
+	roleArn  string
+	endpoint string
+}
+
+// RegisterResolver resolves the config values starting with scheme, like "vault://", with resolver. When nothing
+// is registered for secret:// and ssm://, Secrets Manager and Parameter Store are used with the aws config
+func RegisterResolver(scheme string, resolver SecretResolver) {
+	resolversMutex.Lock()
+	defer resolversMutex.Unlock()
+
+	resolvers[scheme] = resolver
+}
+
+// resolverFor returns the registered resolver of the scheme, or the aws one of the aws config, created on first use
+func resolverFor(scheme string, awsConfig AWSConfig) (SecretResolver, error) {
+	resolversMutex.Lock()
+	defer resolversMutex.Unlock()
+
+	if resolver, ok := resolvers[scheme]; ok {
+		return resolver, nil
+	}
+
+	key := awsResolverKey{scheme: scheme, profile: awsConfig.Profile, region: awsConfig.Region, roleArn: awsConfig.WebIdentityRoleArn}
+	if scheme == SecretsManagerScheme {
+		key.endpoint = awsConfig.Endpoints.SecretsManager
+	} else {
+		key.endpoint = awsConfig.Endpoints.SSM
+	}
+	if resolver, ok := awsResolvers[key]; ok {
+		return resolver, nil
+	}
+
+	resolver, err := newAWSResolver(scheme, awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	awsResolvers[key] = resolver
+	return resolver, nil
+}
+
+func referenceScheme(value string) (string, bool) {
+	resolversMutex.RLock()
+	defer resolversMutex.RUnlock()
+
+	for scheme := range resolvers {
+		if strings.HasPrefix(value, scheme) {
+			return scheme, true
+		}
+	}
+	for _, scheme := range []string{SecretsManagerScheme, SSMScheme} {
+		if strings.HasPrefix(value, scheme) {
+			return scheme, true
+		}
+	}
+	return "", false
+}
+
+// ResolveSecrets replaces the references in the string fields of the struct pointed by target, like the settings
+// filled by Load, reading them with awsConfig, the AWSConfig of the built config
+func ResolveSecrets(target interface{}, awsConfig AWSConfig) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return errors.New(fmt.Sprintf("config: ResolveSecrets needs a pointer to a struct, got %T", target))
+	}
+	return resolveSecrets(value, awsConfig)
+}
+
+// resolveSecrets replaces every reference in the string fields of target, including pointers, slices and map values
+// of strings. The errors name the fields but never the values
+func resolveSecrets(target reflect.Value, awsConfig AWSConfig) error {
+	validation := &ValidationError{}
+	resolveValue(target, "", awsConfig, validation)
+	return validation.orNil()
+}
+
+func resolveValue(value reflect.Value, field string, awsConfig AWSConfig, validation *ValidationError) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			resolveValue(value.Elem(), field, awsConfig, validation)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Field(i).CanSet() {
+				resolveValue(value.Field(i), joinField(field, fieldName(value.Type().Field(i))), awsConfig, validation)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			resolveValue(value.Index(i), fmt.Sprintf("%s[%d]", field, i), awsConfig, validation)
+		}
+	case reflect.Map:
+		if value.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		for _, key := range value.MapKeys() {
+			entry := reflect.New(value.Type().Elem()).Elem()
+			entry.Set(value.MapIndex(key))
+			resolveValue(entry, fmt.Sprintf("%s[%v]", field, key.Interface()), awsConfig, validation)
+			value.SetMapIndex(key, entry)
+		}
+	case reflect.String:
+		scheme, ok := referenceScheme(value.String())
+		if !ok {
+			return
+		}
+		resolver, err := resolverFor(scheme, awsConfig)
+		if err != nil {
+			validation.add(field, "could not create the resolver of %s, error: %s", scheme, err.Error())
+			return
+		}
+		resolved, err := resolver.Resolve(value.String())
+		if err != nil {
+			validation.add(field, "could not resolve %s, error: %s", value.String(), err.Error())
+			return
+		}
+		value.SetString(resolved)
+	}
+}
+
+func fieldName(structField reflect.StructField) string {
+	if name := strings.Split(structField.Tag.Get("yaml"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return structField.Name
+}
+
+func joinField(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// cachingResolver keeps the resolved values for ttl, so a reference used by several fields or loads is fetched once
+type cachingResolver struct {
+	resolver SecretResolver
+	ttl      time.Duration
+	now      func() time.Time
+	entries  map[string]cachedSecret
+	mutex    sync.Mutex
+}
+
+type cachedSecret struct {
+	value     string
+	expiresAt time.Time
+}
+
+func NewCachingResolver(resolver SecretResolver, ttl time.Duration) *cachingResolver {
+	return &cachingResolver{resolver: resolver, ttl: ttl, now: time.Now, entries: map[string]cachedSecret{}}
+}
+
+func (resolver *cachingResolver) Resolve(reference string) (string, error) {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+
+	if entry, ok := resolver.entries[reference]; ok && resolver.now().Before(entry.expiresAt) {
+		return entry.value, nil
+	}
+
+	value, err := resolver.resolver.Resolve(reference)
+	if err != nil {
+		return "", err
+	}
+	resolver.entries[reference] = cachedSecret{value: value, expiresAt: resolver.now().Add(resolver.ttl)}
+	return value, nil
+}
+
+// fileResolver reads the references from a yaml or json file mapping them to their values, like
+// "secret://etl/db#password": "local-password". It replaces the aws resolvers during development and tests
+type fileResolver struct {
+	values map[string]string
+}
+
+func NewFileResolver(path string) (*fileResolver, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to read the secrets file %s, error: %s", path, err.Error()))
+	}
+
+	values := map[string]string{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to parse the secrets file %s, error: %s", path, err.Error()))
+	}
+	return &fileResolver{values: values}, nil
+}
+
+func (resolver *fileResolver) Resolve(reference string) (string, error) {
+	value, ok := resolver.values[reference]
+	if !ok {
+		return "", errors.New("the reference is not in the secrets file")
+	}
+	return value, nil
+}
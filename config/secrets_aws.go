@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"strings"
+)
+
+type SecretsManagerClient interface {
+	GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+type SSMClient interface {
+	GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
+}
+
+// secretsManagerResolver resolves secret://name to the secret string and secret://name#key to a key of a json secret
+type secretsManagerResolver struct {
+	client SecretsManagerClient
+}
+
+func NewSecretsManagerResolver(client SecretsManagerClient) *secretsManagerResolver {
+	return &secretsManagerResolver{client: client}
+}
+
+func (resolver *secretsManagerResolver) Resolve(reference string) (string, error) {
+	name := strings.TrimPrefix(reference, SecretsManagerScheme)
+	key := ""
+	if index := strings.LastIndex(name, "#"); index >= 0 {
+		name, key = name[:index], name[index+1:]
+	}
+
+	output, err := resolver.client.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	if output.SecretString == nil {
+		return "", errors.New(fmt.Sprintf("the secret %s has no string value", name))
+	}
+	if key == "" {
+		return *output.SecretString, nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(*output.SecretString), &values); err != nil {
+		return "", errors.New(fmt.Sprintf("the secret %s is not a json object", name))
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", errors.New(fmt.Sprintf("the secret %s has no key %s", name, key))
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// ssmResolver resolves ssm:///path/name, or ssm://name, to the decrypted value of the parameter
+type ssmResolver struct {
+	client SSMClient
+}
+
+func NewSSMResolver(client SSMClient) *ssmResolver {
+	return &ssmResolver{client: client}
+}
+
+func (resolver *ssmResolver) Resolve(reference string) (string, error) {
+	name := strings.TrimPrefix(reference, SSMScheme)
+
+	output, err := resolver.client.GetParameter(&ssm.GetParameterInput{Name: aws.String(name), WithDecryption: aws.Bool(true)})
+	if err != nil {
+		return "", err
+	}
+	if output.Parameter == nil || output.Parameter.Value == nil {
+		return "", errors.New(fmt.Sprintf("the parameter %s has no value", name))
+	}
+	return *output.Parameter.Value, nil
+}
+
+func newAWSResolver(scheme string, awsConfig AWSConfig) (SecretResolver, error) {
+	if scheme != SecretsManagerScheme && scheme != SSMScheme {
+		return nil, errors.New(fmt.Sprintf("no resolver registered for %s", scheme))
+	}
+
+	awsSession, err := awsConfig.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	if scheme == SecretsManagerScheme {
+		return NewCachingResolver(NewSecretsManagerResolver(secretsmanager.New(awsSession)), defaultSecretTTL), nil
+	}
+	return NewCachingResolver(NewSSMResolver(ssm.New(awsSession)), defaultSecretTTL), nil
+}
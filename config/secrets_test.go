@@ -0,0 +1,223 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type secretsManagerMock struct {
+	secrets map[string]string
+	calls   int
+}
+
+func (mock *secretsManagerMock) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	mock.calls++
+	secret, ok := mock.secrets[*input.SecretId]
+	if !ok {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(secret)}, nil
+}
+
+// registerTestResolver registers the resolver for the schemes until the end of the test, then restores the resolvers
+// of the package
+func registerTestResolver(t *testing.T, resolver SecretResolver, schemes ...string) {
+	resolversMutex.Lock()
+	previous := resolvers
+	resolvers = map[string]SecretResolver{}
+	for scheme, registered := range previous {
+		resolvers[scheme] = registered
+	}
+	resolversMutex.Unlock()
+
+	t.Cleanup(func() {
+		resolversMutex.Lock()
+		defer resolversMutex.Unlock()
+
+		resolvers = previous
+		awsResolvers = map[awsResolverKey]SecretResolver{}
+	})
+	for _, scheme := range schemes {
+		RegisterResolver(scheme, resolver)
+	}
+}
+
+type ssmMock struct {
+	parameters map[string]string
+}
+
+func (mock *ssmMock) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	parameter, ok := mock.parameters[*input.Name]
+	if !ok || !*input.WithDecryption {
+		return nil, errors.New("ParameterNotFound")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String(parameter)}}, nil
+}
+
+func TestSecretsManagerResolver(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		expectedResponse string
+		expectedError    error
+	}{
+		{
+			name:             "Success when resolving the secret string",
+			input:            "secret://etl/token",
+			expectedResponse: "some token",
+		},
+		{
+			name:             "Success when resolving a key of a json secret",
+			input:            "secret://etl/database#password",
+			expectedResponse: "some password",
+		},
+		{
+			name:          "Fail when the json secret has no such key",
+			input:         "secret://etl/database#user",
+			expectedError: errors.New("the secret etl/database has no key user"),
+		},
+		{
+			name:          "Fail when the secret does not exist",
+			input:         "secret://etl/missing",
+			expectedError: errors.New("ResourceNotFoundException"),
+		},
+	}
+
+	resolver := NewSecretsManagerResolver(&secretsManagerMock{secrets: map[string]string{
+		"etl/token":    "some token",
+		"etl/database": `{"host": "db.local", "password": "some password"}`,
+	}})
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		response, err := resolver.Resolve(test.input) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		assert.Equal(t, test.expectedResponse, response)
+	}
+}
+
+func TestSSMResolver(t *testing.T) {
+	fmt.Println("name: Success when resolving the decrypted value of a parameter")
+
+	resolver := NewSSMResolver(&ssmMock{parameters: map[string]string{"/etl/role-arn": "arn:aws:iam::123456789012:role/etl"}})
+
+	response, err := resolver.Resolve("ssm:///etl/role-arn") //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/etl", response)
+}
+
+func TestCachingResolver(t *testing.T) {
+	fmt.Println("name: Success when the cached value is reused until it expires")
+
+	mock := &secretsManagerMock{secrets: map[string]string{"etl/token": "some token"}}
+	resolver := NewCachingResolver(NewSecretsManagerResolver(mock), time.Minute)
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		response, err := resolver.Resolve("secret://etl/token") //<--- function under test
+		assert.Nil(t, err)
+		assert.Equal(t, "some token", response)
+	}
+	assert.Equal(t, 1, mock.calls)
+
+	now = now.Add(2 * time.Minute)
+	_, err := resolver.Resolve("secret://etl/token") //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, mock.calls)
+}
+
+func TestFileResolver(t *testing.T) {
+	fmt.Println("name: Success when resolving references from a local secrets file")
+
+	file := writeConfigFile(t, "secrets.yaml", "secret://etl/token: local token\nssm:///etl/role-arn: local role\n")
+	resolver, err := NewFileResolver(file)
+	assert.Nil(t, err)
+
+	response, err := resolver.Resolve("ssm:///etl/role-arn") //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, "local role", response)
+
+	_, err = resolver.Resolve("secret://etl/missing") //<--- function under test
+
+	assert.Equal(t, errors.New("the reference is not in the secrets file"), err)
+}
+
+func TestBuildResolvesSecrets(t *testing.T) {
+	fmt.Println("name: Success when the references of the file and the environment are resolved")
+
+	resolver, err := NewFileResolver(writeConfigFile(t, "secrets.json", `{
+		"secret://etl/loading-bucket": "secret-loading-zone",
+		"ssm:///etl/sqs-url": "https://sqs.eu-west-1.amazonaws.com/123456789012/analyst"
+	}`))
+	assert.Nil(t, err)
+	registerTestResolver(t, resolver, SecretsManagerScheme, SSMScheme)
+	t.Setenv("SQS_URL", "ssm:///etl/sqs-url")
+
+	cfg, err := Build(Options{ //<--- function under test
+		Type: "analyst",
+		File: writeConfigFile(t, "config.yaml", "loadingZone:\n  s3Bucket: secret://etl/loading-bucket\n"),
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "secret-loading-zone", cfg.LoadingZoneConfig.S3Bucket)
+	assert.Equal(t, "https://sqs.eu-west-1.amazonaws.com/123456789012/analyst", cfg.WorkflowManagerConfig.SQSURL)
+
+	fmt.Println("name: Fail when a reference cannot be resolved, naming the field")
+
+	t.Setenv("S3_BUCKET_LANDING_ZONE", "secret://etl/missing")
+
+	_, err = Build(Options{Type: "analyst"}) //<--- function under test
+
+	assert.Equal(t, &ValidationError{Errors: []FieldError{{
+		Field:   "landingZone.s3Bucket",
+		Message: "could not resolve secret://etl/missing, error: the reference is not in the secrets file",
+	}}}, err)
+}
+
+func TestResolveSecrets(t *testing.T) {
+	fmt.Println("name: Success when Load keeps the references and ResolveSecrets resolves them")
+
+	resolver, err := NewFileResolver(writeConfigFile(t, "secrets.yaml", "secret://etl/db#password: local password\n"))
+	assert.Nil(t, err)
+	registerTestResolver(t, resolver, SecretsManagerScheme)
+	t.Setenv("DB_PASSWORD", "secret://etl/db#password")
+	settings := struct {
+		Password string `env:"DB_PASSWORD"`
+	}{}
+
+	assert.Nil(t, Load(&settings))
+	assert.Equal(t, "secret://etl/db#password", settings.Password)
+
+	err = ResolveSecrets(&settings, AWSConfig{Region: "eu-west-1"}) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, "local password", settings.Password)
+}
+
+func TestAWSResolversPerConfig(t *testing.T) {
+	fmt.Println("name: Success when the aws resolvers are created for the aws config of the references")
+
+	registerTestResolver(t, nil)
+
+	euResolver, err := resolverFor(SecretsManagerScheme, AWSConfig{Region: "eu-west-1"}) //<--- function under test
+	assert.Nil(t, err)
+	usResolver, err := resolverFor(SecretsManagerScheme, AWSConfig{Region: "us-east-1"}) //<--- function under test
+	assert.Nil(t, err)
+	sameResolver, err := resolverFor(SecretsManagerScheme, AWSConfig{Region: "eu-west-1"}) //<--- function under test
+	assert.Nil(t, err)
+
+	assert.NotSame(t, euResolver, usResolver)
+	assert.Same(t, euResolver, sameResolver)
+}
@@ -0,0 +1,29 @@
+// Package settings holds the config types shared by config and helpers. It must not import any package of the
+// module, so both can depend on it without an import cycle
+package settings
+
+import "time"
+
+type LandingZoneConfig struct {
+	S3Bucket string `yaml:"s3Bucket" env:"S3_BUCKET_LANDING_ZONE"`
+	Path     string `yaml:"path"`
+}
+
+type LoadingZoneConfig struct {
+	S3Bucket        string `yaml:"s3Bucket" env:"S3_BUCKET_LOADING_ZONE"`
+	LZHelperEnabled bool   `yaml:"enabled" env:"LOADING_ZONE_HELPER_ENABLED"`
+	StagingPrefix   string `yaml:"stagingPrefix" env:"LOADING_ZONE_STAGING_PREFIX"`
+	OutputPrefix    string `yaml:"outputPrefix" env:"LOADING_ZONE_OUTPUT_PREFIX"`
+}
+
+type WorkflowManagerConfig struct {
+	WorkFlowManagerEnabled bool   `yaml:"enabled" env:"MANAGER_ENABLED"`
+	SQSURL                 string `yaml:"sqsURL" env:"SQS_URL"`
+	TopicARN               string `yaml:"topicARN" env:"MANAGER_TOPIC_ARN"`
+	GroupID                string `yaml:"groupID" env:"MANAGER_GROUP_ID"`
+	// LocalEventPath is a json file with the ManagerEvent used while the workflow manager is disabled
+	LocalEventPath string `yaml:"localEventPath" env:"MANAGER_LOCAL_EVENT_PATH"`
+	// VisibilityTimeout hides the message of the event being processed from the other workers, it is extended every
+	// half of it until the event is settled. Two minutes by default
+	VisibilityTimeout time.Duration `yaml:"visibilityTimeout" env:"MANAGER_VISIBILITY_TIMEOUT"`
+}
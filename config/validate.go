@@ -0,0 +1,258 @@
+package config
+
+import (
+	"fmt"
+	"github.com/anhamdan/etl-base/constants"
+	"github.com/anhamdan/etl-base/logging"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	regionPattern     = regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-[0-9]$`)
+	snsTopicPattern   = regexp.MustCompile(`^arn:aws[a-z-]*:sns:[a-z0-9-]+:[0-9]{12}:[A-Za-z0-9_-]{1,256}(\.fifo)?$`)
+)
+
+// FieldError is a single problem of the config, Field being its path like workflowManager.sqsURL
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (err FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Field, err.Message)
+}
+
+// ValidationError holds every problem found in the config, so all of them can be fixed at once
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (err *ValidationError) Error() string {
+	problems := make([]string, len(err.Errors))
+	for i, fieldError := range err.Errors {
+		problems[i] = "  - " + fieldError.Error()
+	}
+	return fmt.Sprintf("invalid config, %d problem(s):\n%s", len(err.Errors), strings.Join(problems, "\n"))
+}
+
+func (err *ValidationError) add(field, message string, args ...interface{}) {
+	err.Errors = append(err.Errors, FieldError{Field: field, Message: fmt.Sprintf(message, args...)})
+}
+
+// orNil returns nil when nothing was found, a nil *ValidationError stored in an error would not be nil
+func (err *ValidationError) orNil() error {
+	if len(err.Errors) == 0 {
+		return nil
+	}
+	return err
+}
+
+// Validate checks the required fields, the formats of urls, arns and bucket names and the rules between fields.
+// The returned error is a *ValidationError listing every problem
+func (cfg Config) Validate() error {
+	validation := &ValidationError{}
+
+	validation.bucket("landingZone.s3Bucket", cfg.LandingZoneConfig.S3Bucket, true)
+
+	loadingZone := cfg.LoadingZoneConfig
+	validation.bucket("loadingZone.s3Bucket", loadingZone.S3Bucket, loadingZone.LZHelperEnabled)
+	// An empty staging prefix takes constants.DefaultStagingPrefix in the loading zone helper
+	validation.prefix("loadingZone.stagingPrefix", loadingZone.StagingPrefix)
+	validation.prefix("loadingZone.outputPrefix", loadingZone.OutputPrefix)
+
+	workflowManager := cfg.WorkflowManagerConfig
+	if workflowManager.WorkFlowManagerEnabled && workflowManager.SQSURL == "" {
+		validation.add("workflowManager.sqsURL", "is required when the workflow manager is enabled")
+	} else if workflowManager.SQSURL != "" {
+		validation.url("workflowManager.sqsURL", workflowManager.SQSURL)
+	}
+	if workflowManager.TopicARN != "" && !snsTopicPattern.MatchString(workflowManager.TopicARN) {
+		validation.add("workflowManager.topicARN", "%q is not a valid sns topic arn", workflowManager.TopicARN)
+	}
+	if workflowManager.WorkFlowManagerEnabled && workflowManager.LocalEventPath != "" {
+		validation.add("workflowManager.localEventPath", "is only used when the workflow manager is disabled")
+	} else if !workflowManager.WorkFlowManagerEnabled && workflowManager.LocalEventPath == "" {
+		validation.add("workflowManager.localEventPath", "is required when the workflow manager is disabled")
+	}
+	// sqs counts the visibility timeout in seconds, up to 12 hours
+	if timeout := workflowManager.VisibilityTimeout; timeout != 0 && (timeout < time.Second || timeout > constants.MaxVisibilityTimeout) {
+		validation.add("workflowManager.visibilityTimeout", "must be between 1s and %s", constants.MaxVisibilityTimeout)
+	}
+
+	aws := cfg.AWSConfig
+	if aws.Region == "" {
+		validation.add("aws.region", "is required")
+	} else if !regionPattern.MatchString(aws.Region) {
+		validation.add("aws.region", "%q is not a valid aws region", aws.Region)
+	}
+	switch aws.S3Backend {
+	case constants.AWSS3Backend:
+	case constants.LocalS3Backend:
+		if aws.S3LocalRoot == "" {
+			validation.add("aws.s3LocalRoot", "is required when the s3 backend is fs")
+		}
+	default:
+		validation.add("aws.s3Backend", "%q is not one of aws, fs", aws.S3Backend)
+	}
+	for _, endpoint := range []struct{ field, url string }{
+		{"aws.endpoints.s3", aws.Endpoints.S3},
+		{"aws.endpoints.sqs", aws.Endpoints.SQS},
+		{"aws.endpoints.sfn", aws.Endpoints.SFN},
+		{"aws.endpoints.sts", aws.Endpoints.STS},
+		{"aws.endpoints.secretsManager", aws.Endpoints.SecretsManager},
+		{"aws.endpoints.ssm", aws.Endpoints.SSM},
+	} {
+		if endpoint.url != "" {
+			validation.url(endpoint.field, endpoint.url)
+		}
+	}
+	if aws.HTTPTimeout < 0 {
+		validation.add("aws.httpTimeout", "must not be negative")
+	}
+	if aws.HTTPConnectTimeout < 0 {
+		validation.add("aws.httpConnectTimeout", "must not be negative")
+	}
+	if aws.MaxRetries != nil && *aws.MaxRetries < 0 {
+		validation.add("aws.maxRetries", "must not be negative")
+	}
+	if aws.WebIdentityTokenFile != "" && aws.WebIdentityRoleArn == "" {
+		validation.add("aws.webIdentityRoleArn", "is required when a web identity token file is set")
+	}
+	validation.s3Limit("aws.s3Get", aws.S3Get)
+	validation.s3Limit("aws.s3Put", aws.S3Put)
+
+	stateStore := cfg.StateStoreConfig
+	switch stateStore.Backend {
+	case constants.MemoryStateStore:
+	case constants.S3StateStore:
+		validation.bucket("stateStore.s3Bucket", stateStore.S3Bucket, true)
+		validation.prefix("stateStore.prefix", stateStore.Prefix)
+	default:
+		validation.add("stateStore.backend", "%q is not one of memory, s3", stateStore.Backend)
+	}
+
+	if _, err := logging.ParseLevel(cfg.LoggingConfig.Level); err != nil {
+		validation.add("logging.level", err.Error())
+	}
+
+	metricsConfig := cfg.MetricsConfig
+	switch metricsConfig.Exporter {
+	case constants.EmptyString, constants.NoMetricsExporter, constants.EMFMetricsExporter:
+	case constants.PrometheusMetricsExporter:
+		if metricsConfig.Address == "" {
+			validation.add("metrics.address", "is required when the metrics exporter is prometheus")
+		}
+	default:
+		validation.add("metrics.exporter", "%q is not one of none, prometheus, emf", metricsConfig.Exporter)
+	}
+	if metricsConfig.FlushInterval < 0 {
+		validation.add("metrics.flushInterval", "must not be negative")
+	}
+
+	tracingConfig := cfg.TracingConfig
+	switch tracingConfig.Exporter {
+	case constants.EmptyString, constants.NoTracingExporter:
+	case constants.OTLPTracingExporter:
+		if tracingConfig.Endpoint == "" {
+			validation.add("tracing.endpoint", "is required when the tracing exporter is otlp")
+		}
+	default:
+		validation.add("tracing.exporter", "%q is not one of none, otlp", tracingConfig.Exporter)
+	}
+
+	healthConfig := cfg.HealthConfig
+	if healthConfig.Enabled && healthConfig.Address == "" {
+		validation.add("health.address", "is required when the health server is enabled")
+	}
+	if healthConfig.PollMaxAge < 0 {
+		validation.add("health.pollMaxAge", "must not be negative")
+	}
+
+	validation.retryPolicy("retry.default", cfg.RetryConfig.Default)
+	operations := make([]string, 0, len(cfg.RetryConfig.Operations))
+	for operation := range cfg.RetryConfig.Operations {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	for _, operation := range operations {
+		validation.retryPolicy("retry.operations."+operation, cfg.RetryConfig.Operations[operation])
+	}
+
+	return validation.orNil()
+}
+
+// s3Limit checks the limits of a request kind, the zero values are valid since they take the defaults
+func (err *ValidationError) s3Limit(field string, limit S3LimitConfig) {
+	if limit.RequestsPerSecond < 0 {
+		err.add(field+".requestsPerSecond", "must not be negative")
+	}
+	if limit.Burst < 0 {
+		err.add(field+".burst", "must not be negative")
+	}
+	if limit.MaxConcurrency < 0 {
+		err.add(field+".maxConcurrency", "must not be negative")
+	}
+}
+
+// retryPolicy checks the bounds of a policy, the zero values are valid since they take the defaults
+func (err *ValidationError) retryPolicy(field string, policy RetryPolicy) {
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"initialInterval", policy.InitialInterval},
+		{"maxInterval", policy.MaxInterval},
+		{"maxElapsedTime", policy.MaxElapsedTime},
+	}
+	for _, duration := range durations {
+		if duration.value < 0 {
+			err.add(field+"."+duration.name, "must not be negative")
+		}
+	}
+	if policy.Multiplier != 0 && policy.Multiplier < 1 {
+		err.add(field+".multiplier", "must be at least 1")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		err.add(field+".jitter", "must be between 0 and 1")
+	}
+	if policy.MaxAttempts < 0 {
+		err.add(field+".maxAttempts", "must not be negative")
+	}
+}
+
+// bucket checks the s3 bucket naming rules, an empty name is only an error when the bucket is required
+func (err *ValidationError) bucket(field, name string, required bool) {
+	switch {
+	case name == "":
+		if required {
+			err.add(field, "is required")
+		}
+	case !bucketNamePattern.MatchString(name):
+		err.add(field, "%q must be 3 to 63 lowercase letters, numbers, dots or hyphens, starting and ending with a letter or number", name)
+	case strings.Contains(name, ".."):
+		err.add(field, "%q must not contain two adjacent dots", name)
+	case net.ParseIP(name) != nil:
+		err.add(field, "%q must not be formatted as an ip address", name)
+	case strings.HasPrefix(name, "xn--") || strings.HasSuffix(name, "-s3alias"):
+		err.add(field, "%q must not start with xn-- or end with -s3alias", name)
+	}
+}
+
+func (err *ValidationError) prefix(field, prefix string) {
+	if strings.HasPrefix(prefix, "/") {
+		err.add(field, "%q must not start with /", prefix)
+	}
+}
+
+func (err *ValidationError) url(field, rawURL string) {
+	parsed, parseErr := url.Parse(rawURL)
+	if parseErr != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		err.add(field, "%q is not a valid http(s) url", rawURL)
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func validConfig() Config {
+	cfg := testDefaults
+	cfg.WorkflowManagerConfig.SQSURL = "https://sqs.eu-west-1.amazonaws.com/123456789012/analyst"
+	cfg.WorkflowManagerConfig.TopicARN = "arn:aws:sns:eu-west-1:123456789012:manager.fifo"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name           string
+		modify         func(cfg *Config)
+		expectedErrors []FieldError
+	}{
+		{
+			name:   "Success when the config is valid",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name: "Success when the workflow manager is disabled without a queue",
+			modify: func(cfg *Config) {
+				cfg.WorkflowManagerConfig = Config{}.WorkflowManagerConfig
+				cfg.WorkflowManagerConfig.LocalEventPath = "event.json"
+			},
+		},
+		{
+			name: "Success when the loading zone helper is enabled without a staging prefix",
+			modify: func(cfg *Config) {
+				cfg.LoadingZoneConfig.LZHelperEnabled = true
+				cfg.LoadingZoneConfig.StagingPrefix = ""
+			},
+		},
+		{
+			name: "Fail when the workflow manager is disabled without a local event",
+			modify: func(cfg *Config) {
+				cfg.WorkflowManagerConfig = Config{}.WorkflowManagerConfig
+			},
+			expectedErrors: []FieldError{
+				{Field: "workflowManager.localEventPath", Message: "is required when the workflow manager is disabled"},
+			},
+		},
+		{
+			name: "Fail when the queue is missing while the workflow manager is enabled",
+			modify: func(cfg *Config) {
+				cfg.WorkflowManagerConfig.SQSURL = ""
+			},
+			expectedErrors: []FieldError{
+				{Field: "workflowManager.sqsURL", Message: "is required when the workflow manager is enabled"},
+			},
+		},
+		{
+			name: "Fail when the url and the arn are malformed",
+			modify: func(cfg *Config) {
+				cfg.WorkflowManagerConfig.SQSURL = "sqs/analyst"
+				cfg.WorkflowManagerConfig.TopicARN = "arn:aws:sqs:eu-west-1:123:manager"
+			},
+			expectedErrors: []FieldError{
+				{Field: "workflowManager.sqsURL", Message: `"sqs/analyst" is not a valid http(s) url`},
+				{Field: "workflowManager.topicARN", Message: `"arn:aws:sqs:eu-west-1:123:manager" is not a valid sns topic arn`},
+			},
+		},
+		{
+			name: "Fail when the visibility timeout is shorter than the seconds sqs counts it in",
+			modify: func(cfg *Config) {
+				cfg.WorkflowManagerConfig.VisibilityTimeout = 500 * time.Millisecond
+			},
+			expectedErrors: []FieldError{
+				{Field: "workflowManager.visibilityTimeout", Message: "must be between 1s and 12h0m0s"},
+			},
+		},
+		{
+			name: "Fail when the bucket names break the s3 rules",
+			modify: func(cfg *Config) {
+				cfg.LandingZoneConfig.S3Bucket = "Landing_Zone"
+				cfg.LoadingZoneConfig.S3Bucket = "192.168.1.1"
+				cfg.StateStoreConfig.Backend = "s3"
+				cfg.StateStoreConfig.S3Bucket = "state..bucket"
+			},
+			expectedErrors: []FieldError{
+				{Field: "landingZone.s3Bucket", Message: `"Landing_Zone" must be 3 to 63 lowercase letters, numbers, dots or hyphens, starting and ending with a letter or number`},
+				{Field: "loadingZone.s3Bucket", Message: `"192.168.1.1" must not be formatted as an ip address`},
+				{Field: "stateStore.s3Bucket", Message: `"state..bucket" must not contain two adjacent dots`},
+			},
+		},
+		{
+			name: "Fail when the aws endpoints, timeouts and web identity are invalid",
+			modify: func(cfg *Config) {
+				retries := -1
+				cfg.AWSConfig.Endpoints.S3 = "localhost:4566"
+				cfg.AWSConfig.Endpoints.SQS = "http://localhost:4566"
+				cfg.AWSConfig.HTTPTimeout = -time.Second
+				cfg.AWSConfig.MaxRetries = &retries
+				cfg.AWSConfig.WebIdentityTokenFile = "/var/run/secrets/token"
+			},
+			expectedErrors: []FieldError{
+				{Field: "aws.endpoints.s3", Message: `"localhost:4566" is not a valid http(s) url`},
+				{Field: "aws.httpTimeout", Message: "must not be negative"},
+				{Field: "aws.maxRetries", Message: "must not be negative"},
+				{Field: "aws.webIdentityRoleArn", Message: "is required when a web identity token file is set"},
+			},
+		},
+		{
+			name: "Fail with every problem at once",
+			modify: func(cfg *Config) {
+				cfg.LandingZoneConfig.S3Bucket = ""
+				cfg.LoadingZoneConfig.OutputPrefix = "/analyst"
+				cfg.AWSConfig.Region = "europe"
+				cfg.AWSConfig.S3Backend = "fs"
+				cfg.AWSConfig.S3LocalRoot = ""
+				cfg.AWSConfig.S3Get.RequestsPerSecond = -1
+				cfg.AWSConfig.S3Put.MaxConcurrency = -1
+				cfg.StateStoreConfig.Backend = "redis"
+				cfg.LoggingConfig.Level = "verbose"
+				cfg.MetricsConfig.Exporter = "prometheus"
+				cfg.TracingConfig.Exporter = "jaeger"
+				cfg.HealthConfig.Enabled = true
+				cfg.HealthConfig.PollMaxAge = -time.Minute
+				cfg.RetryConfig.Default.Jitter = 2
+				cfg.RetryConfig.Operations = map[string]RetryPolicy{"GetObject": {Multiplier: 0.5, MaxAttempts: -1}}
+			},
+			expectedErrors: []FieldError{
+				{Field: "landingZone.s3Bucket", Message: "is required"},
+				{Field: "loadingZone.outputPrefix", Message: `"/analyst" must not start with /`},
+				{Field: "aws.region", Message: `"europe" is not a valid aws region`},
+				{Field: "aws.s3LocalRoot", Message: "is required when the s3 backend is fs"},
+				{Field: "aws.s3Get.requestsPerSecond", Message: "must not be negative"},
+				{Field: "aws.s3Put.maxConcurrency", Message: "must not be negative"},
+				{Field: "stateStore.backend", Message: `"redis" is not one of memory, s3`},
+				{Field: "logging.level", Message: `"verbose" is not one of debug, info, warn, error`},
+				{Field: "metrics.address", Message: "is required when the metrics exporter is prometheus"},
+				{Field: "tracing.exporter", Message: `"jaeger" is not one of none, otlp`},
+				{Field: "health.address", Message: "is required when the health server is enabled"},
+				{Field: "health.pollMaxAge", Message: "must not be negative"},
+				{Field: "retry.default.jitter", Message: "must be between 0 and 1"},
+				{Field: "retry.operations.GetObject.multiplier", Message: "must be at least 1"},
+				{Field: "retry.operations.GetObject.maxAttempts", Message: "must not be negative"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		cfg := validConfig()
+		test.modify(&cfg)
+
+		err := cfg.Validate() //<--- function under test
+
+		if test.expectedErrors == nil {
+			assert.Nil(t, err)
+		} else {
+			assert.Equal(t, &ValidationError{Errors: test.expectedErrors}, err)
+		}
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	fmt.Println("name: Success when listing every problem in the message")
+
+	err := &ValidationError{Errors: []FieldError{
+		{Field: "aws.region", Message: "is required"},
+		{Field: "workflowManager.sqsURL", Message: "is required when the workflow manager is enabled"},
+	}}
+
+	message := err.Error() //<--- function under test
+
+	assert.Equal(t, "invalid config, 2 problem(s):\n  - aws.region: is required\n  - workflowManager.sqsURL: is required when the workflow manager is enabled", message)
+}
@@ -1,8 +1,61 @@
 package constants
 
+import "time"
+
 /*
  *	Generic types
  */
 const EmptyString = ""
 const AnalystOriginType = "Analyst"
 const AnalystETLOriginType = "Analyst-ETL"
+const TaskFailureErrorCode = "ETLFailure"
+
+/*
+ *	Workflow manager
+ */
+const DefaultVisibilityTimeout = 2 * time.Minute
+const MaxVisibilityTimeout = 12 * time.Hour
+
+/*
+ *	Loading zone
+ */
+const ManifestFileName = "_manifest.json"
+const SuccessFileName = "_SUCCESS"
+const DefaultStagingPrefix = "_staging"
+
+// RejectsDirectory holds the records rejected from every input file, next to the outputs of the job
+const RejectsDirectory = "_rejects"
+
+/*
+ *	State store backends
+ */
+const MemoryStateStore = "memory"
+const S3StateStore = "s3"
+
+/*
+ *	S3 backends
+ */
+const AWSS3Backend = "aws"
+const LocalS3Backend = "fs"
+
+/*
+ *	Metrics exporters
+ */
+const NoMetricsExporter = "none"
+const PrometheusMetricsExporter = "prometheus"
+const EMFMetricsExporter = "emf"
+const DefaultMetricsNamespace = "etl"
+const DefaultMetricsFlushInterval = time.Minute
+
+/*
+ *	Tracing exporters
+ */
+const NoTracingExporter = "none"
+const OTLPTracingExporter = "otlp"
+const DefaultTracingServiceName = "etl-base"
+const TracingShutdownTimeout = 5 * time.Second
+
+/*
+ *	Health
+ */
+const DefaultHealthPollMaxAge = time.Minute
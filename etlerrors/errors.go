@@ -0,0 +1,144 @@
+// Package etlerrors classifies the errors of the aws clients and the runtime. Every error is wrapped in an *Error
+// with the kind of the failure, so errors.Is matches the kind and errors.As still reaches the original error
+package etlerrors
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"net"
+	"net/http"
+)
+
+// Kinds of the failures, ErrThrottled and ErrTransient are retryable, the others are permanent
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrThrottled    = errors.New("throttled")
+	ErrAccessDenied = errors.New("access denied")
+	ErrInvalidEvent = errors.New("invalid event")
+	ErrTransient    = errors.New("transient failure")
+)
+
+// Error is a failure of the kind Kind, Msg describes what failed and Err is the original error. A nil Kind is a
+// failure that could not be classified, it is permanent
+type Error struct {
+	Kind error
+	Msg  string
+	Err  error
+}
+
+func (err *Error) Error() string {
+	switch {
+	case err.Err == nil:
+		return err.Msg
+	case err.Msg == "":
+		return err.Err.Error()
+	default:
+		return err.Msg + ", error: " + err.Err.Error()
+	}
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Is matches the kind of the error, the original one is matched through Unwrap
+func (err *Error) Is(target error) bool {
+	return err.Kind != nil && err.Kind == target
+}
+
+// New returns an error of the given kind, cause can be nil
+func New(kind error, msg string, cause error) error {
+	return &Error{Kind: kind, Msg: msg, Err: cause}
+}
+
+// Wrap describes err with msg, keeping the kind of err or classifying it when it is an aws or a network error. A nil
+// err stays nil
+func Wrap(msg string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: Kind(err), Msg: msg, Err: err}
+}
+
+// Kind returns the kind of err, nil when it is unknown
+func Kind(err error) error {
+	var etlErr *Error
+	if errors.As(err, &etlErr) {
+		return etlErr.Kind
+	}
+	return classify(err)
+}
+
+// Retryable reports whether err is worth retrying, it is throttled or transient
+func Retryable(err error) bool {
+	kind := Kind(err)
+	return kind == ErrThrottled || kind == ErrTransient
+}
+
+var notFoundCodes = map[string]bool{
+	s3.ErrCodeNoSuchKey:          true,
+	s3.ErrCodeNoSuchBucket:       true,
+	"NotFound":                   true,
+	sqs.ErrCodeQueueDoesNotExist: true,
+	sfn.ErrCodeTaskDoesNotExist:  true,
+	"ResourceNotFoundException":  true,
+	"ParameterNotFound":          true,
+}
+
+var accessDeniedCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AccessDeniedException": true,
+	"UnauthorizedOperation": true,
+	"InvalidClientTokenId":  true,
+	"SignatureDoesNotMatch": true,
+	"ExpiredToken":          true,
+	"ExpiredTokenException": true,
+}
+
+var throttledCodes = map[string]bool{
+	"SlowDown":           true,
+	sqs.ErrCodeOverLimit: true,
+}
+
+func classify(err error) error {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		code := awsErr.Code()
+		switch {
+		case notFoundCodes[code]:
+			return ErrNotFound
+		case accessDeniedCodes[code]:
+			return ErrAccessDenied
+		case throttledCodes[code] || request.IsErrorThrottle(awsErr):
+			return ErrThrottled
+		}
+
+		var requestErr awserr.RequestFailure
+		if errors.As(err, &requestErr) {
+			switch status := requestErr.StatusCode(); {
+			case status == http.StatusTooManyRequests:
+				return ErrThrottled
+			case status >= http.StatusInternalServerError:
+				return ErrTransient
+			case status == http.StatusNotFound:
+				return ErrNotFound
+			case status == http.StatusForbidden:
+				return ErrAccessDenied
+			}
+		}
+		if request.IsErrorRetryable(awsErr) {
+			return ErrTransient
+		}
+		return nil
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrTransient
+	}
+	return nil
+}
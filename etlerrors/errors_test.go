@@ -0,0 +1,95 @@
+package etlerrors
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name              string
+		err               error
+		expectedKind      error
+		expectedRetryable bool
+	}{
+		{
+			name:         "Success when a missing s3 key is not found",
+			err:          awserr.New(s3.ErrCodeNoSuchKey, "the key does not exist", nil),
+			expectedKind: ErrNotFound,
+		},
+		{
+			name:              "Success when a slow down of s3 is throttled",
+			err:               awserr.NewRequestFailure(awserr.New("SlowDown", "reduce your request rate", nil), 503, "request-1"),
+			expectedKind:      ErrThrottled,
+			expectedRetryable: true,
+		},
+		{
+			name:              "Success when a throttling code of the sdk is throttled",
+			err:               awserr.New("ThrottlingException", "rate exceeded", nil),
+			expectedKind:      ErrThrottled,
+			expectedRetryable: true,
+		},
+		{
+			name:         "Success when a forbidden request is denied",
+			err:          awserr.NewRequestFailure(awserr.New("AccessDenied", "access denied", nil), 403, "request-2"),
+			expectedKind: ErrAccessDenied,
+		},
+		{
+			name:              "Success when a server error is transient",
+			err:               awserr.NewRequestFailure(awserr.New("InternalError", "we encountered an internal error", nil), 500, "request-3"),
+			expectedKind:      ErrTransient,
+			expectedRetryable: true,
+		},
+		{
+			name:              "Success when a failed connection is transient",
+			err:               awserr.New("RequestError", "send request failed", &net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+			expectedKind:      ErrTransient,
+			expectedRetryable: true,
+		},
+		{
+			name:         "Success when an invalid event keeps its kind",
+			err:          New(ErrInvalidEvent, "failed to parse the event", errors.New("unexpected end of JSON input")),
+			expectedKind: ErrInvalidEvent,
+		},
+		{
+			name: "Success when an unknown error is permanent",
+			err:  errors.New("some transform error"),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		err := Wrap("failed to read the object", test.err) //<--- function under test
+
+		assert.Equal(t, "failed to read the object, error: "+test.err.Error(), err.Error())
+		assert.Equal(t, test.expectedKind, Kind(err))
+		assert.Equal(t, test.expectedRetryable, Retryable(err))
+		assert.True(t, errors.Is(err, test.err))
+		if test.expectedKind != nil {
+			assert.True(t, errors.Is(err, test.expectedKind))
+		}
+	}
+
+	fmt.Println("name: Success when a nil error stays nil")
+	assert.Nil(t, Wrap("failed to read the object", nil)) //<--- function under test
+}
+
+func TestWrapReachesTheOriginalError(t *testing.T) {
+	fmt.Println("name: Success when errors.As reaches the aws error under the wrapped ones")
+
+	cause := awserr.New(s3.ErrCodeNoSuchKey, "the key does not exist", nil)
+
+	err := Wrap("failed to read the input file", Wrap("failed to read the object", cause)) //<--- function under test
+
+	var awsErr awserr.Error
+	assert.True(t, errors.As(err, &awsErr))
+	assert.Equal(t, s3.ErrCodeNoSuchKey, awsErr.Code())
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrTransient))
+}
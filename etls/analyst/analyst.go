@@ -0,0 +1,51 @@
+// Package analyst registers the Analyst ETL, which loads the tree elements exported by Analyst. Import it for its
+// side effect in the binaries hosting the ETL
+package analyst
+
+import (
+	"github.com/anhamdan/etl-base/config"
+	"github.com/anhamdan/etl-base/config/settings"
+	"github.com/anhamdan/etl-base/helpers"
+	"github.com/anhamdan/etl-base/model"
+)
+
+// Name is the type of the ETL, it matches the data source of the manager events
+const Name = "analyst"
+
+var defaultConfig = config.Config{
+	LandingZoneConfig: settings.LandingZoneConfig{
+		S3Bucket: "landing-zone-poc",
+	},
+	LoadingZoneConfig: settings.LoadingZoneConfig{
+		S3Bucket:        "enlight-loading-zone-poc",
+		LZHelperEnabled: true,
+		StagingPrefix:   "_staging",
+	},
+	WorkflowManagerConfig: settings.WorkflowManagerConfig{
+		// todo this needs to be changed when we get notified of the real sqs queue
+		SQSURL: "",
+		// todo this needs to be changed when we send event to the real topic
+		TopicARN:               "",
+		GroupID:                "123",
+		WorkFlowManagerEnabled: true,
+	},
+	AWSConfig: config.AWSConfig{
+		Profile:     "default",
+		Region:      "eu-west-1",
+		S3Backend:   "aws",
+		S3LocalRoot: "local-s3",
+	},
+	StateStoreConfig: config.StateStoreConfig{
+		Backend:  "memory",
+		S3Bucket: "enlight-loading-zone-poc",
+		Prefix:   "_state",
+	},
+}
+
+func init() {
+	helpers.RegisterEtl(helpers.Etl{
+		Name:   Name,
+		Config: defaultConfig,
+		Model:  model.TreeElem{},
+	})
+}
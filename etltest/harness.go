@@ -0,0 +1,300 @@
+package etltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/anhamdan/etl-base/helpers"
+	"github.com/anhamdan/etl-base/s3aws"
+	"github.com/anhamdan/etl-base/sfnaws"
+	"github.com/anhamdan/etl-base/sqsaws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	defaultLandingZoneBucket = "landing-zone"
+	defaultLoadingZoneBucket = "loading-zone"
+	harnessQueueURL          = "https://sqs.local/etltest"
+	outputEventGoldenFile    = "output_event.json"
+	loadingZoneGoldenDir     = "loading-zone"
+	receiveAttempts          = 5
+)
+
+// UpdateGoldenEnv is the environment variable that makes AssertGolden rewrite the golden files instead of comparing
+// them, like ETLTEST_UPDATE=true go test ./...
+const UpdateGoldenEnv = "ETLTEST_UPDATE"
+
+// Harness runs a ManagerEvent through an ETL like the workflow manager would: the event is sent to a queue,
+// received and parsed, every input file is read from the landing zone, transformed and written to the loading
+// zone, and the output event is sent to the step function. Everything runs against fakes
+type Harness struct {
+	// Transform defaults to the ETL registered for the data source of the event
+	Transform helpers.TransformFunc
+	// InputDir holds the landing zone fixtures, every file is uploaded with its relative path as key
+	InputDir string
+	// EventFile is a plain ManagerEvent json. When it has no input files, all the fixtures are used
+	EventFile         string
+	LandingZoneBucket string
+	LoadingZoneBucket string
+	// S3 defaults to a FakeS3, use s3aws.NewFSSvcClient to run against the local filesystem
+	S3 s3aws.SvcClient
+}
+
+type Result struct {
+	Event       *helpers.ManagerEvent
+	OutputEvent *helpers.ManagerOutputEvent
+	// Err is the error returned while handling the event, if any
+	Err error
+	// Files are the objects of the loading zone bucket by key
+	Files map[string][]byte
+	S3    s3aws.SvcClient
+	SQS   *FakeSQS
+	SFN   *FakeSFN
+}
+
+func (harness Harness) Run(t testing.TB) *Result {
+	t.Helper()
+
+	landingBucket := valueOrDefault(harness.LandingZoneBucket, defaultLandingZoneBucket)
+	loadingBucket := valueOrDefault(harness.LoadingZoneBucket, defaultLoadingZoneBucket)
+	svc := harness.S3
+	if svc == nil {
+		svc = NewFakeS3()
+	}
+	result := &Result{S3: svc, SQS: NewFakeSQS(time.Minute), SFN: NewFakeSFN()}
+
+	inputFiles := uploadFixtures(t, s3aws.NewS3Client(svc, landingBucket), harness.InputDir, landingBucket)
+	result.SQS.SendMessage(harnessQueueURL, wrapEvent(t, harness.EventFile, inputFiles), nil)
+
+	wfmHelper := helpers.NewWFMHelper(
+		sqsaws.New(result.SQS, harnessQueueURL),
+		sfnaws.NewWithSvc(result.SFN),
+		helpers.WorkflowManagerConfig{WorkFlowManagerEnabled: true, SQSURL: harnessQueueURL},
+	)
+
+	event, err := wfmHelper.GetEvent(receive(t, result.SQS))
+	if err != nil {
+		t.Fatalf("could not parse the event: %s", err.Error())
+	}
+	result.Event = event
+
+	landingZone := helpers.NewLandingZoneHelper(s3aws.NewS3Client(svc, landingBucket))
+	loadingZone := helpers.NewLoadingZoneHelper(s3aws.NewS3Client(svc, loadingBucket), helpers.LoadingZoneConfig{
+		S3Bucket:        loadingBucket,
+		LZHelperEnabled: true,
+	})
+	runtime := helpers.NewEtlRuntime(nil, landingZone, loadingZone, wfmHelper, harness.Transform)
+
+	result.Err = runtime.HandleEvent(event)
+
+	if successes := result.SFN.Successes(); len(successes) > 0 {
+		var outputEvent helpers.ManagerOutputEvent
+		if err := json.Unmarshal([]byte(successes[len(successes)-1].Output), &outputEvent); err != nil {
+			t.Fatalf("could not parse the output event: %s", err.Error())
+		}
+		result.OutputEvent = &outputEvent
+	}
+
+	result.Files = readBucket(t, s3aws.NewS3Client(svc, loadingBucket), loadingBucket)
+	return result
+}
+
+// AssertGolden compares the loading zone files and the output event with the ones in goldenDir. The manifest and
+// the durations change on every run, so they are left out. Run the tests with ETLTEST_UPDATE=true to rewrite them
+func (result *Result) AssertGolden(t testing.TB, goldenDir string) {
+	t.Helper()
+
+	actual := map[string][]byte{}
+	for key, content := range result.Files {
+		if filepath.Base(key) == "_manifest.json" {
+			continue
+		}
+		actual[filepath.Join(loadingZoneGoldenDir, filepath.FromSlash(key))] = content
+	}
+	actual[outputEventGoldenFile] = normalizeOutputEvent(t, result.OutputEvent)
+
+	if updateGolden() {
+		if err := os.RemoveAll(goldenDir); err != nil {
+			t.Fatalf("could not clean the golden files: %s", err.Error())
+		}
+		for name, content := range actual {
+			goldenPath := filepath.Join(goldenDir, name)
+			if err := os.MkdirAll(filepath.Dir(goldenPath), 0755); err != nil {
+				t.Fatalf("could not write the golden file %s: %s", goldenPath, err.Error())
+			}
+			if err := ioutil.WriteFile(goldenPath, content, 0644); err != nil {
+				t.Fatalf("could not write the golden file %s: %s", goldenPath, err.Error())
+			}
+		}
+		return
+	}
+
+	expected := readDir(t, goldenDir)
+	if !reflect.DeepEqual(sortedKeys(expected), sortedKeys(actual)) {
+		t.Errorf("the produced files do not match the golden files\nexpected: %v\nactual  : %v", sortedKeys(expected), sortedKeys(actual))
+	}
+	for name, content := range expected {
+		if actualContent, ok := actual[name]; ok && string(content) != string(actualContent) {
+			t.Errorf("the content of %s does not match its golden file\nexpected: %s\nactual  : %s", name, content, actualContent)
+		}
+	}
+}
+
+// updateGolden reads UpdateGoldenEnv when the golden files are asserted, the harness registers no flag so it can be
+// imported by any binary
+func updateGolden() bool {
+	update, _ := strconv.ParseBool(os.Getenv(UpdateGoldenEnv))
+	return update
+}
+
+func uploadFixtures(t testing.TB, s3Client s3aws.S3Client, inputDir, bucket string) []string {
+	t.Helper()
+
+	fixtures := readDir(t, inputDir)
+	inputFiles := []string{}
+	for _, name := range sortedKeys(fixtures) {
+		key := filepath.ToSlash(name)
+		if _, err := s3Client.Insert(key, fixtures[name]); err != nil {
+			t.Fatalf("could not upload the fixture %s: %s", name, err.Error())
+		}
+		inputFiles = append(inputFiles, fmt.Sprintf("s3://%s/%s", bucket, key))
+	}
+	return inputFiles
+}
+
+// wrapEvent builds the sqs body the workflow manager sends through sns
+func wrapEvent(t testing.TB, eventFile string, inputFiles []string) string {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(eventFile)
+	if err != nil {
+		t.Fatalf("could not read the event file: %s", err.Error())
+	}
+
+	var event helpers.ManagerEvent
+	if err := json.Unmarshal(content, &event); err != nil {
+		t.Fatalf("could not parse the event file: %s", err.Error())
+	}
+	if len(event.InputFiles) == 0 {
+		event.InputFiles = inputFiles
+	}
+
+	message, _ := json.Marshal(event)
+	body, _ := json.Marshal(map[string]interface{}{
+		"Type":      "Notification",
+		"MessageId": "etltest",
+		"Message":   string(message),
+		"Timestamp": time.Now().UTC(),
+	})
+	return string(body)
+}
+
+// receive polls the queue like the workflow manager helper does, without its endless loop
+func receive(t testing.TB, fake *FakeSQS) chan *sqs.Message {
+	t.Helper()
+
+	sqsClient := sqsaws.New(fake, harnessQueueURL)
+	chn := make(chan *sqs.Message, 1)
+	for attempt := 0; attempt < receiveAttempts; attempt++ {
+		messages, err := sqsClient.Receive()
+		if err != nil {
+			t.Fatalf("could not receive the event: %s", err.Error())
+		}
+		if len(messages) > 0 {
+			chn <- messages[0]
+			return chn
+		}
+	}
+	t.Fatalf("the event was not received")
+	return nil
+}
+
+func readBucket(t testing.TB, s3Client s3aws.S3Client, bucket string) map[string][]byte {
+	t.Helper()
+
+	keys, err := s3Client.ListObjects("")
+	if err != nil {
+		t.Fatalf("could not list the loading zone: %s", err.Error())
+	}
+
+	files := map[string][]byte{}
+	for _, key := range *keys {
+		content, err := s3Client.Read(bucket, *key)
+		if err != nil {
+			t.Fatalf("could not read %s from the loading zone: %s", *key, err.Error())
+		}
+		files[*key] = content
+	}
+	return files
+}
+
+func readDir(t testing.TB, dir string) map[string][]byte {
+	t.Helper()
+
+	files := map[string][]byte{}
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relative, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		files[relative], err = ioutil.ReadFile(filePath)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("could not read %s: %s", dir, err.Error())
+	}
+	return files
+}
+
+// normalizeOutputEvent clears the durations so the output event can be compared between runs
+func normalizeOutputEvent(t testing.TB, outputEvent *helpers.ManagerOutputEvent) []byte {
+	t.Helper()
+
+	if outputEvent == nil {
+		return []byte("null\n")
+	}
+
+	normalized := *outputEvent
+	normalized.DurationMs = 0
+	normalized.InputStats = append([]helpers.InputFileStats{}, outputEvent.InputStats...)
+	for i := range normalized.InputStats {
+		normalized.InputStats[i].ReadDurationMs = 0
+		normalized.InputStats[i].TransformDurationMs = 0
+	}
+	normalized.OutputStats = append([]helpers.OutputFileStats{}, outputEvent.OutputStats...)
+	for i := range normalized.OutputStats {
+		normalized.OutputStats[i].WriteDurationMs = 0
+	}
+
+	content, err := json.MarshalIndent(normalized, "", "  ")
+	if err != nil {
+		t.Fatalf("could not marshal the output event: %s", err.Error())
+	}
+	return append(content, '\n')
+}
+
+func sortedKeys(files map[string][]byte) []string {
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,87 @@
+package etltest
+
+import (
+	"errors"
+	"fmt"
+	_ "github.com/anhamdan/etl-base/etls/analyst"
+	"github.com/anhamdan/etl-base/helpers"
+	"github.com/anhamdan/etl-base/s3aws"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHarness(t *testing.T) {
+	tests := []struct {
+		name string
+		s3   s3aws.SvcClient
+	}{
+		{
+			name: "Success when running an event through the registered analyst etl and the in-memory fakes",
+		},
+		{
+			name: "Success when running an event through the local filesystem",
+			s3:   s3aws.NewFSSvcClient(t.TempDir()),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		harness := Harness{
+			InputDir:  "testdata/analyst/input",
+			EventFile: "testdata/analyst/event.json",
+			S3:        test.s3,
+		}
+
+		result := harness.Run(t) //<--- function under test
+
+		assert.Nil(t, result.Err)
+		assert.Equal(t, []string{"s3://landing-zone/analyst/tree_elem.json"}, result.Event.InputFiles)
+		assert.Equal(t, "task-token", result.SFN.Successes()[0].TaskToken)
+		assert.Contains(t, result.Files, "456/_SUCCESS")
+		assert.Equal(t, 1, len(result.SQS.Deleted(harnessQueueURL)))
+		result.AssertGolden(t, "testdata/analyst/golden")
+	}
+}
+
+func TestHarnessFailure(t *testing.T) {
+	fmt.Println("name: Fail when the transform fails, nothing is written to the loading zone and the task is failed")
+
+	harness := Harness{
+		Transform: func(input *helpers.TransformInput) (interface{}, error) {
+			return nil, errors.New("some transform error")
+		},
+		InputDir:  "testdata/analyst/input",
+		EventFile: "testdata/analyst/event.json",
+	}
+
+	result := harness.Run(t) //<--- function under test
+
+	assert.Equal(t, errors.New("some transform error"), result.Err)
+	assert.Nil(t, result.OutputEvent)
+	assert.Empty(t, result.SFN.Successes())
+	assert.Empty(t, result.Files)
+	if assert.Equal(t, 1, len(result.SFN.Failures())) {
+		assert.Equal(t, "some transform error", result.SFN.Failures()[0].Cause)
+	}
+	assert.Equal(t, 1, len(result.SQS.Deleted(harnessQueueURL)))
+}
+
+func TestAssertGoldenUpdate(t *testing.T) {
+	fmt.Println("name: Success when the golden files are rewritten with the environment variable, then match")
+
+	harness := Harness{
+		InputDir:  "testdata/analyst/input",
+		EventFile: "testdata/analyst/event.json",
+	}
+	result := harness.Run(t)
+	goldenDir := t.TempDir()
+
+	t.Setenv(UpdateGoldenEnv, "true")
+	result.AssertGolden(t, goldenDir) //<--- function under test
+
+	assert.Equal(t, sortedKeys(readDir(t, "testdata/analyst/golden")), sortedKeys(readDir(t, goldenDir)))
+
+	t.Setenv(UpdateGoldenEnv, "")
+	result.AssertGolden(t, goldenDir) //<--- function under test
+}
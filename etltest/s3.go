@@ -0,0 +1,274 @@
+package etltest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeS3 is a stateful in-memory implementation of s3aws.SvcClient. Buckets are created on the first write
+type FakeS3 struct {
+	buckets map[string]map[string]*Object
+	calls   []S3Call
+	errors  map[string]error
+	mutex   sync.Mutex
+}
+
+type Object struct {
+	Content      []byte
+	ContentType  string
+	Metadata     map[string]string
+	ETag         string
+	LastModified time.Time
+}
+
+// S3Call is a request received by the fake, Key is the destination key for copies
+type S3Call struct {
+	Operation string
+	Bucket    string
+	Key       string
+}
+
+func NewFakeS3() *FakeS3 {
+	return &FakeS3{buckets: map[string]map[string]*Object{}, errors: map[string]error{}}
+}
+
+// PutContent stores an object directly, without recording a call
+func (fake *FakeS3) PutContent(bucket, key string, content []byte, metadata map[string]string) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.put(bucket, key, content, "", metadata)
+}
+
+// Object returns a copy of the stored object
+func (fake *FakeS3) Object(bucket, key string) (Object, bool) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	object, ok := fake.buckets[bucket][key]
+	if !ok {
+		return Object{}, false
+	}
+	return copyObject(object), true
+}
+
+// Keys returns the sorted keys of the bucket starting with prefix
+func (fake *FakeS3) Keys(bucket, prefix string) []string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return fake.keys(bucket, prefix)
+}
+
+func (fake *FakeS3) Calls() []S3Call {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return append([]S3Call{}, fake.calls...)
+}
+
+// SetError makes every following call of the operation, like "GetObject", fail with err until it is set to nil
+func (fake *FakeS3) SetError(operation string, err error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.errors[operation] = err
+}
+
+func (fake *FakeS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	bucket, key := aws.StringValue(input.Bucket), aws.StringValue(input.Key)
+	if err := fake.record("GetObject", bucket, key); err != nil {
+		return nil, err
+	}
+
+	object, ok := fake.buckets[bucket][key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, fmt.Sprintf("the key %s does not exist", key), nil)
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          ioutil.NopCloser(bytes.NewReader(object.Content)),
+		ContentLength: aws.Int64(int64(len(object.Content))),
+		ContentType:   aws.String(object.ContentType),
+		ETag:          aws.String(object.ETag),
+		LastModified:  aws.Time(object.LastModified),
+		Metadata:      aws.StringMap(object.Metadata),
+	}, nil
+}
+
+func (fake *FakeS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	bucket, key := aws.StringValue(input.Bucket), aws.StringValue(input.Key)
+	if err := fake.record("PutObject", bucket, key); err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	if input.Body != nil {
+		var err error
+		if content, err = ioutil.ReadAll(input.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	object := fake.put(bucket, key, content, aws.StringValue(input.ContentType), aws.StringValueMap(input.Metadata))
+	return &s3.PutObjectOutput{ETag: aws.String(object.ETag)}, nil
+}
+
+func (fake *FakeS3) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	bucket := aws.StringValue(input.Bucket)
+	if err := fake.record("ListObjects", bucket, aws.StringValue(input.Prefix)); err != nil {
+		return nil, err
+	}
+
+	marker := aws.StringValue(input.Marker)
+	keys := []string{}
+	for _, key := range fake.keys(bucket, aws.StringValue(input.Prefix)) {
+		if key > marker {
+			keys = append(keys, key)
+		}
+	}
+
+	maxKeys := int(aws.Int64Value(input.MaxKeys))
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	truncated := len(keys) > maxKeys
+	if truncated {
+		keys = keys[:maxKeys]
+	}
+
+	contents := make([]*s3.Object, len(keys))
+	for i, key := range keys {
+		object := fake.buckets[bucket][key]
+		contents[i] = &s3.Object{
+			Key:          aws.String(key),
+			ETag:         aws.String(object.ETag),
+			Size:         aws.Int64(int64(len(object.Content))),
+			LastModified: aws.Time(object.LastModified),
+		}
+	}
+
+	return &s3.ListObjectsOutput{
+		Name:        input.Bucket,
+		Prefix:      input.Prefix,
+		Marker:      input.Marker,
+		Contents:    contents,
+		IsTruncated: aws.Bool(truncated),
+	}, nil
+}
+
+func (fake *FakeS3) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	bucket, key := aws.StringValue(input.Bucket), aws.StringValue(input.Key)
+	if err := fake.record("CopyObject", bucket, key); err != nil {
+		return nil, err
+	}
+
+	source, err := url.PathUnescape(aws.StringValue(input.CopySource))
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	if len(parts) != 2 {
+		return nil, awserr.New("InvalidArgument", fmt.Sprintf("invalid copy source: %s", source), nil)
+	}
+
+	object, ok := fake.buckets[parts[0]][parts[1]]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, fmt.Sprintf("the key %s does not exist", parts[1]), nil)
+	}
+
+	metadata := object.Metadata
+	if aws.StringValue(input.MetadataDirective) == s3.MetadataDirectiveReplace {
+		metadata = aws.StringValueMap(input.Metadata)
+	}
+	copied := fake.put(bucket, key, object.Content, object.ContentType, metadata)
+
+	return &s3.CopyObjectOutput{CopyObjectResult: &s3.CopyObjectResult{
+		ETag:         aws.String(copied.ETag),
+		LastModified: aws.Time(copied.LastModified),
+	}}, nil
+}
+
+func (fake *FakeS3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	bucket, key := aws.StringValue(input.Bucket), aws.StringValue(input.Key)
+	if err := fake.record("DeleteObject", bucket, key); err != nil {
+		return nil, err
+	}
+
+	delete(fake.buckets[bucket], key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (fake *FakeS3) record(operation, bucket, key string) error {
+	fake.calls = append(fake.calls, S3Call{Operation: operation, Bucket: bucket, Key: key})
+	return fake.errors[operation]
+}
+
+func (fake *FakeS3) put(bucket, key string, content []byte, contentType string, metadata map[string]string) *Object {
+	if _, ok := fake.buckets[bucket]; !ok {
+		fake.buckets[bucket] = map[string]*Object{}
+	}
+
+	sum := md5.Sum(content)
+	object := &Object{
+		Content:      append([]byte{}, content...),
+		ContentType:  contentType,
+		Metadata:     copyMetadata(metadata),
+		ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		LastModified: time.Now().UTC(),
+	}
+	fake.buckets[bucket][key] = object
+	return object
+}
+
+func (fake *FakeS3) keys(bucket, prefix string) []string {
+	keys := []string{}
+	for key := range fake.buckets[bucket] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func copyObject(object *Object) Object {
+	copied := *object
+	copied.Content = append([]byte{}, object.Content...)
+	copied.Metadata = copyMetadata(object.Metadata)
+	return copied
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	copied := map[string]string{}
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,82 @@
+package etltest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/s3aws"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+var _ s3aws.SvcClient = (*FakeS3)(nil)
+
+func TestFakeS3(t *testing.T) {
+	fmt.Println("name: Success when using the fake through the s3 client")
+
+	fake := NewFakeS3()
+	s3Client := s3aws.NewS3Client(fake, "loading")
+
+	_, err := s3Client.Insert("staging/a.json", []byte(`[1]`))
+	assert.Nil(t, err)
+	_, err = s3Client.Copy("staging/a.json", "final/a.json")
+	assert.Nil(t, err)
+	assert.Nil(t, s3Client.Delete("staging/a.json"))
+
+	content, err := s3Client.Read("loading", "final/a.json")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`[1]`), content)
+	assert.Equal(t, []string{"final/a.json"}, fake.Keys("loading", ""))
+
+	_, err = s3Client.Read("loading", "staging/a.json")
+	assert.True(t, s3aws.IsNotFound(err))
+
+	operations := []string{}
+	for _, call := range fake.Calls() {
+		operations = append(operations, call.Operation)
+	}
+	assert.Equal(t, []string{"PutObject", "CopyObject", "DeleteObject", "GetObject", "GetObject"}, operations)
+}
+
+func TestFakeS3Metadata(t *testing.T) {
+	fmt.Println("name: Success when storing objects with metadata")
+
+	fake := NewFakeS3()
+
+	_, err := fake.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String("loading"),
+		Key:         aws.String("a.json"),
+		Body:        strings.NewReader(`[1]`),
+		ContentType: aws.String("application/json"),
+		Metadata:    map[string]*string{"import-job-id": aws.String("456")},
+	})
+	assert.Nil(t, err)
+
+	output, err := fake.GetObject(&s3.GetObjectInput{Bucket: aws.String("loading"), Key: aws.String("a.json")})
+	assert.Nil(t, err)
+	assert.Equal(t, "application/json", aws.StringValue(output.ContentType))
+	assert.Equal(t, "456", aws.StringValue(output.Metadata["import-job-id"]))
+
+	object, ok := fake.Object("loading", "a.json")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"import-job-id": "456"}, object.Metadata)
+	assert.NotEmpty(t, object.ETag)
+}
+
+func TestFakeS3Errors(t *testing.T) {
+	fmt.Println("name: Fail when an error is set on the operation")
+
+	fake := NewFakeS3()
+	fake.PutContent("landing", "a.json", []byte(`[1]`), nil)
+	someErr := errors.New("some s3 error")
+	fake.SetError("GetObject", someErr)
+
+	_, err := s3aws.NewS3Client(fake, "landing").Read("landing", "a.json")
+	assert.True(t, errors.Is(err, someErr))
+
+	fake.SetError("GetObject", nil)
+	_, err = s3aws.NewS3Client(fake, "landing").Read("landing", "a.json")
+	assert.Nil(t, err)
+}
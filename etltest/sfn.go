@@ -0,0 +1,84 @@
+package etltest
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"sync"
+)
+
+// FakeSFN is an in-memory implementation of sfnaws.SFNMessageClient that records every task result it receives.
+// Use it with sfnaws.NewWithSvc to skip assuming the role of the event
+type FakeSFN struct {
+	successes []TaskSuccess
+	failures  []TaskFailure
+	errors    map[string]error
+	mutex     sync.Mutex
+}
+
+type TaskSuccess struct {
+	TaskToken string
+	Output    string
+}
+
+type TaskFailure struct {
+	TaskToken string
+	Error     string
+	Cause     string
+}
+
+func NewFakeSFN() *FakeSFN {
+	return &FakeSFN{errors: map[string]error{}}
+}
+
+func (fake *FakeSFN) Successes() []TaskSuccess {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return append([]TaskSuccess{}, fake.successes...)
+}
+
+func (fake *FakeSFN) Failures() []TaskFailure {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return append([]TaskFailure{}, fake.failures...)
+}
+
+// SetError makes every following call of the operation, like "SendTaskSuccess", fail with err until it is set to nil
+func (fake *FakeSFN) SetError(operation string, err error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.errors[operation] = err
+}
+
+func (fake *FakeSFN) SendTaskSuccess(input *sfn.SendTaskSuccessInput) (*sfn.SendTaskSuccessOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if err := fake.errors["SendTaskSuccess"]; err != nil {
+		return nil, err
+	}
+
+	fake.successes = append(fake.successes, TaskSuccess{
+		TaskToken: aws.StringValue(input.TaskToken),
+		Output:    aws.StringValue(input.Output),
+	})
+	return &sfn.SendTaskSuccessOutput{}, nil
+}
+
+func (fake *FakeSFN) SendTaskFailure(input *sfn.SendTaskFailureInput) (*sfn.SendTaskFailureOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if err := fake.errors["SendTaskFailure"]; err != nil {
+		return nil, err
+	}
+
+	fake.failures = append(fake.failures, TaskFailure{
+		TaskToken: aws.StringValue(input.TaskToken),
+		Error:     aws.StringValue(input.Error),
+		Cause:     aws.StringValue(input.Cause),
+	})
+	return &sfn.SendTaskFailureOutput{}, nil
+}
@@ -0,0 +1,38 @@
+package etltest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/sfnaws"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var _ sfnaws.SFNMessageClient = (*FakeSFN)(nil)
+
+func TestFakeSFN(t *testing.T) {
+	fmt.Println("name: Success when recording task results sent through the sfn client")
+
+	fake := NewFakeSFN()
+	sfnClient := sfnaws.NewWithSvc(fake)
+	svc := sfnClient.CreateSFNClient(nil, "some role")
+
+	assert.Nil(t, sfnClient.SendTaskSuccess(`{"outputFiles":[]}`, "token-1", svc))
+	assert.Nil(t, sfnClient.SendTaskFailure("SomeError", "some cause", "token-2", svc))
+
+	assert.Equal(t, []TaskSuccess{{TaskToken: "token-1", Output: `{"outputFiles":[]}`}}, fake.Successes())
+	assert.Equal(t, []TaskFailure{{TaskToken: "token-2", Error: "SomeError", Cause: "some cause"}}, fake.Failures())
+}
+
+func TestFakeSFNErrors(t *testing.T) {
+	fmt.Println("name: Fail when an error is set on the operation")
+
+	fake := NewFakeSFN()
+	someErr := errors.New("some step function error")
+	fake.SetError("SendTaskSuccess", someErr)
+
+	err := sfnaws.New().SendTaskSuccess("", "token-1", fake)
+
+	assert.True(t, errors.Is(err, someErr))
+	assert.Empty(t, fake.Successes())
+}
@@ -0,0 +1,210 @@
+package etltest
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	maxReceivedMessages = 10
+	longPollInterval    = 10 * time.Millisecond
+)
+
+// FakeSQS is a stateful in-memory implementation of sqsaws.SQSMessageClient. Queues are identified by their url
+// and created on the first message. A received message stays invisible for the visibility timeout, then it is
+// delivered again unless it was deleted
+type FakeSQS struct {
+	queues            map[string]*fakeQueue
+	visibilityTimeout time.Duration
+	errors            map[string]error
+	notify            chan struct{}
+	nextID            int
+	mutex             sync.Mutex
+}
+
+type fakeQueue struct {
+	messages []*fakeMessage
+	deleted  []*sqs.Message
+}
+
+type fakeMessage struct {
+	message        *sqs.Message
+	receiptHandle  string
+	invisibleUntil time.Time
+	receiveCount   int
+}
+
+func NewFakeSQS(visibilityTimeout time.Duration) *FakeSQS {
+	return &FakeSQS{
+		queues:            map[string]*fakeQueue{},
+		visibilityTimeout: visibilityTimeout,
+		errors:            map[string]error{},
+		notify:            make(chan struct{}),
+	}
+}
+
+// SendMessage enqueues the body and returns the id of the new message
+func (fake *FakeSQS) SendMessage(queueURL, body string, attributes map[string]*sqs.MessageAttributeValue) string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.nextID++
+	messageID := fmt.Sprintf("message-%d", fake.nextID)
+	fake.queue(queueURL).messages = append(fake.queue(queueURL).messages, &fakeMessage{
+		message: &sqs.Message{
+			MessageId:         aws.String(messageID),
+			Body:              aws.String(body),
+			MessageAttributes: attributes,
+		},
+	})
+
+	// Wake up the long polling receivers
+	close(fake.notify)
+	fake.notify = make(chan struct{})
+	return messageID
+}
+
+// Pending returns how many messages of the queue were not deleted yet, visible or not
+func (fake *FakeSQS) Pending(queueURL string) int {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return len(fake.queue(queueURL).messages)
+}
+
+// Deleted returns the messages deleted from the queue, in order
+func (fake *FakeSQS) Deleted(queueURL string) []*sqs.Message {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return append([]*sqs.Message{}, fake.queue(queueURL).deleted...)
+}
+
+// SetError makes every following call of the operation, like "ReceiveMessage", fail with err until it is set to nil
+func (fake *FakeSQS) SetError(operation string, err error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.errors[operation] = err
+}
+
+// ReceiveMessage waits up to WaitTimeSeconds for visible messages, like sqs long polling
+func (fake *FakeSQS) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	deadline := time.Now().Add(time.Duration(aws.Int64Value(input.WaitTimeSeconds)) * time.Second)
+
+	for {
+		fake.mutex.Lock()
+		if err := fake.errors["ReceiveMessage"]; err != nil {
+			fake.mutex.Unlock()
+			return nil, err
+		}
+		messages := fake.receive(input)
+		notify := fake.notify
+		fake.mutex.Unlock()
+
+		remaining := time.Until(deadline)
+		if len(messages) > 0 || remaining <= 0 {
+			return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+		}
+
+		// Messages can also become visible again, so the queue is checked on a short interval
+		if remaining > longPollInterval {
+			remaining = longPollInterval
+		}
+		select {
+		case <-notify:
+		case <-time.After(remaining):
+		}
+	}
+}
+
+func (fake *FakeSQS) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if err := fake.errors["DeleteMessage"]; err != nil {
+		return nil, err
+	}
+
+	queue := fake.queue(aws.StringValue(input.QueueUrl))
+	for i, message := range queue.messages {
+		if message.receiptHandle != "" && message.receiptHandle == aws.StringValue(input.ReceiptHandle) {
+			queue.messages = append(queue.messages[:i], queue.messages[i+1:]...)
+			queue.deleted = append(queue.deleted, message.message)
+			return &sqs.DeleteMessageOutput{}, nil
+		}
+	}
+	return nil, awserr.New(sqs.ErrCodeReceiptHandleIsInvalid, "the receipt handle is not valid", nil)
+}
+
+// ChangeMessageVisibility hides the message of the receipt handle for VisibilityTimeout seconds from now, a zero
+// timeout makes it visible at once
+func (fake *FakeSQS) ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if err := fake.errors["ChangeMessageVisibility"]; err != nil {
+		return nil, err
+	}
+
+	for _, message := range fake.queue(aws.StringValue(input.QueueUrl)).messages {
+		if message.receiptHandle != "" && message.receiptHandle == aws.StringValue(input.ReceiptHandle) {
+			message.invisibleUntil = time.Now().Add(time.Duration(aws.Int64Value(input.VisibilityTimeout)) * time.Second)
+			return &sqs.ChangeMessageVisibilityOutput{}, nil
+		}
+	}
+	return nil, awserr.New(sqs.ErrCodeReceiptHandleIsInvalid, "the receipt handle is not valid", nil)
+}
+
+func (fake *FakeSQS) receive(input *sqs.ReceiveMessageInput) []*sqs.Message {
+	maxMessages := int(aws.Int64Value(input.MaxNumberOfMessages))
+	if maxMessages <= 0 {
+		maxMessages = 1
+	}
+	if maxMessages > maxReceivedMessages {
+		maxMessages = maxReceivedMessages
+	}
+
+	visibilityTimeout := fake.visibilityTimeout
+	if input.VisibilityTimeout != nil {
+		visibilityTimeout = time.Duration(aws.Int64Value(input.VisibilityTimeout)) * time.Second
+	}
+
+	now := time.Now()
+	messages := []*sqs.Message{}
+	for _, message := range fake.queue(aws.StringValue(input.QueueUrl)).messages {
+		if len(messages) == maxMessages {
+			break
+		}
+		if now.Before(message.invisibleUntil) {
+			continue
+		}
+
+		fake.nextID++
+		message.receiveCount++
+		message.receiptHandle = fmt.Sprintf("receipt-%d", fake.nextID)
+		message.invisibleUntil = now.Add(visibilityTimeout)
+
+		received := *message.message
+		received.ReceiptHandle = aws.String(message.receiptHandle)
+		received.Attributes = map[string]*string{
+			sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(strconv.Itoa(message.receiveCount)),
+		}
+		messages = append(messages, &received)
+	}
+	return messages
+}
+
+func (fake *FakeSQS) queue(queueURL string) *fakeQueue {
+	queue, ok := fake.queues[queueURL]
+	if !ok {
+		queue = &fakeQueue{}
+		fake.queues[queueURL] = queue
+	}
+	return queue
+}
@@ -0,0 +1,90 @@
+package etltest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/sqsaws"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var _ sqsaws.SQSMessageClient = (*FakeSQS)(nil)
+
+const queueURL = "https://sqs.eu-west-1.amazonaws.com/123456789012/etl"
+
+func TestFakeSQS(t *testing.T) {
+	fmt.Println("name: Success when polling and deleting messages through the sqs client")
+
+	fake := NewFakeSQS(time.Minute)
+	fake.SendMessage(queueURL, "some body", nil)
+
+	channel := make(chan *sqs.Message)
+	errChan := make(chan error, 10)
+	go sqsaws.New(fake, queueURL).Poll(channel, errChan)
+
+	message := <-channel
+	assert.Equal(t, "some body", *message.Body)
+	assert.Equal(t, "1", *message.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount])
+
+	assert.Nil(t, sqsaws.New(fake, queueURL).DeleteMessage(message))
+	assert.Equal(t, 0, fake.Pending(queueURL))
+	assert.Equal(t, "some body", *fake.Deleted(queueURL)[0].Body)
+}
+
+func TestFakeSQSVisibilityTimeout(t *testing.T) {
+	fmt.Println("name: Success when a message that was not deleted is delivered again")
+
+	fake := NewFakeSQS(50 * time.Millisecond)
+	fake.SendMessage(queueURL, "some body", nil)
+	input := &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL)}
+
+	first, err := fake.ReceiveMessage(input)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(first.Messages))
+
+	hidden, err := fake.ReceiveMessage(input)
+	assert.Nil(t, err)
+	assert.Empty(t, hidden.Messages)
+
+	input.WaitTimeSeconds = aws.Int64(1)
+	redelivered, err := fake.ReceiveMessage(input)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(redelivered.Messages))
+	assert.Equal(t, "2", *redelivered.Messages[0].Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount])
+
+	_, err = fake.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: first.Messages[0].ReceiptHandle})
+	assert.NotNil(t, err)
+	_, err = fake.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: redelivered.Messages[0].ReceiptHandle})
+	assert.Nil(t, err)
+}
+
+func TestFakeSQSChangeMessageVisibility(t *testing.T) {
+	fmt.Println("name: Success when a message is made visible again before its visibility timeout")
+
+	fake := NewFakeSQS(time.Minute)
+	fake.SendMessage(queueURL, "some body", nil)
+	input := &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL)}
+	first, err := fake.ReceiveMessage(input)
+	assert.Nil(t, err)
+
+	_, err = fake.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{QueueUrl: aws.String(queueURL), ReceiptHandle: first.Messages[0].ReceiptHandle, VisibilityTimeout: aws.Int64(0)})
+
+	assert.Nil(t, err)
+	redelivered, err := fake.ReceiveMessage(input)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(redelivered.Messages))
+}
+
+func TestFakeSQSErrors(t *testing.T) {
+	fmt.Println("name: Fail when an error is set on the operation")
+
+	fake := NewFakeSQS(time.Minute)
+	fake.SetError("ReceiveMessage", errors.New("some sqs error"))
+
+	_, err := fake.ReceiveMessage(&sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL)})
+
+	assert.Equal(t, errors.New("some sqs error"), err)
+}
@@ -0,0 +1,210 @@
+package health
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Monitor is told about the polls of the queue and the events being processed, the worker is ready while its
+// conditions hold and its last successful poll is recent
+type Monitor interface {
+	PollSucceeded()
+	PollFailed(err error)
+	EventStarted(event Event) (finished func(err error))
+}
+
+// Event identifies an event in the status, with the same ids as its log lines
+type Event struct {
+	ImportJobID string    `json:"importJobID"`
+	ProcessID   string    `json:"processID"`
+	DataSource  string    `json:"dataSource"`
+	MessageID   string    `json:"messageID,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+}
+
+type ErrorStatus struct {
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+	Event   *Event    `json:"event,omitempty"`
+}
+
+type Status struct {
+	Ready           bool              `json:"ready"`
+	Problems        []string          `json:"problems,omitempty"`
+	StartedAt       time.Time         `json:"startedAt"`
+	LastPollAt      *time.Time        `json:"lastPollAt,omitempty"`
+	InFlight        []Event           `json:"inFlight"`
+	EventsProcessed int               `json:"eventsProcessed"`
+	EventsFailed    int               `json:"eventsFailed"`
+	Conditions      map[string]string `json:"conditions,omitempty"`
+	LastError       *ErrorStatus      `json:"lastError,omitempty"`
+}
+
+type monitor struct {
+	pollMaxAge time.Duration
+	now        func() time.Time
+	startedAt  time.Time
+	lastPollAt time.Time
+	// lastEventAt is when the last event in flight finished, the queue is not polled while an event is processed
+	lastEventAt     time.Time
+	conditions      map[string]error
+	inFlight        map[int]Event
+	nextEvent       int
+	eventsProcessed int
+	eventsFailed    int
+	lastError       *ErrorStatus
+	mutex           sync.Mutex
+}
+
+// NewMonitor needs a successful poll in the last pollMaxAge to be ready, a zero pollMaxAge is for workers that do
+// not poll, like the ones reading a local event
+func NewMonitor(pollMaxAge time.Duration) *monitor {
+	return &monitor{
+		pollMaxAge: pollMaxAge,
+		now:        time.Now,
+		startedAt:  time.Now(),
+		conditions: map[string]error{},
+		inFlight:   map[int]Event{},
+	}
+}
+
+// SetCondition records a condition of the readiness, like the config being valid or the aws clients built. A nil
+// err means it holds
+func (m *monitor) SetCondition(name string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.conditions[name] = err
+}
+
+func (m *monitor) PollSucceeded() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.lastPollAt = m.now()
+}
+
+func (m *monitor) PollFailed(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.lastError = &ErrorStatus{Message: err.Error(), At: m.now()}
+}
+
+// EventStarted tracks the event as in flight until finished is called with the result of its processing
+func (m *monitor) EventStarted(event Event) (finished func(err error)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	event.StartedAt = m.now()
+	id := m.nextEvent
+	m.nextEvent++
+	m.inFlight[id] = event
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+
+			delete(m.inFlight, id)
+			m.lastEventAt = m.now()
+			if err == nil {
+				m.eventsProcessed++
+				return
+			}
+			m.eventsFailed++
+			m.lastError = &ErrorStatus{Message: err.Error(), At: m.now(), Event: &event}
+		})
+	}
+}
+
+// Status is the state reported by /status, Ready and Problems are the ones of /readyz
+func (m *monitor) Status() Status {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	status := Status{
+		StartedAt:       m.startedAt,
+		InFlight:        []Event{},
+		EventsProcessed: m.eventsProcessed,
+		EventsFailed:    m.eventsFailed,
+		LastError:       m.lastError,
+	}
+
+	names := make([]string, 0, len(m.conditions))
+	for name := range m.conditions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		status.Conditions = map[string]string{}
+	}
+	for _, name := range names {
+		status.Conditions[name] = "ok"
+		if err := m.conditions[name]; err != nil {
+			status.Conditions[name] = err.Error()
+			status.Problems = append(status.Problems, name+": "+err.Error())
+		}
+	}
+
+	if !m.lastPollAt.IsZero() {
+		lastPollAt := m.lastPollAt
+		status.LastPollAt = &lastPollAt
+	}
+	// The poll counts as recent while an event is in flight, and until the worker had the time to poll again after it
+	if m.pollMaxAge > 0 && len(m.inFlight) == 0 {
+		if m.lastPollAt.IsZero() {
+			status.Problems = append(status.Problems, "poll: the queue was not polled yet")
+		} else if m.lastEventAt.After(m.lastPollAt) {
+			if age := m.now().Sub(m.lastEventAt); age > m.pollMaxAge {
+				status.Problems = append(status.Problems, "poll: the queue was not polled since the last event finished "+age.Round(time.Second).String()+" ago")
+			}
+		} else if age := m.now().Sub(m.lastPollAt); age > m.pollMaxAge {
+			status.Problems = append(status.Problems, "poll: the last successful poll was "+age.Round(time.Second).String()+" ago")
+		}
+	}
+	status.Ready = len(status.Problems) == 0
+
+	ids := make([]int, 0, len(m.inFlight))
+	for id := range m.inFlight {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		status.InFlight = append(status.InFlight, m.inFlight[id])
+	}
+	return status
+}
+
+type nopMonitor struct{}
+
+// Nop is the monitor of the workers without a health server
+func Nop() Monitor {
+	return nopMonitor{}
+}
+
+func (nopMonitor) PollSucceeded()                     {}
+func (nopMonitor) PollFailed(error)                   {}
+func (nopMonitor) EventStarted(Event) func(err error) { return func(error) {} }
+
+var (
+	defaultMonitor Monitor = Nop()
+	defaultMutex   sync.RWMutex
+)
+
+// Default is the monitor of the helpers and clients that were not given one
+func Default() Monitor {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+
+	return defaultMonitor
+}
+
+func SetDefault(monitor Monitor) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	defaultMonitor = monitor
+}
@@ -0,0 +1,177 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMonitorStatus(t *testing.T) {
+	startedAt := time.Date(2022, 2, 14, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		pollMaxAge       time.Duration
+		update           func(m *monitor, now *time.Time)
+		expectedReady    bool
+		expectedProblems []string
+	}{
+		{
+			name:       "Success when the conditions hold and the last poll is recent",
+			pollMaxAge: time.Minute,
+			update: func(m *monitor, now *time.Time) {
+				m.SetCondition("config", nil)
+				m.PollSucceeded()
+				*now = now.Add(30 * time.Second)
+			},
+			expectedReady: true,
+		},
+		{
+			name:          "Success when a worker that does not poll has no conditions",
+			update:        func(m *monitor, now *time.Time) {},
+			expectedReady: true,
+		},
+		{
+			name:       "Fail when the queue was not polled yet",
+			pollMaxAge: time.Minute,
+			update:     func(m *monitor, now *time.Time) {},
+			expectedProblems: []string{
+				"poll: the queue was not polled yet",
+			},
+		},
+		{
+			name:       "Success when the last poll is old because an event is in flight",
+			pollMaxAge: time.Minute,
+			update: func(m *monitor, now *time.Time) {
+				m.PollSucceeded()
+				m.EventStarted(Event{ImportJobID: "456"})
+				*now = now.Add(10 * time.Minute)
+			},
+			expectedReady: true,
+		},
+		{
+			name:       "Success when the last poll is old because an event just finished",
+			pollMaxAge: time.Minute,
+			update: func(m *monitor, now *time.Time) {
+				m.PollSucceeded()
+				finished := m.EventStarted(Event{ImportJobID: "456"})
+				*now = now.Add(10 * time.Minute)
+				finished(nil)
+				*now = now.Add(30 * time.Second)
+			},
+			expectedReady: true,
+		},
+		{
+			name:       "Fail when the worker did not poll again after the event",
+			pollMaxAge: time.Minute,
+			update: func(m *monitor, now *time.Time) {
+				m.PollSucceeded()
+				finished := m.EventStarted(Event{ImportJobID: "456"})
+				*now = now.Add(10 * time.Minute)
+				finished(nil)
+				*now = now.Add(2 * time.Minute)
+			},
+			expectedProblems: []string{
+				"poll: the queue was not polled since the last event finished 2m0s ago",
+			},
+		},
+		{
+			name:       "Fail when a condition is broken and the last poll is too old",
+			pollMaxAge: time.Minute,
+			update: func(m *monitor, now *time.Time) {
+				m.SetCondition("awsClients", errors.New("no credentials"))
+				m.PollSucceeded()
+				*now = now.Add(3 * time.Minute)
+				m.PollFailed(errors.New("failed to fetch sqs message"))
+			},
+			expectedProblems: []string{
+				"awsClients: no credentials",
+				"poll: the last successful poll was 3m0s ago",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		now := startedAt
+		m := NewMonitor(test.pollMaxAge)
+		m.now = func() time.Time { return now }
+		test.update(m, &now)
+
+		status := m.Status() //<--- function under test
+
+		assert.Equal(t, test.expectedReady, status.Ready)
+		assert.Equal(t, test.expectedProblems, status.Problems)
+	}
+}
+
+func TestMonitorEvents(t *testing.T) {
+	fmt.Println("name: Success when the in flight events, the counts and the last error are reported")
+
+	m := NewMonitor(0)
+	finishedFirst := m.EventStarted(Event{ImportJobID: "456", DataSource: "analyst"})
+	finishedSecond := m.EventStarted(Event{ImportJobID: "457", DataSource: "analyst"})
+	m.EventStarted(Event{ImportJobID: "458", DataSource: "analyst"})
+	finishedFirst(nil)
+	finishedSecond(errors.New("access denied"))
+	finishedSecond(nil)
+
+	status := m.Status() //<--- function under test
+
+	assert.Equal(t, 1, status.EventsProcessed)
+	assert.Equal(t, 1, status.EventsFailed)
+	assert.Equal(t, 1, len(status.InFlight))
+	assert.Equal(t, "458", status.InFlight[0].ImportJobID)
+	assert.Equal(t, "access denied", status.LastError.Message)
+	assert.Equal(t, "457", status.LastError.Event.ImportJobID)
+}
+
+func TestHandler(t *testing.T) {
+	m := NewMonitor(time.Minute)
+	tests := []struct {
+		name         string
+		path         string
+		expectedCode int
+		expectedBody map[string]interface{}
+	}{
+		{
+			name:         "Success when the process is alive",
+			path:         "/healthz",
+			expectedCode: 200,
+			expectedBody: map[string]interface{}{"status": "ok"},
+		},
+		{
+			name:         "Fail when the worker is not ready",
+			path:         "/readyz",
+			expectedCode: 503,
+			expectedBody: map[string]interface{}{"ready": false, "problems": []interface{}{"poll: the queue was not polled yet"}},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		recorder := httptest.NewRecorder()
+
+		m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", test.path, nil)) //<--- function under test
+
+		var body map[string]interface{}
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, test.expectedCode, recorder.Code)
+		assert.Equal(t, test.expectedBody, body)
+	}
+
+	fmt.Println("name: Success when the status reports the last poll")
+	m.PollSucceeded()
+	recorder := httptest.NewRecorder()
+
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/status", nil)) //<--- function under test
+
+	var status Status
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	assert.Equal(t, 200, recorder.Code)
+	assert.True(t, status.Ready)
+	assert.NotNil(t, status.LastPollAt)
+}
@@ -0,0 +1,33 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves /healthz, 200 while the process runs, /readyz, 200 when ready and 503 with the problems otherwise,
+// and /status, the json of Status
+func (m *monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(writer http.ResponseWriter, request *http.Request) {
+		writeJSON(writer, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/readyz", func(writer http.ResponseWriter, request *http.Request) {
+		status := m.Status()
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(writer, code, map[string]interface{}{"ready": status.Ready, "problems": status.Problems})
+	})
+	mux.HandleFunc("/status", func(writer http.ResponseWriter, request *http.Request) {
+		writeJSON(writer, http.StatusOK, m.Status())
+	})
+	return mux
+}
+
+func writeJSON(writer http.ResponseWriter, code int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+	json.NewEncoder(writer).Encode(body)
+}
@@ -1,64 +1,465 @@
 package helpers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/anhamdan/etl-base/config"
+	"github.com/anhamdan/etl-base/constants"
+	"github.com/anhamdan/etl-base/health"
+	"github.com/anhamdan/etl-base/logging"
+	"github.com/anhamdan/etl-base/mapping"
+	"github.com/anhamdan/etl-base/metrics"
+	"github.com/anhamdan/etl-base/retry"
 	"github.com/anhamdan/etl-base/s3aws"
 	"github.com/anhamdan/etl-base/sfnaws"
 	"github.com/anhamdan/etl-base/sqsaws"
+	"github.com/anhamdan/etl-base/stsaws"
+	"github.com/anhamdan/etl-base/tracing"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/sqs"
-	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 )
 
+// BaseHelper runs the worker of an ETL type
 type BaseHelper interface {
-	initAwsSession() (*session.Session, error)
-	initLandingZone(awsSession *session.Session, importConfig config.Config) *landingZoneHelper
-	initLoadingZone(awsSession *session.Session, importConfig config.Config) *loadingZoneHelper
-	initWfmHelper(awsSession *session.Session, importConfig config.Config) *workflowManagerHelper
-	initChannels() (chan *sqs.Message, chan error)
-	handleErrMsg(errChan chan error, wg *sync.WaitGroup)
+	Run() error
 }
-type baseHelper struct{}
 
+type baseHelper struct {
+	typeOfImport string
+	args         []string
+}
+
+// NewBaseHelper sets up the helpers of an ETL type, it must be registered with RegisterEtl
 func NewBaseHelper(typeOfImport string) *baseHelper {
-	helper := baseHelper{}
+	helper := baseHelper{typeOfImport: typeOfImport}
 	return &helper
 }
 
-func initAwsSession() (*session.Session, error) {
-	importConfig := initConfig("analyst")
-	awsSession, err := session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable, // Must be set to enable
-		Profile:           importConfig.AWSConfig.Profile,
+// SetArgs sets the command line flags of the config, like os.Args[1:]. -config replaces CONFIG_FILE and -set
+// overrides a field of every other source
+func (helper *baseHelper) SetArgs(args []string) {
+	helper.args = args
+}
+
+// Run loads the config of the ETL type, registers its mapped ETL when it has a mapping spec, builds the worker of the config and handles the events of the queue until
+// the process is interrupted. Without a workflow manager, the single local event is handled and its error returned
+func (helper *baseHelper) Run() error {
+	importConfig, err := initConfig(helper.typeOfImport, helper.args)
+	if err != nil {
+		return err
+	}
+	if err := initEtl(helper.typeOfImport, importConfig); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w, err := newWorker(importConfig)
+	if err != nil {
+		return err
+	}
+	defer w.stop()
+	return w.run(ctx)
+}
+
+// worker is the runtime built from a config, with the functions stopping what was started for it
+type worker struct {
+	runtime   *etlRuntime
+	wfmHelper *workflowManagerHelper
+	logger    logging.Logger
+	stops     []func()
+}
+
+// newWorker builds the clients and the runtime of the config. The runtime picks the registered ETL of every event.
+// The order matters, the logger, the metrics, the tracer provider, the health monitor, the retrier and the s3 limiter
+// are made the defaults before the clients that read them when they are built
+func newWorker(importConfig config.Config) (*worker, error) {
+	w := &worker{logger: initLogger(importConfig)}
+	_, stopMetrics := initMetrics(importConfig)
+	w.stops = append(w.stops, stopMetrics)
+
+	shutdownTracing, err := initTracing(importConfig)
+	if err != nil {
+		w.stop()
+		return nil, err
+	}
+	w.stops = append(w.stops, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), constants.TracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			w.logger.Error("Could not flush the spans", logging.Err(err))
+		}
 	})
+
+	awsSession, err := initAwsSession(importConfig)
+	_, stopHealth := initHealth(importConfig, err)
+	w.stops = append(w.stops, stopHealth)
 	if err != nil {
-		log.Fatalf("error: %+v\n", err)
+		w.stop()
+		return nil, err
+	}
+
+	initRetrier(importConfig)
+	initS3Limiter(importConfig)
+
+	w.wfmHelper = initWfmHelper(awsSession, importConfig)
+	w.runtime = NewEtlRuntime(awsSession, initLandingZone(awsSession, importConfig), initLoadingZone(awsSession, importConfig), w.wfmHelper, nil)
+	w.runtime.SetIdempotencyStore(initIdempotencyStore(awsSession, importConfig))
+	w.runtime.SetCheckpointStore(initCheckpointStore(awsSession, importConfig))
+	if provider := initRoleLandingZones(awsSession, importConfig); provider != nil {
+		w.runtime.SetLandingZoneProvider(provider)
 	}
+	return w, nil
+}
+
+// run handles the events of the queue one at a time until ctx is done, the event being handled is finished first.
+// The failed events are logged and settled by the runtime
+func (w *worker) run(ctx context.Context) error {
+	if !w.wfmHelper.IsEnabled() {
+		event, err := w.wfmHelper.GetEvent(nil)
+		if err != nil {
+			return err
+		}
+		return w.runtime.HandleEvent(event)
+	}
+
+	chnMessages, errChan := initChannels()
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go w.wfmHelper.ReceiveEvents(chnMessages, errChan, wg)
+	go handleErrMsg(errChan, wg)
 
-	return awsSession, nil
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Stopping the worker")
+			return nil
+		case message, ok := <-chnMessages:
+			if !ok {
+				return nil
+			}
+			event, err := w.wfmHelper.receive(message)
+			if err != nil {
+				continue
+			}
+			_ = w.runtime.HandleEvent(event)
+		}
+	}
 }
-func initConfig(Type string) config.Config {
-	return config.Initialize(Type)
+
+// stop stops what was started for the worker, in the reverse order
+func (w *worker) stop() {
+	for i := len(w.stops) - 1; i >= 0; i-- {
+		w.stops[i]()
+	}
+}
+
+func initAwsSession(importConfig config.Config) (*session.Session, error) {
+	return importConfig.AWSConfig.NewSession()
+}
+func initConfig(Type string, args []string) (config.Config, error) {
+	return config.Initialize(Type, args)
+}
+
+// initEtl registers the ETL mapping the records with the spec of the config when the type has none registered. A
+// registered type must not have a spec, its transform would be silently replaced
+func initEtl(Type string, importConfig config.Config) error {
+	specPath := importConfig.MappingConfig.SpecPath
+	_, err := LookupEtl(Type)
+	switch {
+	case err == nil && specPath != constants.EmptyString:
+		return errors.New(fmt.Sprintf("the etl %s is registered, it cannot be mapped with the spec %s", Type, specPath))
+	case err == nil || specPath == constants.EmptyString:
+		return err
+	}
+
+	spec, err := mapping.Load(specPath)
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to load the mapping spec %s, error: %s", specPath, err.Error()))
+	}
+	// RegisterEtl panics on an invalid spec, that is a configuration error here
+	if _, err := mapping.Compile(spec); err != nil {
+		return errors.New(fmt.Sprintf("invalid mapping spec %s, error: %s", specPath, err.Error()))
+	}
+	RegisterEtl(Etl{Name: Type, Mapping: &spec})
+	return nil
+}
+
+// initLogger writes json lines on stdout, for CloudWatch Logs, and makes it the logger of the helpers created next.
+// The level was checked when the config was validated
+func initLogger(importConfig config.Config) logging.Logger {
+	level, _ := logging.ParseLevel(importConfig.LoggingConfig.Level)
+	logger := logging.New(os.Stdout, level)
+	logging.SetDefault(logger)
+	return logger
+}
+
+// initMetrics starts the exporter of the config and makes it the metrics of the helpers created next. The returned
+// function stops the exporter, flushing what the emf one still buffers
+func initMetrics(importConfig config.Config) (metrics.Metrics, func()) {
+	metricsConfig := importConfig.MetricsConfig
+	namespace := metricsConfig.Namespace
+	if namespace == constants.EmptyString {
+		namespace = constants.DefaultMetricsNamespace
+	}
+
+	var m metrics.Metrics
+	stop := func() {}
+	switch metricsConfig.Exporter {
+	case constants.PrometheusMetricsExporter:
+		registry := metrics.NewRegistry()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry.Handler())
+		server := &http.Server{Addr: metricsConfig.Address, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logging.Default().Error("The metrics server stopped", logging.Err(err))
+			}
+		}()
+		m, stop = registry, func() { server.Close() }
+	case constants.EMFMetricsExporter:
+		interval := metricsConfig.FlushInterval
+		if interval == 0 {
+			interval = constants.DefaultMetricsFlushInterval
+		}
+		exporter := metrics.NewEMFExporter(os.Stdout, namespace)
+		m, stop = exporter, exporter.Start(interval)
+	default:
+		m = metrics.Nop()
+	}
+
+	metrics.SetDefault(m)
+	return m, stop
+}
+
+// initTracing exports the spans of the helpers to the otlp collector of the config. Without one the spans are dropped,
+// the trace context of the events is still read from their messages
+func initTracing(importConfig config.Config) (func(context.Context) error, error) {
+	tracingConfig := importConfig.TracingConfig
+	if tracingConfig.Exporter != constants.OTLPTracingExporter {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	serviceName := tracingConfig.ServiceName
+	if serviceName == constants.EmptyString {
+		serviceName = constants.DefaultTracingServiceName
+	}
+	return tracing.SetupOTLP(context.Background(), tracing.OTLPOptions{
+		Endpoint:    tracingConfig.Endpoint,
+		Insecure:    tracingConfig.Insecure,
+		ServiceName: serviceName,
+	})
+}
+
+// initHealth serves /healthz, /readyz and /status on the address of the config and makes the monitor the one of the
+// helpers created next. The worker is ready when the config is valid, the aws clients were built, awsErr is the error
+// of the session, and the queue was polled recently. Without a workflow manager nothing polls, so the poll is not
+// checked. The returned function stops the server
+func initHealth(importConfig config.Config, awsErr error) (health.Monitor, func()) {
+	healthConfig := importConfig.HealthConfig
+	if !healthConfig.Enabled {
+		health.SetDefault(health.Nop())
+		return health.Nop(), func() {}
+	}
+
+	pollMaxAge := healthConfig.PollMaxAge
+	if pollMaxAge == 0 {
+		pollMaxAge = constants.DefaultHealthPollMaxAge
+	}
+	if !importConfig.WorkflowManagerConfig.WorkFlowManagerEnabled {
+		pollMaxAge = 0
+	}
+
+	monitor := health.NewMonitor(pollMaxAge)
+	monitor.SetCondition("config", importConfig.Validate())
+	monitor.SetCondition("awsClients", awsErr)
+
+	server := &http.Server{Addr: healthConfig.Address, Handler: monitor.Handler()}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logging.Default().Error("The health server stopped", logging.Err(err))
+		}
+	}()
+
+	health.SetDefault(monitor)
+	return monitor, func() { server.Close() }
+}
+
+// initRetrier retries the aws calls with the policies of the config and makes it the retrier of the clients created
+// next. The fields missing from the policy of an operation are the ones of the default policy
+func initRetrier(importConfig config.Config) retry.Retrier {
+	retryConfig := importConfig.RetryConfig
+	retrier := retry.New(retryPolicy(retryConfig.Default, config.RetryPolicy{}))
+	for operation, policy := range retryConfig.Operations {
+		retrier.SetPolicy(operation, retryPolicy(policy, retryConfig.Default))
+	}
+
+	retry.SetDefault(retrier)
+	return retrier
+}
+
+func retryPolicy(policy config.RetryPolicy, fallback config.RetryPolicy) retry.Policy {
+	if policy.InitialInterval == 0 {
+		policy.InitialInterval = fallback.InitialInterval
+	}
+	if policy.MaxInterval == 0 {
+		policy.MaxInterval = fallback.MaxInterval
+	}
+	if policy.Multiplier == 0 {
+		policy.Multiplier = fallback.Multiplier
+	}
+	if policy.Jitter == 0 {
+		policy.Jitter = fallback.Jitter
+	}
+	if policy.MaxElapsedTime == 0 {
+		policy.MaxElapsedTime = fallback.MaxElapsedTime
+	}
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = fallback.MaxAttempts
+	}
+	return retry.Policy{
+		InitialInterval: policy.InitialInterval,
+		MaxInterval:     policy.MaxInterval,
+		Multiplier:      policy.Multiplier,
+		Jitter:          policy.Jitter,
+		MaxElapsedTime:  policy.MaxElapsedTime,
+		MaxAttempts:     policy.MaxAttempts,
+	}
+}
+
+// initS3Limiter paces the s3 requests of every prefix with the limits of the config and makes it the limiter of the s3
+// clients created next. The rates missing from the config are the ones of s3
+func initS3Limiter(importConfig config.Config) s3aws.Limiter {
+	awsConfig := importConfig.AWSConfig
+	limiter := s3aws.NewLimiter(
+		s3Limit(awsConfig.S3Get, s3aws.DefaultGetRequestsPerSecond),
+		s3Limit(awsConfig.S3Put, s3aws.DefaultPutRequestsPerSecond),
+	)
+
+	s3aws.SetDefaultLimiter(limiter)
+	return limiter
+}
+
+func s3Limit(limit config.S3LimitConfig, defaultRequestsPerSecond float64) s3aws.Limit {
+	if limit.RequestsPerSecond == 0 {
+		limit.RequestsPerSecond = defaultRequestsPerSecond
+	}
+	return s3aws.Limit{
+		RequestsPerSecond: limit.RequestsPerSecond,
+		Burst:             limit.Burst,
+		MaxConcurrency:    limit.MaxConcurrency,
+	}
+}
+
+// initS3Svc returns the s3 service selected by the config, the local filesystem one needs no aws credentials, retries
+// nor rate limits
+func initS3Svc(awsSession *session.Session, importConfig config.Config) s3aws.SvcClient {
+	if importConfig.AWSConfig.S3Backend == constants.LocalS3Backend {
+		return s3aws.NewFSSvcClient(importConfig.AWSConfig.S3LocalRoot)
+	}
+	return newS3Svc(awsSession)
+}
+
+// newS3Svc retries the limited requests, so every attempt waits for its turn and the limiter sees the slow downs. The
+// sdk does not retry them itself, it would retry the slow downs before the limiter sees them
+func newS3Svc(awsSession *session.Session) s3aws.SvcClient {
+	limitedSvc := s3aws.NewLimitedSvcClient(s3.New(awsSession, aws.NewConfig().WithMaxRetries(0)), s3aws.DefaultLimiter())
+	return s3aws.NewRetrySvcClient(limitedSvc, retry.Default())
 }
 
 func initLandingZone(awsSession *session.Session, importConfig config.Config) *landingZoneHelper {
-	s3LandingZoneSession := s3.New(awsSession)
+	s3LandingZoneSession := initS3Svc(awsSession, importConfig)
 	s3LandingZoneClient := s3aws.NewS3Client(s3LandingZoneSession, importConfig.LandingZoneConfig.S3Bucket)
 	return NewLandingZoneHelper(s3LandingZoneClient)
 }
 
+// initRoleLandingZones reads the landing zone with the role of the event, the credentials of every role are cached
+// and shared with the other clients of the session. The local filesystem backend has no roles
+func initRoleLandingZones(awsSession *session.Session, importConfig config.Config) func(roleArn string) LandingZoneHelper {
+	if importConfig.AWSConfig.S3Backend == constants.LocalS3Backend {
+		return nil
+	}
+
+	credentialsCache := stsaws.ForSession(awsSession)
+	landingZones := newRoleLandingZones(stsaws.DefaultMaxRoles, func(roleArn string) LandingZoneHelper {
+		s3Svc := newS3Svc(credentialsCache.Session(roleArn))
+		s3LandingZoneClient := s3aws.NewS3Client(s3Svc, importConfig.LandingZoneConfig.S3Bucket)
+		return NewLandingZoneHelper(s3LandingZoneClient)
+	})
+	return landingZones.landingZone
+}
+
+// roleLandingZones keeps the landing zone of the last maxRoles roles, so the events of a role reuse its client
+type roleLandingZones struct {
+	newLandingZone func(roleArn string) LandingZoneHelper
+	entries        map[string]*roleLandingZone
+	maxRoles       int
+	uses           uint64
+	mutex          sync.Mutex
+}
+
+type roleLandingZone struct {
+	landingZone LandingZoneHelper
+	// usedAt orders the roles by their last use
+	usedAt uint64
+}
+
+func newRoleLandingZones(maxRoles int, newLandingZone func(roleArn string) LandingZoneHelper) *roleLandingZones {
+	return &roleLandingZones{newLandingZone: newLandingZone, entries: map[string]*roleLandingZone{}, maxRoles: maxRoles}
+}
+
+// landingZone returns the landing zone of the role, the least recently used role is forgotten when maxRoles are kept
+func (zones *roleLandingZones) landingZone(roleArn string) LandingZoneHelper {
+	zones.mutex.Lock()
+	defer zones.mutex.Unlock()
+
+	entry, ok := zones.entries[roleArn]
+	if !ok {
+		if len(zones.entries) >= zones.maxRoles {
+			zones.evictLeastRecentlyUsed()
+		}
+		entry = &roleLandingZone{landingZone: zones.newLandingZone(roleArn)}
+		zones.entries[roleArn] = entry
+	}
+	zones.uses++
+	entry.usedAt = zones.uses
+	return entry.landingZone
+}
+
+func (zones *roleLandingZones) evictLeastRecentlyUsed() {
+	var leastRecentlyUsed string
+	for roleArn, entry := range zones.entries {
+		if leastRecentlyUsed == "" || entry.usedAt < zones.entries[leastRecentlyUsed].usedAt {
+			leastRecentlyUsed = roleArn
+		}
+	}
+	delete(zones.entries, leastRecentlyUsed)
+}
+
 func initLoadingZone(awsSession *session.Session, importConfig config.Config) *loadingZoneHelper {
-	s3LoadingZoneSession := s3.New(awsSession)
+	s3LoadingZoneSession := initS3Svc(awsSession, importConfig)
 	s3LoadingZoneClient := s3aws.NewS3Client(s3LoadingZoneSession, importConfig.LoadingZoneConfig.S3Bucket)
 	return NewLoadingZoneHelper(s3LoadingZoneClient, importConfig.LoadingZoneConfig)
 }
 
-func initWfmHelper(awsSession *session.Session, importConfig config.Config) interface{} {
+// newSQSSvc retries the sqs calls with the policy of the config only, the sdk does not retry them itself or every
+// attempt of the policy would be several calls, beyond its max elapsed time
+func newSQSSvc(awsSession *session.Session) sqsaws.SQSMessageClient {
+	return sqsaws.NewRetryMessageClient(sqs.New(awsSession, aws.NewConfig().WithMaxRetries(0)), retry.Default())
+}
+
+func initWfmHelper(awsSession *session.Session, importConfig config.Config) *workflowManagerHelper {
 	// SQS
-	sqsSession := sqs.New(awsSession)
-	sqsClient := sqsaws.New(sqsSession, importConfig.WorkflowManagerConfig.SQSURL)
+	sqsClient := sqsaws.New(newSQSSvc(awsSession), importConfig.WorkflowManagerConfig.SQSURL)
 
 	// Step function
 	sfnClient := sfnaws.New()
@@ -66,6 +467,26 @@ func initWfmHelper(awsSession *session.Session, importConfig config.Config) inte
 	return NewWFMHelper(sqsClient, sfnClient, importConfig.WorkflowManagerConfig)
 }
 
+func initIdempotencyStore(awsSession *session.Session, importConfig config.Config) IdempotencyStore {
+	storeConfig := importConfig.StateStoreConfig
+	if storeConfig.Backend == constants.S3StateStore {
+		s3StateSession := initS3Svc(awsSession, importConfig)
+		s3StateClient := s3aws.NewS3Client(s3StateSession, storeConfig.S3Bucket)
+		return NewS3IdempotencyStore(s3StateClient, storeConfig.S3Bucket, storeConfig.Prefix)
+	}
+	return NewMemoryIdempotencyStore()
+}
+
+func initCheckpointStore(awsSession *session.Session, importConfig config.Config) CheckpointStore {
+	storeConfig := importConfig.StateStoreConfig
+	if storeConfig.Backend == constants.S3StateStore {
+		s3StateSession := initS3Svc(awsSession, importConfig)
+		s3StateClient := s3aws.NewS3Client(s3StateSession, storeConfig.S3Bucket)
+		return NewS3CheckpointStore(s3StateClient, storeConfig.S3Bucket, storeConfig.Prefix)
+	}
+	return NewMemoryCheckpointStore()
+}
+
 func initChannels() (chan *sqs.Message, chan error) {
 	return make(chan *sqs.Message), make(chan error)
 }
@@ -74,6 +495,6 @@ func handleErrMsg(errChan chan error, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for err := range errChan {
-		log.Printf("There was an error when trying to receive events: %s", err.Error())
+		logging.Default().Error("There was an error when trying to receive events", logging.Err(err))
 	}
 }
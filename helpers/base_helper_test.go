@@ -0,0 +1,377 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/config"
+	"github.com/anhamdan/etl-base/health"
+	"github.com/anhamdan/etl-base/logging"
+	"github.com/anhamdan/etl-base/metrics"
+	"github.com/anhamdan/etl-base/retry"
+	"github.com/anhamdan/etl-base/s3aws"
+	"github.com/anhamdan/etl-base/tracing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeWorkerFiles writes the config of a worker reading the local event from a filesystem s3, with the input file
+// of the event in its landing zone, and returns the path of the config
+func writeWorkerFiles(t *testing.T, extraConfig string) string {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "s3")
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "landing", "registry"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "landing", "registry", "a.json"), []byte(`[{"id": 1, "value": "A"}]`), 0644))
+	eventPath := filepath.Join(dir, "event.json")
+	assert.Nil(t, os.WriteFile(eventPath, []byte(`{"dataSource": "registry-test", "importJobID": "456", "inputFiles": ["s3://landing/registry/a.json"]}`), 0644))
+
+	configPath := filepath.Join(dir, "config.yaml")
+	assert.Nil(t, os.WriteFile(configPath, []byte(fmt.Sprintf(`
+landingZone:
+  s3Bucket: landing
+loadingZone:
+  s3Bucket: loading
+  enabled: true
+  stagingPrefix: _staging
+workflowManager:
+  enabled: false
+  localEventPath: %s
+aws:
+  region: eu-west-1
+  s3Backend: fs
+  s3LocalRoot: %s
+stateStore:
+  backend: memory
+%s`, eventPath, root, extraConfig)), 0644))
+	return configPath
+}
+
+func TestRun(t *testing.T) {
+	fmt.Println("name: Success when the worker of the config handles the local event")
+
+	restoreDefaults(t)
+	configPath := writeWorkerFiles(t, "")
+	t.Setenv("CONFIG_FILE", configPath)
+
+	err := NewBaseHelper("registry-test").Run() //<--- function under test
+
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(filepath.Dir(configPath), "s3", "loading", "456", "a.json"))
+	assert.Nil(t, err)
+
+	fmt.Println("name: Success when a set flag overrides the environment variable")
+
+	t.Setenv("LOADING_ZONE_OUTPUT_PREFIX", "env")
+	helper := NewBaseHelper("registry-test")
+	helper.SetArgs([]string{"-set", "loadingZone.outputPrefix=flags"})
+
+	err = helper.Run() //<--- function under test
+
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(filepath.Dir(configPath), "s3", "loading", "flags", "456", "a.json"))
+	assert.Nil(t, err)
+	t.Setenv("LOADING_ZONE_OUTPUT_PREFIX", "")
+
+	fmt.Println("name: Fail when the type is not registered")
+
+	err = NewBaseHelper("unknown").Run() //<--- function under test
+
+	assert.NotNil(t, err)
+
+	fmt.Println("name: Fail when the config is not valid")
+
+	t.Setenv("CONFIG_FILE", writeWorkerFiles(t, "logging:\n  level: loud\n"))
+
+	err = NewBaseHelper("registry-test").Run() //<--- function under test
+
+	assert.IsType(t, &config.ValidationError{}, err)
+}
+
+func TestRunMappedEtl(t *testing.T) {
+	fmt.Println("name: Success when the etl mapped by the spec of the config handles the local event")
+
+	restoreDefaults(t)
+	specPath := filepath.Join(t.TempDir(), "spec.yaml")
+	assert.Nil(t, os.WriteFile(specPath, []byte("fields:\n  - target: id\n    source: $.id\n    type: int\n  - target: label\n    source: $.value\n"), 0644))
+	configPath := writeWorkerFiles(t, fmt.Sprintf("etls:\n  registry-mapped-test:\n    mapping:\n      specPath: %s\n", specPath))
+	dir := filepath.Dir(configPath)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "s3", "landing", "registry", "a.json"), []byte(`[{"id": 9007199254740993, "value": "A"}]`), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "event.json"), []byte(`{"dataSource": "registry-mapped-test", "importJobID": "456", "inputFiles": ["s3://landing/registry/a.json"]}`), 0644))
+	t.Setenv("CONFIG_FILE", configPath)
+
+	err := NewBaseHelper("registry-mapped-test").Run() //<--- function under test
+
+	assert.Nil(t, err)
+	_, err = LookupEtl("registry-mapped-test")
+	assert.Nil(t, err)
+	content, err := os.ReadFile(filepath.Join(dir, "s3", "loading", "456", "a.json"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), `"id": 9007199254740993`)
+
+	fmt.Println("name: Fail when the registered etl has a mapping spec")
+
+	t.Setenv("MAPPING_SPEC_PATH", specPath)
+	t.Setenv("CONFIG_FILE", writeWorkerFiles(t, ""))
+
+	err = NewBaseHelper("registry-test").Run() //<--- function under test
+
+	assert.Equal(t, errors.New(fmt.Sprintf("the etl registry-test is registered, it cannot be mapped with the spec %s", specPath)), err)
+
+	fmt.Println("name: Fail when the mapping spec is not valid")
+
+	assert.Nil(t, os.WriteFile(specPath, []byte("fields:\n  - target: id\n    source: id\n"), 0644))
+	t.Setenv("CONFIG_FILE", writeWorkerFiles(t, "etls:\n  registry-invalid-test: {}\n"))
+
+	err = NewBaseHelper("registry-invalid-test").Run() //<--- function under test
+
+	assert.NotNil(t, err)
+	_, err = LookupEtl("registry-invalid-test")
+	assert.NotNil(t, err)
+}
+
+// restoreDefaults puts back the defaults that newWorker replaces when the test ends
+func restoreDefaults(t *testing.T) {
+	logger, m, tracerProvider, monitor := logging.Default(), metrics.Default(), otel.GetTracerProvider(), health.Default()
+	retrier, limiter := retry.Default(), s3aws.DefaultLimiter()
+	t.Cleanup(func() {
+		retry.SetDefault(retrier)
+		s3aws.SetDefaultLimiter(limiter)
+		logging.SetDefault(logger)
+		metrics.SetDefault(m)
+		health.SetDefault(monitor)
+		if otel.GetTracerProvider() != tracerProvider {
+			otel.SetTracerProvider(tracerProvider)
+		}
+	})
+}
+
+// captureStdout writes what is written on stdout from now on to a file, the returned function reads it
+func captureStdout(t *testing.T) func() string {
+	stdout := os.Stdout
+	file, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	assert.Nil(t, err)
+	os.Stdout = file
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		file.Close()
+	})
+	return func() string {
+		content, err := os.ReadFile(file.Name())
+		assert.Nil(t, err)
+		return string(content)
+	}
+}
+
+// newTestWorker builds the worker of the config written by writeWorkerFiles
+func newTestWorker(t *testing.T, extraConfig string) (*worker, string) {
+	restoreDefaults(t)
+	configPath := writeWorkerFiles(t, extraConfig)
+	t.Setenv("CONFIG_FILE", configPath)
+	importConfig, err := initConfig("registry-test", nil)
+	assert.Nil(t, err)
+	w, err := newWorker(importConfig)
+	assert.Nil(t, err)
+	t.Cleanup(w.stop)
+	return w, filepath.Dir(configPath)
+}
+
+func TestWorkerRun(t *testing.T) {
+	fmt.Println("name: Success when the worker handles the events of the queue until it is closed")
+
+	w, dir := newTestWorker(t, "")
+	body := `{"Message": "{\"dataSource\": \"registry-test\", \"importJobID\": \"789\", \"inputFiles\": [\"s3://landing/registry/a.json\"], \"taskToken\": \"token\"}"}`
+	w.wfmHelper.sqsClient = sqsClientMock{successMsg: &body}
+	w.wfmHelper.sfnClient = sfnClientMock{}
+	w.wfmHelper.enabled = true
+
+	err := w.run(context.Background()) //<--- function under test
+
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "s3", "loading", "789", "a.json"))
+	assert.Nil(t, err)
+}
+
+func TestNewWorker(t *testing.T) {
+	fmt.Println("name: Success when the logger of the config is the one of the runtime and the helpers")
+
+	stdout := captureStdout(t)
+
+	w, _ := newTestWorker(t, "logging:\n  level: debug\n") //<--- function under test
+
+	w.runtime.logger.Debug("runtime debug line")
+	w.wfmHelper.logger.Debug("workflow manager debug line")
+	w.runtime.loadingZone.(*loadingZoneHelper).logger.Debug("loading zone debug line")
+	assert.Contains(t, stdout(), `"level":"debug","msg":"runtime debug line"`)
+	assert.Contains(t, stdout(), `"level":"debug","msg":"workflow manager debug line"`)
+	assert.Contains(t, stdout(), `"level":"debug","msg":"loading zone debug line"`)
+}
+
+func TestNewWorkerMetrics(t *testing.T) {
+	fmt.Println("name: Success when the metrics of the config are the ones of the runtime and the helpers")
+
+	stdout := captureStdout(t)
+
+	w, _ := newTestWorker(t, "metrics:\n  exporter: emf\n  namespace: worker-test\n") //<--- function under test
+
+	w.runtime.metrics.Count(metrics.EventsProcessed, 1)
+	w.wfmHelper.metrics.Count(metrics.EventsParsed, 1)
+	w.runtime.loadingZone.(*loadingZoneHelper).metrics.Count(metrics.RecordsEncoded, 1)
+	w.stop()
+	assert.Contains(t, stdout(), `"Namespace":"worker-test"`)
+	assert.Contains(t, stdout(), fmt.Sprintf(`"%s":1`, metrics.EventsProcessed))
+	assert.Contains(t, stdout(), fmt.Sprintf(`"%s":1`, metrics.EventsParsed))
+	assert.Contains(t, stdout(), fmt.Sprintf(`"%s":1`, metrics.RecordsEncoded))
+}
+
+func TestNewWorkerTracing(t *testing.T) {
+	fmt.Println("name: Success when the spans are exported to the collector of the config")
+
+	var paths []string
+	collector := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		paths = append(paths, request.URL.Path)
+	}))
+	defer collector.Close()
+	endpoint := strings.TrimPrefix(collector.URL, "http://")
+
+	w, _ := newTestWorker(t, fmt.Sprintf("tracing:\n  exporter: otlp\n  endpoint: %s\n  insecure: true\n", endpoint)) //<--- function under test
+
+	_, span := tracing.Start(context.Background(), tracing.ProcessSpan)
+	tracing.End(span, nil)
+	w.stop()
+	assert.Equal(t, []string{"/v1/traces"}, paths)
+}
+
+func TestNewWorkerHealth(t *testing.T) {
+	fmt.Println("name: Success when the health server of the config reports the events of the runtime")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	w, _ := newTestWorker(t, fmt.Sprintf("health:\n  enabled: true\n  address: %s\n", address)) //<--- function under test
+
+	assert.Nil(t, w.run(context.Background()))
+	var status health.Status
+	assert.Eventually(t, func() bool {
+		response, err := http.Get("http://" + address + "/status")
+		if err != nil {
+			return false
+		}
+		defer response.Body.Close()
+		return json.NewDecoder(response.Body).Decode(&status) == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, status.Ready)
+	assert.Equal(t, 1, status.EventsProcessed)
+	assert.Equal(t, map[string]string{"awsClients": "ok", "config": "ok"}, status.Conditions)
+}
+
+// slowS3 answers every request with a slow down of s3 and counts the requests to every path
+func slowS3(t *testing.T) map[string]int {
+	requests := map[string]int{}
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		requests[request.Method+" "+request.URL.Path]++
+		mutex.Unlock()
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		writer.Write([]byte(`<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`))
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("S3_BACKEND", "aws")
+	t.Setenv("AWS_ENDPOINT_S3", server.URL)
+	t.Setenv("AWS_S3_FORCE_PATH_STYLE", "true")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	return requests
+}
+
+func TestNewWorkerRetrier(t *testing.T) {
+	fmt.Println("name: Success when the s3 requests are only retried with the policy of the config")
+
+	requests := slowS3(t)
+
+	w, _ := newTestWorker(t, "retry:\n  default:\n    initialInterval: 1ms\n    maxAttempts: 3\n") //<--- function under test
+
+	err := w.run(context.Background())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, requests["GET /landing/registry/a.json"])
+}
+
+func TestNewSQSSvc(t *testing.T) {
+	fmt.Println("name: Success when the sqs calls are only retried with the policy of the config")
+
+	restoreDefaults(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(`<ErrorResponse><Error><Code>InternalError</Code><Message>try again</Message></Error></ErrorResponse>`))
+	}))
+	t.Cleanup(server.Close)
+	sess, err := session.NewSession(&aws.Config{Endpoint: aws.String(server.URL), Region: aws.String("eu-west-1"), Credentials: credentials.NewStaticCredentials("test", "test", "")})
+	assert.Nil(t, err)
+	retry.SetDefault(retry.New(retry.Policy{InitialInterval: time.Millisecond, MaxAttempts: 3}))
+
+	_, err = newSQSSvc(sess).ReceiveMessage(&sqs.ReceiveMessageInput{QueueUrl: aws.String(server.URL + "/queue")}) //<--- function under test
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, requests)
+}
+
+func TestNewWorkerS3Limiter(t *testing.T) {
+	fmt.Println("name: Success when the s3 requests are paced with the limits of the config")
+
+	requests := slowS3(t)
+	t.Setenv("S3_GET_REQUESTS_PER_SECOND", "10")
+	t.Setenv("S3_GET_BURST", "1")
+
+	w, _ := newTestWorker(t, "retry:\n  default:\n    initialInterval: 1ms\n    maxAttempts: 3\n") //<--- function under test
+
+	startedAt := time.Now()
+	err := w.run(context.Background())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, requests["GET /landing/registry/a.json"])
+	// The slow downs halve the rate to 5 then 2.5 requests per second, the retries wait 200ms and 400ms for a token
+	assert.GreaterOrEqual(t, time.Since(startedAt), 500*time.Millisecond)
+}
+
+func TestRoleLandingZones(t *testing.T) {
+	fmt.Println("name: Success when the landing zone of a role is reused until the role is the least recently used of a full cache")
+
+	built := map[string]int{}
+	zones := newRoleLandingZones(2, func(roleArn string) LandingZoneHelper {
+		built[roleArn]++
+		return NewLandingZoneHelper(newObjectStoreMock())
+	})
+
+	landing := zones.landingZone("arn:aws:iam::111111111111:role/landing") //<--- function under test
+	zones.landingZone("arn:aws:iam::222222222222:role/landing")            //<--- function under test
+	assert.True(t, landing == zones.landingZone("arn:aws:iam::111111111111:role/landing"))
+	zones.landingZone("arn:aws:iam::333333333333:role/landing") //<--- function under test
+	zones.landingZone("arn:aws:iam::222222222222:role/landing") //<--- function under test
+
+	assert.Equal(t, map[string]int{
+		"arn:aws:iam::111111111111:role/landing": 1,
+		"arn:aws:iam::222222222222:role/landing": 2,
+		"arn:aws:iam::333333333333:role/landing": 1,
+	}, built)
+	assert.Equal(t, 2, len(zones.entries))
+}
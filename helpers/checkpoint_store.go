@@ -0,0 +1,118 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/anhamdan/etl-base/s3aws"
+	"path"
+	"sync"
+	"time"
+)
+
+// CheckpointStore keeps the progress of an import job that was not committed yet, so a redelivered event
+// resumes from the first unfinished input file
+type CheckpointStore interface {
+	Load(importJobID, processID string) (*Checkpoint, error)
+	Save(checkpoint Checkpoint) error
+	Delete(importJobID, processID string) error
+}
+
+type Checkpoint struct {
+	ImportJobID string           `json:"importJobID"`
+	ProcessID   string           `json:"processID"`
+	Files       []CheckpointFile `json:"files"`
+	Staged      []ManifestFile   `json:"staged"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
+}
+
+// CheckpointFile is an input file that was transformed and staged in the loading zone
+type CheckpointFile struct {
+	InputFile   string         `json:"inputFile"`
+	OutputFiles []string       `json:"outputFiles"`
+	Stats       InputFileStats `json:"stats"`
+}
+
+type checkpointKey struct {
+	importJobID string
+	processID   string
+}
+
+type memoryCheckpointStore struct {
+	checkpoints map[checkpointKey]Checkpoint
+	mutex       sync.RWMutex
+}
+
+type s3CheckpointStore struct {
+	s3Client s3aws.S3Client
+	bucket   string
+	prefix   string
+}
+
+func NewMemoryCheckpointStore() *memoryCheckpointStore {
+	return &memoryCheckpointStore{checkpoints: map[checkpointKey]Checkpoint{}}
+}
+
+func (store *memoryCheckpointStore) Load(importJobID, processID string) (*Checkpoint, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	checkpoint, ok := store.checkpoints[checkpointKey{importJobID, processID}]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (store *memoryCheckpointStore) Save(checkpoint Checkpoint) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.checkpoints[checkpointKey{checkpoint.ImportJobID, checkpoint.ProcessID}] = checkpoint
+	return nil
+}
+
+func (store *memoryCheckpointStore) Delete(importJobID, processID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.checkpoints, checkpointKey{importJobID, processID})
+	return nil
+}
+
+// NewS3CheckpointStore keeps one object per job and process under prefix, the client must be bound to the given bucket
+func NewS3CheckpointStore(s3Client s3aws.S3Client, bucket, prefix string) *s3CheckpointStore {
+	return &s3CheckpointStore{s3Client: s3Client, bucket: bucket, prefix: prefix}
+}
+
+func (store *s3CheckpointStore) Load(importJobID, processID string) (*Checkpoint, error) {
+	content, err := store.s3Client.Read(store.bucket, store.objectPath(importJobID, processID))
+	if err != nil {
+		if s3aws.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(content, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (store *s3CheckpointStore) Save(checkpoint Checkpoint) error {
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.s3Client.Insert(store.objectPath(checkpoint.ImportJobID, checkpoint.ProcessID), content)
+	return err
+}
+
+func (store *s3CheckpointStore) Delete(importJobID, processID string) error {
+	return store.s3Client.Delete(store.objectPath(importJobID, processID))
+}
+
+func (store *s3CheckpointStore) objectPath(importJobID, processID string) string {
+	return path.Join(store.prefix, "checkpoints", importJobID, processID+".json")
+}
@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type checkpointStoreTest struct {
+	name  string
+	store CheckpointStore
+}
+
+func TestCheckpointStore(t *testing.T) {
+	tests := []checkpointStoreTest{
+		{
+			name:  "Success when checkpointing in memory",
+			store: NewMemoryCheckpointStore(),
+		},
+		{
+			name:  "Success when checkpointing in s3",
+			store: NewS3CheckpointStore(newObjectStoreMock(), "state-bucket", "_state"),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		checkpoint, err := test.store.Load("456", "789") //<--- function under test
+		assert.Nil(t, err)
+		assert.Nil(t, checkpoint)
+
+		err = test.store.Save(Checkpoint{
+			ImportJobID: "456",
+			ProcessID:   "789",
+			Files:       []CheckpointFile{{InputFile: "s3://landing/a.json", OutputFiles: []string{"s3://loading/456/a.json"}}},
+			Staged:      []ManifestFile{{Path: "456/a.json", Rows: 1}},
+		})
+		assert.Nil(t, err)
+
+		checkpoint, err = test.store.Load("456", "789") //<--- function under test
+		assert.Nil(t, err)
+		assert.Equal(t, "s3://landing/a.json", checkpoint.Files[0].InputFile)
+		assert.Equal(t, "456/a.json", checkpoint.Staged[0].Path)
+
+		assert.Nil(t, test.store.Delete("456", "789"))
+		checkpoint, err = test.store.Load("456", "789") //<--- function under test
+		assert.Nil(t, err)
+		assert.Nil(t, checkpoint)
+	}
+}
@@ -0,0 +1,305 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/config"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/mapping"
+	"github.com/anhamdan/etl-base/pipeline"
+	"github.com/anhamdan/etl-base/quality"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DecodeFunc parses the content of an input file into entities, a pointer to a slice of the model of the ETL
+type DecodeFunc func(content []byte, entities interface{}) error
+
+// EntityTransformFunc maps the decoded entities, a slice of the model of the ETL, to the entities to insert
+type EntityTransformFunc func(input *TransformInput, entities interface{}) (interface{}, error)
+
+// RecordTransform runs the decoded entities, a slice of T, through stage and inserts the records it emits, so the
+// transform of an ETL is made of per record functions, like pipeline.Map(toRow)
+func RecordTransform[T, U any](stage pipeline.Stage[T, U]) EntityTransformFunc {
+	return func(input *TransformInput, entities interface{}) (interface{}, error) {
+		records, ok := entities.([]T)
+		if !ok {
+			var model T
+			return nil, errors.New(fmt.Sprintf("failed to transform %s, the entities are %T instead of []%T", input.File, entities, model))
+		}
+
+		output := []U{}
+		err := pipeline.Run(input.Context(), pipeline.Through(pipeline.FromSlice(records), stage), pipeline.Collect(&output))
+		if err != nil {
+			return nil, err
+		}
+		return output, nil
+	}
+}
+
+// mappingTransform maps the entities, a slice of json objects or of any model, with the mapper of a spec
+func mappingTransform(mapRecord func(source interface{}) (mapping.Record, error)) EntityTransformFunc {
+	return func(input *TransformInput, entities interface{}) (interface{}, error) {
+		if objects, ok := entities.([]map[string]interface{}); ok {
+			return RecordTransform(pipeline.Map(func(object map[string]interface{}) (mapping.Record, error) {
+				return mapRecord(object)
+			}))(input, objects)
+		}
+
+		// Any other model is mapped through its json, so the paths of the spec follow its json tags
+		content, err := json.Marshal(entities)
+		if err != nil {
+			return nil, err
+		}
+		var objects []interface{}
+		if err := decodeJSON(content, &objects); err != nil {
+			return nil, err
+		}
+		return RecordTransform(pipeline.Map(mapRecord))(input, objects)
+	}
+}
+
+// Etl is an ETL type hosted by the binary
+type Etl struct {
+	// Name is matched case insensitively with the data source of the manager events and the config type
+	Name string
+	// Config holds the defaults of the type, the lowest config source
+	Config config.Config
+	// Model is a value of the entity read from the input files, like model.TreeElem{}
+	Model interface{}
+	// Decode defaults to a json array of Model, the numbers of its interface values are decoded as json.Number
+	Decode DecodeFunc
+	// Transform defaults to inserting the decoded entities as they are
+	Transform EntityTransformFunc
+	// Mapping replaces Transform with the mapping of every record to the target fields of the spec, the records are
+	// decoded as json objects when Model is not set
+	Mapping *mapping.Spec
+	// Quality rejects the decoded records failing its rules before the transform, and its thresholds fail the events
+	// with too many rejected records. With the default decoder every record is decoded on its own, so a record that
+	// does not fit the model is rejected instead of failing the file
+	Quality *quality.Spec
+	// check runs the rules of Quality, compiled once by RegisterEtl
+	check func(records []interface{}) quality.Result
+}
+
+// decodeJSON is json.Unmarshal keeping the numbers of the interface values as json.Number, so the ids above 2^53 of
+// the json objects are not rounded to a float64
+func decodeJSON(content []byte, out interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(out); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid content after the top-level json value")
+	}
+	return nil
+}
+
+// decodeRule is the rule of the records rejected because they do not fit the model
+const decodeRule = "decode"
+
+var (
+	etls      = map[string]Etl{}
+	etlsMutex sync.RWMutex
+)
+
+// RegisterEtl makes the ETL type available to the runtime and its defaults to config.Initialize. It is meant to
+// be called from the init function of the ETL package and panics when the name is empty or already registered
+func RegisterEtl(etl Etl) {
+	etlsMutex.Lock()
+	defer etlsMutex.Unlock()
+
+	name := strings.ToLower(etl.Name)
+	if name == "" {
+		panic("helpers: RegisterEtl called without a name")
+	}
+	if etl.Mapping != nil {
+		if etl.Transform != nil {
+			panic(fmt.Sprintf("helpers: RegisterEtl called with a transform and a mapping for %s", etl.Name))
+		}
+		mapper, err := mapping.Compile(*etl.Mapping)
+		if err != nil {
+			panic(fmt.Sprintf("helpers: RegisterEtl called with an invalid mapping for %s, error: %s", etl.Name, err.Error()))
+		}
+		if etl.Model == nil {
+			etl.Model = map[string]interface{}{}
+		}
+		etl.Transform = mappingTransform(mapper.Map)
+	}
+	if etl.Model == nil {
+		panic(fmt.Sprintf("helpers: RegisterEtl called without a model for %s", etl.Name))
+	}
+	if etl.Quality != nil {
+		checker, err := quality.Compile(*etl.Quality)
+		if err != nil {
+			panic(fmt.Sprintf("helpers: RegisterEtl called with invalid quality rules for %s, error: %s", etl.Name, err.Error()))
+		}
+		etl.check = checker.Check
+	}
+	if _, ok := etls[name]; ok {
+		panic(fmt.Sprintf("helpers: RegisterEtl called twice for %s", etl.Name))
+	}
+
+	etls[name] = etl
+	config.RegisterDefaults(name, etl.Config)
+}
+
+// LookupEtl returns the ETL type registered under the name
+func LookupEtl(name string) (Etl, error) {
+	etlsMutex.RLock()
+	defer etlsMutex.RUnlock()
+
+	etl, ok := etls[strings.ToLower(name)]
+	if !ok {
+		return Etl{}, etlerrors.New(etlerrors.ErrInvalidEvent, fmt.Sprintf("no etl registered for data source %q, registered: %s", name, strings.Join(registeredEtls(), ", ")), nil)
+	}
+	return etl, nil
+}
+
+// RegisteredEtls returns the sorted names of the registered ETL types
+func RegisteredEtls() []string {
+	etlsMutex.RLock()
+	defer etlsMutex.RUnlock()
+
+	return registeredEtls()
+}
+
+func registeredEtls() []string {
+	names := make([]string, 0, len(etls))
+	for name := range etls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TransformFunc decodes every input file into a slice of the model, rejects the records failing the quality rules and
+// applies the transform of the ETL
+func (etl Etl) TransformFunc() TransformFunc {
+	decode := etl.Decode
+	if decode == nil {
+		decode = decodeJSON
+	}
+	modelType := reflect.TypeOf(etl.Model)
+
+	// The registered ETLs have their rules compiled, the other ones compile them here
+	check := etl.check
+	var qualityErr error
+	if check == nil && etl.Quality != nil {
+		checker, err := quality.Compile(*etl.Quality)
+		if err != nil {
+			qualityErr = errors.New(fmt.Sprintf("invalid quality rules for %s, error: %s", etl.Name, err.Error()))
+		} else {
+			check = checker.Check
+		}
+	}
+
+	return func(input *TransformInput) (interface{}, error) {
+		var entities reflect.Value
+		var err error
+		switch {
+		case qualityErr != nil:
+			return nil, qualityErr
+		case check != nil && etl.Decode == nil:
+			entities, err = decodeCheckedRecords(input, modelType, check)
+		case check != nil:
+			entities, err = checkEntities(input, modelType, decode, check)
+		default:
+			entities = reflect.New(reflect.SliceOf(modelType)).Elem()
+			err = decode(input.Content, entities.Addr().Interface())
+			input.SetRecords(entities.Len())
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("failed to decode %s as %s, error: %s", input.File, modelType, err.Error()))
+		}
+
+		if etl.Transform == nil {
+			return entities.Interface(), nil
+		}
+		return etl.Transform(input, entities.Interface())
+	}
+}
+
+// decodeCheckedRecords decodes the records of a json array one by one, the records failing the rules or the model
+// are rejected as they were in the file
+func decodeCheckedRecords(input *TransformInput, modelType reflect.Type, check func(records []interface{}) quality.Result) (reflect.Value, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(input.Content, &raws); err != nil {
+		return reflect.Value{}, err
+	}
+	records := make([]interface{}, len(raws))
+	for i, raw := range raws {
+		// The raw records are valid json, the json array was decoded
+		_ = decodeJSON(raw, &records[i])
+	}
+	result := check(records)
+	failures := failuresByRecord(result)
+
+	decodeFailures := 0
+	entities := reflect.MakeSlice(reflect.SliceOf(modelType), 0, len(raws))
+	for i, raw := range raws {
+		entity := reflect.New(modelType)
+		if err := decodeJSON(raw, entity.Interface()); err != nil {
+			failures[i] = append(failures[i], quality.Failure{Rule: decodeRule, Message: err.Error()})
+			decodeFailures++
+		}
+		if len(failures[i]) > 0 {
+			input.RejectRecord(raw, failures[i]...)
+			continue
+		}
+		entities = reflect.Append(entities, entity.Elem())
+	}
+
+	input.SetRecords(len(raws))
+	input.ruleResults = result.Rules
+	if decodeFailures > 0 {
+		input.ruleResults = append(input.ruleResults, quality.RuleResult{Rule: decodeRule, Failed: decodeFailures})
+	}
+	return entities, nil
+}
+
+// checkEntities checks the entities of a custom decoder through their json, the entities failing the rules are
+// rejected as they were decoded
+func checkEntities(input *TransformInput, modelType reflect.Type, decode DecodeFunc, check func(records []interface{}) quality.Result) (reflect.Value, error) {
+	decoded := reflect.New(reflect.SliceOf(modelType))
+	if err := decode(input.Content, decoded.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	content, err := json.Marshal(decoded.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	var records []interface{}
+	if err := decodeJSON(content, &records); err != nil {
+		return reflect.Value{}, err
+	}
+	result := check(records)
+	failures := failuresByRecord(result)
+
+	entities := reflect.MakeSlice(reflect.SliceOf(modelType), 0, decoded.Elem().Len())
+	for i := 0; i < decoded.Elem().Len(); i++ {
+		if len(failures[i]) > 0 {
+			input.RejectRecord(decoded.Elem().Index(i).Interface(), failures[i]...)
+			continue
+		}
+		entities = reflect.Append(entities, decoded.Elem().Index(i))
+	}
+
+	input.SetRecords(decoded.Elem().Len())
+	input.ruleResults = result.Rules
+	return entities, nil
+}
+
+func failuresByRecord(result quality.Result) map[int][]quality.Failure {
+	failures := map[int][]quality.Failure{}
+	for _, reject := range result.Rejects {
+		failures[reject.Index] = reject.Failures
+	}
+	return failures
+}
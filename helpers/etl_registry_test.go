@@ -0,0 +1,360 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/config"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/mapping"
+	"github.com/anhamdan/etl-base/pipeline"
+	"github.com/anhamdan/etl-base/quality"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type registryEntity struct {
+	ID    int    `json:"id"`
+	Value string `json:"value"`
+}
+
+var registryMapping = mapping.Spec{Fields: []mapping.Field{
+	{Target: "key", Source: "$.id", Type: "string", Required: true},
+	{Target: "value", Expression: `upper(coalesce($.value, "none"))`},
+}}
+
+var maxRejected = 1
+
+var registryQuality = quality.Spec{
+	Rules: []quality.Rule{
+		{Field: "$.id", Check: quality.Unique},
+		{Field: "$.value", Check: quality.NotNull},
+	},
+	Thresholds: quality.Thresholds{MaxRejected: &maxRejected},
+}
+
+func init() {
+	RegisterEtl(Etl{
+		Name:   "Registry-Test",
+		Config: config.Config{AWSConfig: config.AWSConfig{Region: "eu-west-1"}},
+		Model:  registryEntity{},
+	})
+	RegisterEtl(Etl{
+		Name:  "registry-transform",
+		Model: registryEntity{},
+		Transform: func(input *TransformInput, entities interface{}) (interface{}, error) {
+			kept := []registryEntity{}
+			for _, entity := range entities.([]registryEntity) {
+				if entity.Value == "" {
+					input.Reject("missing value")
+					continue
+				}
+				kept = append(kept, entity)
+			}
+			return kept, nil
+		},
+	})
+	RegisterEtl(Etl{
+		Name:    "registry-mapping",
+		Mapping: &registryMapping,
+	})
+	RegisterEtl(Etl{
+		Name:    "registry-model-mapping",
+		Model:   registryEntity{},
+		Mapping: &registryMapping,
+	})
+	RegisterEtl(Etl{
+		Name:    "registry-quality",
+		Model:   registryEntity{},
+		Quality: &registryQuality,
+	})
+	RegisterEtl(Etl{
+		Name:  "registry-quality-decode",
+		Model: registryEntity{},
+		Decode: func(content []byte, entities interface{}) error {
+			return json.Unmarshal(content, entities)
+		},
+		Quality: &registryQuality,
+	})
+	RegisterEtl(Etl{
+		Name:  "registry-pipeline",
+		Model: registryEntity{},
+		Transform: RecordTransform(pipeline.Then(
+			pipeline.Filter(func(entity registryEntity) bool { return entity.Value != "" }),
+			pipeline.Map(func(entity registryEntity) (string, error) { return fmt.Sprintf("%d:%s", entity.ID, entity.Value), nil }),
+		)),
+	})
+}
+
+func TestLookupEtl(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expectedError error
+	}{
+		{
+			name:  "Success when looking up a registered etl with another case",
+			input: "registry-TEST",
+		},
+		{
+			name:          "Fail when no etl is registered for the data source",
+			input:         "unknown",
+			expectedError: etlerrors.New(etlerrors.ErrInvalidEvent, `no etl registered for data source "unknown", registered: `+strings.Join(RegisteredEtls(), ", "), nil),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		etl, err := LookupEtl(test.input) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		if test.expectedError == nil {
+			assert.Equal(t, "Registry-Test", etl.Name)
+		}
+	}
+}
+
+func TestRegisterEtl(t *testing.T) {
+	fmt.Println("name: Success when the defaults of the etl are registered in the config")
+
+	cfg, err := config.Build(config.Options{Type: "registry-test"}) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, "eu-west-1", cfg.AWSConfig.Region)
+
+	fmt.Println("name: Success when the quality rules of the etl are compiled when it is registered")
+
+	etl, err := LookupEtl("registry-quality")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, etl.check)
+
+	fmt.Println("name: Fail when registering an etl twice")
+
+	assert.Panics(t, func() { RegisterEtl(Etl{Name: "REGISTRY-TEST", Model: registryEntity{}}) }) //<--- function under test
+	assert.Panics(t, func() { RegisterEtl(Etl{Model: registryEntity{}}) })                        //<--- function under test
+
+	fmt.Println("name: Fail when registering an etl with an invalid mapping")
+
+	assert.Panics(t, func() { RegisterEtl(Etl{Name: "registry-invalid-mapping", Mapping: &mapping.Spec{}}) }) //<--- function under test
+}
+
+func TestEtlTransformFunc(t *testing.T) {
+	tests := []struct {
+		name             string
+		etl              string
+		content          string
+		expectedEntities interface{}
+		expectedRecords  int
+		expectedError    error
+	}{
+		{
+			name:             "Success when decoding a json array of the model",
+			etl:              "registry-test",
+			content:          `[{"id": 1, "value": "a"}, {"id": 2}]`,
+			expectedEntities: []registryEntity{{ID: 1, Value: "a"}, {ID: 2}},
+			expectedRecords:  2,
+		},
+		{
+			name:             "Success when the transform of the etl rejects records",
+			etl:              "registry-transform",
+			content:          `[{"id": 1, "value": "a"}, {"id": 2}]`,
+			expectedEntities: []registryEntity{{ID: 1, Value: "a"}},
+			expectedRecords:  2,
+		},
+		{
+			name:             "Success when the transform of the etl is a pipeline of per record functions",
+			etl:              "registry-pipeline",
+			content:          `[{"id": 1, "value": "a"}, {"id": 2}, {"id": 3, "value": "c"}]`,
+			expectedEntities: []string{"1:a", "3:c"},
+			expectedRecords:  3,
+		},
+		{
+			name:             "Success when the etl maps the json objects with its mapping spec",
+			etl:              "registry-mapping",
+			content:          `[{"id": 1, "value": "a"}, {"id": 2}]`,
+			expectedEntities: []mapping.Record{{{Name: "key", Value: "1"}, {Name: "value", Value: "A"}}, {{Name: "key", Value: "2"}, {Name: "value", Value: "NONE"}}},
+			expectedRecords:  2,
+		},
+		{
+			name:             "Success when the etl maps its model with its mapping spec",
+			etl:              "registry-model-mapping",
+			content:          `[{"id": 1, "value": "b"}]`,
+			expectedEntities: []mapping.Record{{{Name: "key", Value: "1"}, {Name: "value", Value: "B"}}},
+			expectedRecords:  1,
+		},
+		{
+			name:          "Fail when a record does not match the mapping spec",
+			etl:           "registry-mapping",
+			content:       `[{"value": "a"}]`,
+			expectedError: errors.New("failed to map the field key, error: the value is required"),
+		},
+		{
+			name:             "Success when the records failing the quality rules or the model are rejected",
+			etl:              "registry-quality",
+			content:          `[{"id": 1, "value": "a"}, {"id": 1, "value": "b"}, {"id": 2}, {"id": "3", "value": "c"}]`,
+			expectedEntities: []registryEntity{{ID: 1, Value: "a"}},
+			expectedRecords:  4,
+		},
+		{
+			name:             "Success when the records of a custom decoder failing the quality rules are rejected",
+			etl:              "registry-quality-decode",
+			content:          `[{"id": 1, "value": "a"}, {"id": 1, "value": "b"}]`,
+			expectedEntities: []registryEntity{{ID: 1, Value: "a"}},
+			expectedRecords:  2,
+		},
+		{
+			name:          "Fail when the content does not match the model",
+			etl:           "registry-test",
+			content:       `{"id": 1}`,
+			expectedError: errors.New("failed to decode s3://landing/a.json as helpers.registryEntity, error: json: cannot unmarshal object into Go value of type []helpers.registryEntity"),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		etl, err := LookupEtl(test.etl)
+		assert.Nil(t, err)
+		input := &TransformInput{File: "s3://landing/a.json", Content: []byte(test.content)}
+
+		entities, err := etl.TransformFunc()(input) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		if test.expectedError == nil {
+			assert.Equal(t, test.expectedEntities, entities)
+			assert.Equal(t, test.expectedRecords, input.recordCount(0))
+		}
+	}
+}
+
+func TestEtlTransformFuncRejects(t *testing.T) {
+	fmt.Println("name: Success when the rejected records keep their content and the failures of every rule")
+
+	etl, err := LookupEtl("registry-quality")
+	assert.Nil(t, err)
+	input := &TransformInput{File: "s3://landing/a.json", Content: []byte(`[{"id": 1, "value": "a"}, {"id": 1}, {"id": "2"}]`)}
+
+	_, err = etl.TransformFunc()(input) //<--- function under test
+
+	assert.Nil(t, err)
+	content, _ := json.Marshal(input.rejects)
+	assert.JSONEq(t, `[
+		{"record": {"id": 1}, "failures": [
+			{"rule": "unique $.id", "message": "1 is a duplicate"},
+			{"rule": "notNull $.value", "message": "the value is null"}
+		]},
+		{"record": {"id": "2"}, "failures": [
+			{"rule": "notNull $.value", "message": "the value is null"},
+			{"rule": "decode", "message": "json: cannot unmarshal string into Go struct field registryEntity.id of type int"}
+		]}
+	]`, string(content))
+	assert.Equal(t, map[string]int{"unique $.id": 1, "notNull $.value": 2, "decode": 1}, input.rejectReasons)
+	assert.Equal(t, []quality.RuleResult{{Rule: "unique $.id", Failed: 1}, {Rule: "notNull $.value", Failed: 2}, {Rule: "decode", Failed: 1}}, input.ruleResults)
+}
+
+func TestEtlTransformFuncLargeIds(t *testing.T) {
+	tests := []struct {
+		name string
+		etl  string
+	}{
+		{
+			name: "Success when the records of the default decoder with ids above 2^53 are not duplicates",
+			etl:  "registry-quality",
+		},
+		{
+			name: "Success when the entities of a custom decoder with ids above 2^53 are not duplicates",
+			etl:  "registry-quality-decode",
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		etl, err := LookupEtl(test.etl)
+		assert.Nil(t, err)
+		input := &TransformInput{File: "s3://landing/a.json", Content: []byte(`[{"id": 9007199254740992, "value": "a"}, {"id": 9007199254740993, "value": "b"}]`)}
+
+		entities, err := etl.TransformFunc()(input) //<--- function under test
+
+		assert.Nil(t, err)
+		assert.Equal(t, []registryEntity{{ID: 9007199254740992, Value: "a"}, {ID: 9007199254740993, Value: "b"}}, entities)
+		assert.Empty(t, input.rejects)
+	}
+}
+
+func TestProcessEventWithQualityRules(t *testing.T) {
+	fmt.Println("name: Success when the rejected records are written to the rejects file of the job")
+
+	store := newObjectStoreMock()
+	store.objects["registry/a.json"] = []byte(`[{"id": 1, "value": "a"}, {"id": 2}]`)
+	landingZone := NewLandingZoneHelper(store)
+	loadingZone := NewLoadingZoneHelper(store, LoadingZoneConfig{S3Bucket: "loading", LZHelperEnabled: true})
+	runtime := NewEtlRuntime(nil, landingZone, loadingZone, NewWFMHelper(nil, nil, WorkflowManagerConfig{}), nil)
+	event := &ManagerEvent{
+		ImportJobID: "456",
+		ProcessID:   "789",
+		DataSource:  "registry-quality",
+		InputFiles:  []string{"s3://landing/registry/a.json"},
+	}
+
+	outputEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s3://loading/456/a.json"}, outputEvent.OutputFiles)
+	assert.Equal(t, "s3://loading/456/_rejects/a.json", outputEvent.InputStats[0].RejectsFile)
+	assert.Equal(t, []quality.RuleResult{{Rule: "unique $.id", Failed: 0}, {Rule: "notNull $.value", Failed: 1}}, outputEvent.InputStats[0].RuleResults)
+	assert.Contains(t, string(store.objects["456/_rejects/a.json"]), `"message": "the value is null"`)
+
+	fmt.Println("name: Fail when the rejected records are over the thresholds, nothing is committed")
+
+	store = newObjectStoreMock()
+	store.objects["registry/a.json"] = []byte(`[{"id": 1}, {"id": 2}]`)
+	landingZone = NewLandingZoneHelper(store)
+	loadingZone = NewLoadingZoneHelper(store, LoadingZoneConfig{S3Bucket: "loading", LZHelperEnabled: true})
+	runtime = NewEtlRuntime(nil, landingZone, loadingZone, NewWFMHelper(nil, nil, WorkflowManagerConfig{}), nil)
+
+	_, err = runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Equal(t, etlerrors.New(etlerrors.ErrInvalidEvent, "the event failed its quality thresholds", errors.New("2 of 2 records were rejected, more than the 1 allowed")), err)
+	assert.NotContains(t, store.objects, "456/_SUCCESS")
+}
+
+func TestRecordTransform(t *testing.T) {
+	fmt.Println("name: Fail when the entities are not a slice of the input of the pipeline")
+
+	transform := RecordTransform(pipeline.Map(func(entity registryEntity) (int, error) { return entity.ID, nil }))
+
+	_, err := transform(&TransformInput{File: "s3://landing/a.json"}, []int{1}) //<--- function under test
+
+	assert.Equal(t, errors.New("failed to transform s3://landing/a.json, the entities are []int instead of []helpers.registryEntity"), err)
+}
+
+func TestProcessEventWithRegisteredEtl(t *testing.T) {
+	fmt.Println("name: Success when the runtime picks the etl from the data source of the event")
+
+	store := newObjectStoreMock()
+	store.objects["registry/a.json"] = []byte(`[{"id": 1, "value": "a"}, {"id": 2}]`)
+	landingZone := NewLandingZoneHelper(store)
+	loadingZone := NewLoadingZoneHelper(store, LoadingZoneConfig{S3Bucket: "loading", LZHelperEnabled: true})
+	runtime := NewEtlRuntime(nil, landingZone, loadingZone, NewWFMHelper(nil, nil, WorkflowManagerConfig{}), nil)
+	event := &ManagerEvent{
+		ImportJobID: "456",
+		ProcessID:   "789",
+		DataSource:  "Registry-Transform",
+		InputFiles:  []string{"s3://landing/registry/a.json"},
+	}
+
+	outputEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s3://loading/456/a.json"}, outputEvent.OutputFiles)
+	assert.Equal(t, 1, outputEvent.InputStats[0].RejectedRecords)
+
+	fmt.Println("name: Fail when no etl is registered for the data source of the event")
+
+	event.DataSource = "unknown"
+	_, err = runtime.ProcessEvent(event) //<--- function under test
+
+	assert.NotNil(t, err)
+}
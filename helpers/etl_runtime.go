@@ -0,0 +1,655 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"github.com/anhamdan/etl-base/constants"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/health"
+	"github.com/anhamdan/etl-base/logging"
+	"github.com/anhamdan/etl-base/metrics"
+	"github.com/anhamdan/etl-base/quality"
+	"github.com/anhamdan/etl-base/tracing"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"path"
+	"time"
+)
+
+// TransformInput is the content of a single landing zone file handed to the ETL specific transform
+type TransformInput struct {
+	Event   *ManagerEvent
+	File    string
+	Content []byte
+
+	ctx           context.Context
+	records       *int
+	rejected      int
+	rejectReasons map[string]int
+	rejects       []RejectedRecord
+	ruleResults   []quality.RuleResult
+	warnings      []string
+}
+
+// RejectedRecord is a line of the rejects file of an input file
+type RejectedRecord struct {
+	Record   interface{}       `json:"record"`
+	Failures []quality.Failure `json:"failures"`
+}
+
+// TransformFunc converts an input file into the entities that are inserted in the loading zone
+type TransformFunc func(input *TransformInput) (interface{}, error)
+
+// Context is the context of the transform span, it is done when the event is abandoned
+func (input *TransformInput) Context() context.Context {
+	if input.ctx == nil {
+		return context.Background()
+	}
+	return input.ctx
+}
+
+// SetRecords reports how many records were decoded from the input file. When it is not called the input records
+// are the inserted rows plus the rejected records
+func (input *TransformInput) SetRecords(records int) {
+	input.records = &records
+}
+
+// Reject reports a record of the input file that was left out of the output
+func (input *TransformInput) Reject(reason string) {
+	if input.rejectReasons == nil {
+		input.rejectReasons = map[string]int{}
+	}
+	input.rejected++
+	input.rejectReasons[reason]++
+}
+
+// RejectRecord reports a record of the input file that was left out of the output because of failures, the record
+// is written to the rejects file of the input file with them and counted once under the rule of every failure
+func (input *TransformInput) RejectRecord(record interface{}, failures ...quality.Failure) {
+	if input.rejectReasons == nil {
+		input.rejectReasons = map[string]int{}
+	}
+	input.rejected++
+	for _, failure := range failures {
+		input.rejectReasons[failure.Rule]++
+	}
+	input.rejects = append(input.rejects, RejectedRecord{Record: record, Failures: failures})
+}
+
+func (input *TransformInput) Warn(warning string) {
+	input.warnings = append(input.warnings, warning)
+}
+
+func (input *TransformInput) recordCount(insertedRows int) int {
+	if input.records != nil {
+		return *input.records
+	}
+	return insertedRows + input.rejected
+}
+
+type EtlRuntime interface {
+	ProcessEvent(event *ManagerEvent) (*ManagerOutputEvent, error)
+	HandleEvent(event *ManagerEvent) error
+}
+
+type etlRuntime struct {
+	awsSession  *session.Session
+	landingZone LandingZoneHelper
+	loadingZone LoadingZoneHelper
+	wfmHelper   WorkflowManagerHelper
+	transform   TransformFunc
+	idempotency IdempotencyStore
+	checkpoints CheckpointStore
+	// landingZoneFor returns the landing zone read with the role of an event
+	landingZoneFor func(roleArn string) LandingZoneHelper
+	logger         logging.Logger
+	metrics        metrics.Metrics
+	health         health.Monitor
+	thresholds     quality.Thresholds
+}
+
+// NewEtlRuntime runs the transform on every event. With a nil transform, the ETL registered for the data source of
+// each event is used, so one runtime can host several ETL types
+func NewEtlRuntime(awsSession *session.Session, landingZone LandingZoneHelper, loadingZone LoadingZoneHelper, wfmHelper WorkflowManagerHelper, transform TransformFunc) *etlRuntime {
+	return &etlRuntime{
+		awsSession:  awsSession,
+		landingZone: landingZone,
+		loadingZone: loadingZone,
+		wfmHelper:   wfmHelper,
+		transform:   transform,
+		logger:      logging.Default(),
+		metrics:     metrics.Default(),
+		health:      health.Default(),
+	}
+}
+
+// SetLogger writes the log lines of every event on logger, with the correlation fields of the event added
+func (rt *etlRuntime) SetLogger(logger logging.Logger) {
+	rt.logger = logger
+}
+
+// SetMetrics records the values of every event on m, labeled with the data source of the event
+func (rt *etlRuntime) SetMetrics(m metrics.Metrics) {
+	rt.metrics = m
+}
+
+// SetHealth tracks the events in flight on m, with the last error of the ones that failed
+func (rt *etlRuntime) SetHealth(m health.Monitor) {
+	rt.health = m
+}
+
+// SetQualityThresholds fails the events with more rejected records when the runtime was given a transform, the
+// runtimes picking the ETL of the events use the thresholds of its quality rules
+func (rt *etlRuntime) SetQualityThresholds(thresholds quality.Thresholds) {
+	rt.thresholds = thresholds
+}
+
+// SetIdempotencyStore enables skipping the input files that were already committed for the same job and process
+func (rt *etlRuntime) SetIdempotencyStore(store IdempotencyStore) {
+	rt.idempotency = store
+}
+
+// SetCheckpointStore enables resuming a failed event from its first unfinished input file. While enabled, the files
+// staged by a failed run are kept in the loading zone instead of being cleaned up
+func (rt *etlRuntime) SetCheckpointStore(store CheckpointStore) {
+	rt.checkpoints = store
+}
+
+// SetLandingZoneProvider reads the input files of the events with a RoleArn through the landing zone returned by
+// provider for that role, like a landing zone in another account. Events without a RoleArn use the default one
+func (rt *etlRuntime) SetLandingZoneProvider(provider func(roleArn string) LandingZoneHelper) {
+	rt.landingZoneFor = provider
+}
+
+// FailureAction is what the runtime does with an event it could not process
+type FailureAction int
+
+const (
+	// RetryEvent leaves the message in the queue, it is delivered again after its visibility timeout and resumes from
+	// its checkpoint
+	RetryEvent FailureAction = iota
+	// FailTask sends the failure to the step function of the event and deletes the message
+	FailTask
+	// DeadLetterEvent leaves the message to the redrive policy of the queue, which moves it to the dead letter queue
+	DeadLetterEvent
+)
+
+func (action FailureAction) String() string {
+	switch action {
+	case RetryEvent:
+		return "retry"
+	case FailTask:
+		return "fail_task"
+	default:
+		return "dead_letter"
+	}
+}
+
+// FailureActionFor retries the events failing with a retryable error. The permanent failures fail the task of the
+// event, or are dead lettered when the event has no task token to report them with
+func FailureActionFor(event *ManagerEvent, err error) FailureAction {
+	switch {
+	case etlerrors.Retryable(err):
+		return RetryEvent
+	case event.TaskToken != constants.EmptyString:
+		return FailTask
+	default:
+		return DeadLetterEvent
+	}
+}
+
+// HandleEvent processes the event and reports the output files to the workflow manager. A failed event is retried,
+// failed or dead lettered following FailureActionFor
+func (rt *etlRuntime) HandleEvent(event *ManagerEvent) (err error) {
+	finished := rt.health.EventStarted(health.Event{
+		ImportJobID: event.ImportJobID,
+		ProcessID:   event.ProcessID,
+		DataSource:  event.DataSource,
+		MessageID:   event.MessageID,
+	})
+	defer func() { finished(err) }()
+
+	stopHeartbeat := rt.wfmHelper.KeepInvisible(event.message)
+	outputEvent, err := rt.ProcessEvent(event)
+	stopHeartbeat()
+	if err != nil {
+		rt.handleFailure(event, err)
+		return err
+	}
+
+	_, span := tracing.Start(event.Context(), tracing.SendTaskSuccessSpan, EventAttributes(event)...)
+	err = rt.wfmHelper.SendEvent(outputEvent, rt.awsSession, event.RoleArn, event.TaskToken)
+	tracing.End(span, err)
+	if err != nil {
+		retryable := etlerrors.Retryable(err)
+		rt.eventLogger(event).Error("Could not send the output event to the workflow manager", logging.Err(err), logging.F("retryable", retryable))
+		// The outputs were committed, a redelivery returns them without processing the input files again. A
+		// permanent failure fails the task instead, so the step function does not wait for it until its timeout
+		switch {
+		case retryable:
+		case event.TaskToken != constants.EmptyString:
+			rt.failTask(event, err)
+		default:
+			rt.deleteMessage(event)
+		}
+		return err
+	}
+
+	rt.deleteMessage(event)
+	return nil
+}
+
+func (rt *etlRuntime) handleFailure(event *ManagerEvent, err error) {
+	action := FailureActionFor(event, err)
+	logger := rt.eventLogger(event)
+	logger.Error("Could not process the event", logging.Err(err), logging.F("action", action.String()))
+	if action == FailTask {
+		rt.failTask(event, err)
+	}
+}
+
+// failTask sends the failure to the step function of the event and deletes its message, unless the failure could not
+// be sent and can be sent again when the message is delivered again
+func (rt *etlRuntime) failTask(event *ManagerEvent, err error) {
+	logger := rt.eventLogger(event)
+	_, span := tracing.Start(event.Context(), tracing.SendTaskFailureSpan, EventAttributes(event)...)
+	sendErr := rt.wfmHelper.SendFailure(err, rt.awsSession, event.RoleArn, event.TaskToken)
+	tracing.End(span, sendErr)
+	if sendErr != nil {
+		logger.Error("Could not send the failure to the workflow manager", logging.Err(sendErr))
+		// The message is kept so the failure is sent again when it is delivered again
+		if etlerrors.Retryable(sendErr) {
+			return
+		}
+	}
+	rt.deleteMessage(event)
+}
+
+// deleteMessage removes the message of a settled event from the queue, events read from a local file have none
+func (rt *etlRuntime) deleteMessage(event *ManagerEvent) {
+	if event.message == nil {
+		return
+	}
+
+	if err := rt.wfmHelper.DeleteMessage(event.message); err != nil {
+		rt.eventLogger(event).Error("Could not delete the message from the queue", logging.Err(err))
+	}
+}
+
+// ProcessEvent transforms every input file of the event into the loading zone as a single job. Input files that
+// were completed by a previous delivery of the event are not processed again, their previous outputs are returned
+func (rt *etlRuntime) ProcessEvent(event *ManagerEvent) (*ManagerOutputEvent, error) {
+	startedAt := time.Now()
+	eventMetrics := rt.eventMetrics(event)
+	ctx, span := tracing.Start(event.Context(), tracing.ProcessSpan, EventAttributes(event)...)
+	outputEvent, err := rt.processEvent(ctx, event, eventMetrics)
+	tracing.End(span, err)
+
+	result := metrics.Success
+	if err != nil {
+		result = metrics.Failure
+	}
+	eventMetrics.Count(metrics.EventsProcessed, 1, metrics.L(metrics.Result, result))
+	eventMetrics.Observe(metrics.EventDuration, time.Since(startedAt).Seconds(), metrics.L(metrics.Result, result))
+	return outputEvent, err
+}
+
+func (rt *etlRuntime) processEvent(ctx context.Context, event *ManagerEvent, eventMetrics metrics.Metrics) (*ManagerOutputEvent, error) {
+	transform, err := rt.transformFor(event)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInputFiles(event); err != nil {
+		return nil, err
+	}
+
+	logger := rt.eventLogger(event)
+	logger.Info("Processing the event", logging.F("inputFiles", len(event.InputFiles)))
+
+	stats := NewStatsCollector()
+	landingZone := rt.eventLandingZone(event)
+	landingZone.SetStatsCollector(stats)
+	landingZone.SetLogger(logger)
+	landingZone.SetMetrics(eventMetrics)
+	rt.loadingZone.SetStatsCollector(stats)
+	rt.loadingZone.SetLogger(logger)
+	rt.loadingZone.SetMetrics(eventMetrics)
+
+	records, pending, err := rt.completedUnits(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if pending == 0 && len(event.InputFiles) > 0 {
+		logger.Info("All input files were already processed, returning the previous outputs")
+		stats.Warn("all input files were already processed, the previous outputs are returned")
+		for _, inputFile := range event.InputFiles {
+			restoreInput(stats, inputFile, records[inputFile].OutputFiles, records[inputFile].Stats)
+		}
+		outputEvent := &ManagerOutputEvent{OutputFiles: collectOutputFiles(event, records, nil)}
+		stats.Fill(outputEvent)
+		return outputEvent, nil
+	}
+
+	checkpoint, err := rt.loadCheckpoint(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rt.loadingZone.Begin(event); err != nil {
+		return nil, err
+	}
+	if err := rt.loadingZone.Restore(checkpoint.Staged); err != nil {
+		rt.fail(event, err)
+		return nil, err
+	}
+
+	outputs := map[string][]string{}
+	for _, file := range checkpoint.Files {
+		outputs[file.InputFile] = file.OutputFiles
+		restoreInput(stats, file.InputFile, file.OutputFiles, file.Stats)
+	}
+
+	for _, inputFile := range event.InputFiles {
+		if record, ok := records[inputFile]; ok {
+			logger.Info("Skipping the input file, it was already processed", logging.F("file", inputFile))
+			stats.Warn(fmt.Sprintf("input file %s was already processed, its previous outputs are returned", inputFile))
+			restoreInput(stats, inputFile, record.OutputFiles, record.Stats)
+			continue
+		}
+		if _, ok := outputs[inputFile]; ok {
+			logger.Info("Resuming the job, the input file was already staged", logging.F("file", inputFile))
+			continue
+		}
+
+		outputFile, err := rt.processFile(ctx, event, inputFile, landingZone, transform, stats, eventMetrics)
+		if err != nil {
+			rt.fail(event, err)
+			return nil, err
+		}
+		outputs[inputFile] = []string{}
+		if outputFile != constants.EmptyString {
+			outputs[inputFile] = append(outputs[inputFile], outputFile)
+		}
+
+		rt.saveCheckpoint(event, checkpoint, CheckpointFile{InputFile: inputFile, OutputFiles: outputs[inputFile], Stats: stats.Input(inputFile)})
+	}
+
+	if err := rt.checkThresholds(event, stats); err != nil {
+		rt.fail(event, err)
+		return nil, err
+	}
+
+	_, commitSpan := tracing.Start(ctx, tracing.LoadingZoneCommitSpan)
+	_, err = rt.loadingZone.Commit()
+	tracing.End(commitSpan, err)
+	if err != nil {
+		rt.fail(event, err)
+		return nil, err
+	}
+
+	rt.clearCheckpoint(event)
+	rt.recordUnits(event, outputs, stats)
+
+	outputEvent := &ManagerOutputEvent{OutputFiles: collectOutputFiles(event, records, outputs)}
+	stats.Fill(outputEvent)
+	logger.Info("Processed the event", logging.F("outputFiles", len(outputEvent.OutputFiles)), logging.F("durationMs", outputEvent.DurationMs))
+	return outputEvent, nil
+}
+
+// processFile traces the read, the transform and the write of the input file as children of the span of the event
+func (rt *etlRuntime) processFile(ctx context.Context, event *ManagerEvent, inputFile string, landingZone LandingZoneHelper, transform TransformFunc, stats *StatsCollector, eventMetrics metrics.Metrics) (string, error) {
+	bucket, key, err := parseS3Path(inputFile)
+	if err != nil {
+		return constants.EmptyString, err
+	}
+
+	_, readSpan := tracing.Start(ctx, tracing.LandingZoneReadSpan, tracing.File.String(inputFile))
+	content, err := landingZone.Read(bucket, key)
+	readSpan.SetAttributes(tracing.Bytes.Int(len(content)))
+	tracing.End(readSpan, err)
+	if err != nil {
+		return constants.EmptyString, err
+	}
+
+	transformCtx, transformSpan := tracing.Start(ctx, tracing.TransformSpan, tracing.File.String(inputFile))
+	input := &TransformInput{Event: event, File: inputFile, Content: content, ctx: transformCtx}
+	startedAt := time.Now()
+	entities, err := transform(input)
+	tracing.End(transformSpan, err)
+	if err != nil {
+		return constants.EmptyString, err
+	}
+	transformDuration := time.Since(startedAt)
+
+	_, writeSpan := tracing.Start(ctx, tracing.LoadingZoneWriteSpan, tracing.File.String(outputName(key)), tracing.Records.Int(countRows(entities)))
+	outputFile, err := rt.loadingZone.Insert(entities, outputName(key))
+	tracing.End(writeSpan, err)
+	if err != nil {
+		return constants.EmptyString, err
+	}
+
+	rejectsFile, err := rt.writeRejects(ctx, input, key)
+	if err != nil {
+		return constants.EmptyString, err
+	}
+
+	records := input.recordCount(countRows(entities))
+	stats.RecordTransform(inputFile, records, input.rejected, input.rejectReasons, input.warnings, transformDuration)
+	stats.RecordQuality(inputFile, input.ruleResults, rejectsFile)
+	eventMetrics.Count(metrics.RecordsDecoded, float64(records))
+	eventMetrics.Count(metrics.RecordsRejected, float64(input.rejected))
+	if outputFile != constants.EmptyString {
+		stats.RecordLineage(outputFile, inputFile)
+	}
+	if rejectsFile != constants.EmptyString {
+		stats.RecordLineage(rejectsFile, inputFile)
+	}
+	return outputFile, nil
+}
+
+// writeRejects writes the records rejected from the input file to the rejects directory of the job, under the name of
+// the input file. The loading zone lists it in the rejects of the manifest instead of its files. It returns the path of the rejects file, empty when no record was rejected with RejectRecord
+func (rt *etlRuntime) writeRejects(ctx context.Context, input *TransformInput, key string) (string, error) {
+	if len(input.rejects) == 0 {
+		return constants.EmptyString, nil
+	}
+
+	_, span := tracing.Start(ctx, tracing.LoadingZoneWriteSpan, tracing.File.String(rejectsName(key)), tracing.Records.Int(len(input.rejects)))
+	rejectsFile, err := rt.loadingZone.Insert(input.rejects, rejectsName(key))
+	tracing.End(span, err)
+	return rejectsFile, err
+}
+
+// checkThresholds fails the event when the records rejected from its input files are over the quality thresholds of
+// its ETL
+func (rt *etlRuntime) checkThresholds(event *ManagerEvent, stats *StatsCollector) error {
+	thresholds := rt.thresholds
+	if rt.transform == nil {
+		if etl, err := LookupEtl(event.DataSource); err == nil && etl.Quality != nil {
+			thresholds = etl.Quality.Thresholds
+		}
+	}
+
+	records, rejected := stats.Totals()
+	if err := thresholds.Check(records, rejected); err != nil {
+		return etlerrors.New(etlerrors.ErrInvalidEvent, "the event failed its quality thresholds", err)
+	}
+	return nil
+}
+
+func (rt *etlRuntime) eventLogger(event *ManagerEvent) logging.Logger {
+	return rt.logger.With(EventFields(event)...)
+}
+
+func (rt *etlRuntime) eventMetrics(event *ManagerEvent) metrics.Metrics {
+	return rt.metrics.With(metrics.L(metrics.DataSource, event.DataSource))
+}
+
+func (rt *etlRuntime) eventLandingZone(event *ManagerEvent) LandingZoneHelper {
+	if rt.landingZoneFor == nil || event.RoleArn == "" {
+		return rt.landingZone
+	}
+	return rt.landingZoneFor(event.RoleArn)
+}
+
+func (rt *etlRuntime) transformFor(event *ManagerEvent) (TransformFunc, error) {
+	if rt.transform != nil {
+		return rt.transform, nil
+	}
+
+	etl, err := LookupEtl(event.DataSource)
+	if err != nil {
+		return nil, err
+	}
+	return etl.TransformFunc(), nil
+}
+
+// completedUnits returns the records of the input files that were already processed and how many are still pending
+func (rt *etlRuntime) completedUnits(event *ManagerEvent) (map[string]IdempotencyRecord, int, error) {
+	records := map[string]IdempotencyRecord{}
+	if rt.idempotency == nil {
+		return records, len(event.InputFiles), nil
+	}
+
+	pending := 0
+	for _, inputFile := range event.InputFiles {
+		record, err := rt.idempotency.Get(unitKey(event, inputFile))
+		if err != nil {
+			return nil, 0, err
+		}
+		if record == nil {
+			pending++
+			continue
+		}
+		records[inputFile] = *record
+	}
+	return records, pending, nil
+}
+
+// recordUnits is only called once the job is committed, a failure to record means the unit is processed again
+func (rt *etlRuntime) recordUnits(event *ManagerEvent, outputs map[string][]string, stats *StatsCollector) {
+	if rt.idempotency == nil {
+		return
+	}
+
+	for inputFile, outputFiles := range outputs {
+		record := IdempotencyRecord{
+			IdempotencyKey: unitKey(event, inputFile),
+			OutputFiles:    outputFiles,
+			Stats:          stats.Input(inputFile),
+			CompletedAt:    time.Now().UTC(),
+		}
+		if err := rt.idempotency.Put(record); err != nil {
+			rt.eventLogger(event).Warn("Could not record the input file as processed", logging.F("file", inputFile), logging.Err(err))
+		}
+	}
+}
+
+// loadCheckpoint returns the progress of a previous run of the event, or an empty checkpoint to start from
+func (rt *etlRuntime) loadCheckpoint(event *ManagerEvent) (*Checkpoint, error) {
+	if rt.checkpoints != nil {
+		checkpoint, err := rt.checkpoints.Load(event.ImportJobID, event.ProcessID)
+		if err != nil {
+			return nil, err
+		}
+		if checkpoint != nil {
+			return checkpoint, nil
+		}
+	}
+	return &Checkpoint{ImportJobID: event.ImportJobID, ProcessID: event.ProcessID}, nil
+}
+
+// saveCheckpoint failures are only logged, the input file is then processed again when the event is redelivered
+func (rt *etlRuntime) saveCheckpoint(event *ManagerEvent, checkpoint *Checkpoint, file CheckpointFile) {
+	if rt.checkpoints == nil {
+		return
+	}
+
+	checkpoint.Files = append(checkpoint.Files, file)
+	checkpoint.Staged = rt.loadingZone.Staged()
+	checkpoint.UpdatedAt = time.Now().UTC()
+
+	if err := rt.checkpoints.Save(*checkpoint); err != nil {
+		rt.eventLogger(event).Warn("Could not save the checkpoint after the input file", logging.F("file", file.InputFile), logging.Err(err))
+	}
+}
+
+func (rt *etlRuntime) clearCheckpoint(event *ManagerEvent) {
+	if rt.checkpoints == nil {
+		return
+	}
+
+	if err := rt.checkpoints.Delete(event.ImportJobID, event.ProcessID); err != nil {
+		rt.eventLogger(event).Warn("Could not delete the checkpoint", logging.Err(err))
+	}
+}
+
+// fail keeps the staged files when the event is retried and can be resumed from its checkpoint. Otherwise they are
+// cleaned up, with the checkpoint of a permanent failure
+func (rt *etlRuntime) fail(event *ManagerEvent, err error) {
+	if rt.checkpoints != nil && etlerrors.Retryable(err) {
+		rt.loadingZone.Suspend()
+		return
+	}
+
+	if abortErr := rt.loadingZone.Abort(); abortErr != nil {
+		rt.eventLogger(event).Warn("Could not clean up the staged files", logging.Err(abortErr))
+	}
+	rt.clearCheckpoint(event)
+}
+
+// outputName is the name of the output file of an input file, in the prefix of the job
+func outputName(key string) string {
+	return path.Base(key)
+}
+
+// rejectsName is the name of the rejects file of an input file, in the prefix of the job
+func rejectsName(key string) string {
+	return path.Join(constants.RejectsDirectory, outputName(key))
+}
+
+// checkInputFiles fails the events with input files of the same name in different directories, their outputs and
+// their rejects files would overwrite each other in the prefix of the job
+func checkInputFiles(event *ManagerEvent) error {
+	inputFiles := map[string]string{}
+	for _, inputFile := range event.InputFiles {
+		// rejectsName is derived from outputName, so checking the output names covers the rejects files
+		name := outputName(inputFile)
+		if other, ok := inputFiles[name]; ok && other != inputFile {
+			return etlerrors.New(etlerrors.ErrInvalidEvent, fmt.Sprintf("the input files %s and %s have the same output file %s", other, inputFile, name), nil)
+		}
+		inputFiles[name] = inputFile
+	}
+	return nil
+}
+
+// restoreInput reports an input file processed by an earlier run of the event with its statistics and lineage. The
+// records written before the statistics were kept have none, only their lineage is reported
+func restoreInput(stats *StatsCollector, inputFile string, outputFiles []string, inputStats InputFileStats) {
+	if inputStats.Path != constants.EmptyString {
+		stats.RestoreInput(inputStats)
+	}
+	for _, outputFile := range outputFiles {
+		stats.RecordLineage(outputFile, inputFile)
+	}
+	if inputStats.RejectsFile != constants.EmptyString {
+		stats.RecordLineage(inputStats.RejectsFile, inputFile)
+	}
+}
+
+func unitKey(event *ManagerEvent, inputFile string) IdempotencyKey {
+	return IdempotencyKey{ImportJobID: event.ImportJobID, ProcessID: event.ProcessID, InputFile: inputFile}
+}
+
+// collectOutputFiles lists the output files following the order of the input files of the event
+func collectOutputFiles(event *ManagerEvent, records map[string]IdempotencyRecord, outputs map[string][]string) []string {
+	outputFiles := []string{}
+	for _, inputFile := range event.InputFiles {
+		if record, ok := records[inputFile]; ok {
+			outputFiles = append(outputFiles, record.OutputFiles...)
+			continue
+		}
+		outputFiles = append(outputFiles, outputs[inputFile]...)
+	}
+	return outputFiles
+}
@@ -0,0 +1,610 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/health"
+	"github.com/anhamdan/etl-base/logging"
+	"github.com/anhamdan/etl-base/metrics"
+	"github.com/anhamdan/etl-base/quality"
+	"github.com/anhamdan/etl-base/sfnaws"
+	"github.com/anhamdan/etl-base/tracing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countingTransform struct {
+	calls  int
+	err    error
+	failOn string
+}
+
+func (transform *countingTransform) apply(input *TransformInput) (interface{}, error) {
+	transform.calls++
+	if transform.err != nil && (transform.failOn == "" || transform.failOn == input.File) {
+		return nil, transform.err
+	}
+
+	var entities []map[string]interface{}
+	err := json.Unmarshal(input.Content, &entities)
+	return entities, err
+}
+
+// settlementMock records what the runtime does with the message and the task of an event
+type settlementMock struct {
+	sqsClientMock
+	sfnClientMock
+	deleted  int
+	extended int
+	failures []string
+}
+
+func (mock *settlementMock) ChangeVisibility(msg *sqs.Message, timeout time.Duration) error {
+	mock.extended++
+	return nil
+}
+
+func (mock *settlementMock) DeleteMessage(msg *sqs.Message) error {
+	mock.deleted++
+	return nil
+}
+
+func (mock *settlementMock) SendTaskFailure(errorCode, cause, taskToken string, svc sfnaws.SFNMessageClient) error {
+	mock.failures = append(mock.failures, cause)
+	return nil
+}
+
+func newTestRuntime(store *objectStoreMock, transform *countingTransform) *etlRuntime {
+	landingZone := NewLandingZoneHelper(store)
+	loadingZone := NewLoadingZoneHelper(store, LoadingZoneConfig{S3Bucket: "loading", LZHelperEnabled: true})
+	wfmHelper := NewWFMHelper(nil, nil, WorkflowManagerConfig{})
+
+	return NewEtlRuntime(nil, landingZone, loadingZone, wfmHelper, transform.apply)
+}
+
+func TestProcessEvent(t *testing.T) {
+	store := newObjectStoreMock()
+	store.objects["analyst/a.json"] = []byte(`[{"id": 1}]`)
+	store.objects["analyst/b.json"] = []byte(`[{"id": 2}, {"id": 3}]`)
+	transform := &countingTransform{}
+	event := &ManagerEvent{
+		ImportJobID: "456",
+		ProcessID:   "789",
+		InputFiles:  []string{"s3://landing/analyst/a.json", "s3://landing/analyst/b.json"},
+	}
+
+	runtime := newTestRuntime(store, transform)
+	runtime.SetIdempotencyStore(NewMemoryIdempotencyStore())
+
+	outputEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s3://loading/456/a.json", "s3://loading/456/b.json"}, outputEvent.OutputFiles)
+	assert.Equal(t, 2, transform.calls)
+	assert.Contains(t, store.objects, "456/_SUCCESS")
+
+	replayedEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, outputEvent.OutputFiles, replayedEvent.OutputFiles)
+	assert.Equal(t, outputEvent.InputStats, replayedEvent.InputStats)
+	assert.Equal(t, outputEvent.Lineage, replayedEvent.Lineage)
+	assert.Equal(t, 1, len(replayedEvent.Warnings))
+	assert.Equal(t, 2, transform.calls)
+}
+
+func TestProcessEventStatistics(t *testing.T) {
+	store := newObjectStoreMock()
+	store.objects["analyst/a.json"] = []byte(`[{"id": 1}, {"id": 2}, {"id": null}]`)
+	event := &ManagerEvent{ImportJobID: "456", InputFiles: []string{"s3://landing/analyst/a.json"}}
+
+	transform := func(input *TransformInput) (interface{}, error) {
+		var entities []map[string]interface{}
+		if err := json.Unmarshal(input.Content, &entities); err != nil {
+			return nil, err
+		}
+
+		valid := []map[string]interface{}{}
+		for _, entity := range entities {
+			if entity["id"] == nil {
+				input.Reject("missing id")
+				continue
+			}
+			valid = append(valid, entity)
+		}
+		input.Warn("some warning")
+		return valid, nil
+	}
+
+	landingZone := NewLandingZoneHelper(store)
+	loadingZone := NewLoadingZoneHelper(store, LoadingZoneConfig{S3Bucket: "loading", LZHelperEnabled: true})
+	runtime := NewEtlRuntime(nil, landingZone, loadingZone, NewWFMHelper(nil, nil, WorkflowManagerConfig{}), transform)
+
+	outputEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(outputEvent.InputStats))
+	assert.Equal(t, "s3://landing/analyst/a.json", outputEvent.InputStats[0].Path)
+	assert.Equal(t, 3, outputEvent.InputStats[0].Records)
+	assert.Equal(t, 1, outputEvent.InputStats[0].RejectedRecords)
+	assert.Equal(t, map[string]int{"missing id": 1}, outputEvent.InputStats[0].RejectReasons)
+	assert.Equal(t, len(store.objects["analyst/a.json"]), outputEvent.InputStats[0].Bytes)
+	assert.Equal(t, []string{"some warning"}, outputEvent.InputStats[0].Warnings)
+	assert.Equal(t, 1, len(outputEvent.OutputStats))
+	assert.Equal(t, "s3://loading/456/a.json", outputEvent.OutputStats[0].Path)
+	assert.Equal(t, 2, outputEvent.OutputStats[0].Records)
+	assert.Equal(t, len(store.objects["456/a.json"]), outputEvent.OutputStats[0].Bytes)
+	assert.Equal(t, map[string][]string{"s3://loading/456/a.json": {"s3://landing/analyst/a.json"}}, outputEvent.Lineage)
+}
+
+func TestProcessEventOutputNames(t *testing.T) {
+	fmt.Println("name: Fail when two input files have the same name in different directories")
+
+	store := newObjectStoreMock()
+	store.objects["a/x.json"] = []byte(`[{"id": 1}]`)
+	store.objects["b/x.json"] = []byte(`[{"id": 2}]`)
+	transform := &countingTransform{}
+	event := &ManagerEvent{ImportJobID: "456", InputFiles: []string{"s3://landing/a/x.json", "s3://landing/b/x.json"}}
+
+	_, err := newTestRuntime(store, transform).ProcessEvent(event) //<--- function under test
+
+	assert.Equal(t, etlerrors.New(etlerrors.ErrInvalidEvent, "the input files s3://landing/a/x.json and s3://landing/b/x.json have the same output file x.json", nil), err)
+	assert.Equal(t, 0, transform.calls)
+	assert.NotContains(t, store.objects, "456/x.json")
+}
+
+func TestProcessEventQualityThresholds(t *testing.T) {
+	ratio := 0.4
+	tests := []struct {
+		name          string
+		content       string
+		expectedError error
+	}{
+		{
+			name:    "Success when the records rejected by the transform are under the thresholds of the runtime",
+			content: `[{"id": 1}, {"id": 2}, {"id": null}]`,
+		},
+		{
+			name:          "Fail when the records rejected by the transform are over the thresholds of the runtime",
+			content:       `[{"id": 1}, {"id": null}, {"id": null}]`,
+			expectedError: etlerrors.New(etlerrors.ErrInvalidEvent, "the event failed its quality thresholds", errors.New("2 of 3 records were rejected, more than the 40% allowed")),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		store := newObjectStoreMock()
+		store.objects["analyst/a.json"] = []byte(test.content)
+		event := &ManagerEvent{ImportJobID: "456", InputFiles: []string{"s3://landing/analyst/a.json"}}
+		transform := func(input *TransformInput) (interface{}, error) {
+			var entities []map[string]interface{}
+			if err := json.Unmarshal(input.Content, &entities); err != nil {
+				return nil, err
+			}
+
+			valid := []map[string]interface{}{}
+			for _, entity := range entities {
+				if entity["id"] == nil {
+					input.RejectRecord(entity, quality.Failure{Rule: "id", Message: "the id is missing"})
+					continue
+				}
+				valid = append(valid, entity)
+			}
+			return valid, nil
+		}
+		landingZone := NewLandingZoneHelper(store)
+		loadingZone := NewLoadingZoneHelper(store, LoadingZoneConfig{S3Bucket: "loading", LZHelperEnabled: true})
+		runtime := NewEtlRuntime(nil, landingZone, loadingZone, NewWFMHelper(nil, nil, WorkflowManagerConfig{}), transform)
+		runtime.SetQualityThresholds(quality.Thresholds{MaxRejectedRatio: &ratio})
+
+		outputEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		if test.expectedError == nil {
+			assert.Equal(t, map[string]int{"id": 1}, outputEvent.InputStats[0].RejectReasons)
+			assert.JSONEq(t, `[{"record": {"id": null}, "failures": [{"rule": "id", "message": "the id is missing"}]}]`, string(store.objects["456/_rejects/a.json"]))
+			assert.Equal(t, []string{"s3://landing/analyst/a.json"}, outputEvent.Lineage["s3://loading/456/_rejects/a.json"])
+		} else {
+			assert.NotContains(t, store.objects, "456/_SUCCESS")
+		}
+	}
+}
+
+func TestProcessEventSkipsCompletedFiles(t *testing.T) {
+	store := newObjectStoreMock()
+	store.objects["analyst/b.json"] = []byte(`[{"id": 2}]`)
+	transform := &countingTransform{}
+	event := &ManagerEvent{
+		ImportJobID: "456",
+		ProcessID:   "789",
+		InputFiles:  []string{"s3://landing/analyst/a.json", "s3://landing/analyst/b.json"},
+	}
+
+	idempotency := NewMemoryIdempotencyStore()
+	_ = idempotency.Put(IdempotencyRecord{
+		IdempotencyKey: unitKey(event, "s3://landing/analyst/a.json"),
+		OutputFiles:    []string{"s3://loading/456/a.json"},
+		Stats:          InputFileStats{Path: "s3://landing/analyst/a.json", Records: 4, RejectedRecords: 3},
+	})
+	maxRejected := 2
+
+	runtime := newTestRuntime(store, transform)
+	runtime.SetIdempotencyStore(idempotency)
+	runtime.SetQualityThresholds(quality.Thresholds{MaxRejected: &maxRejected})
+
+	_, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Equal(t, etlerrors.New(etlerrors.ErrInvalidEvent, "the event failed its quality thresholds", errors.New("3 of 5 records were rejected, more than the 2 allowed")), err)
+
+	maxRejected = 3
+
+	outputEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s3://loading/456/a.json", "s3://loading/456/b.json"}, outputEvent.OutputFiles)
+	assert.Equal(t, 2, transform.calls)
+	assert.Equal(t, 2, len(outputEvent.InputStats))
+	assert.Equal(t, InputFileStats{Path: "s3://landing/analyst/a.json", Records: 4, RejectedRecords: 3}, outputEvent.InputStats[0])
+	assert.Equal(t, []string{"s3://landing/analyst/a.json"}, outputEvent.Lineage["s3://loading/456/a.json"])
+}
+
+func TestProcessEventFailure(t *testing.T) {
+	store := newObjectStoreMock()
+	store.objects["analyst/a.json"] = []byte(`[{"id": 1}]`)
+	store.objects["analyst/b.json"] = []byte(`[{"id": 2}]`)
+	idempotency := NewMemoryIdempotencyStore()
+	event := &ManagerEvent{
+		ImportJobID: "456",
+		ProcessID:   "789",
+		InputFiles:  []string{"s3://landing/analyst/a.json", "s3://landing/analyst/b.json"},
+	}
+
+	runtime := newTestRuntime(store, &countingTransform{err: errors.New("some transform error")})
+	runtime.SetIdempotencyStore(idempotency)
+
+	outputEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, outputEvent)
+	assert.Equal(t, errors.New("some transform error"), err)
+	assert.NotContains(t, store.objects, "456/_SUCCESS")
+
+	record, _ := idempotency.Get(unitKey(event, "s3://landing/analyst/a.json"))
+	assert.Nil(t, record)
+}
+
+func TestProcessEventResumesFromCheckpoint(t *testing.T) {
+	store := newObjectStoreMock()
+	store.objects["analyst/a.json"] = []byte(`[{"id": 1}]`)
+	store.objects["analyst/b.json"] = []byte(`[{"id": 2}]`)
+	checkpoints := NewMemoryCheckpointStore()
+	transientErr := etlerrors.New(etlerrors.ErrTransient, "some s3 error", nil)
+	transform := &countingTransform{err: transientErr, failOn: "s3://landing/analyst/b.json"}
+	event := &ManagerEvent{
+		ImportJobID: "456",
+		ProcessID:   "789",
+		InputFiles:  []string{"s3://landing/analyst/a.json", "s3://landing/analyst/b.json"},
+	}
+
+	runtime := newTestRuntime(store, transform)
+	runtime.SetCheckpointStore(checkpoints)
+
+	_, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Equal(t, transientErr, err)
+	assert.Contains(t, store.objects, "_staging/456/a.json")
+	checkpoint, _ := checkpoints.Load("456", "789")
+	assert.Equal(t, 1, len(checkpoint.Files))
+
+	transform.err = nil
+	transform.calls = 0
+
+	outputEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, transform.calls)
+	assert.Equal(t, []string{"s3://loading/456/a.json", "s3://loading/456/b.json"}, outputEvent.OutputFiles)
+	assert.Contains(t, store.objects, "456/a.json")
+	assert.NotContains(t, store.objects, "_staging/456/a.json")
+
+	assert.Equal(t, 2, len(outputEvent.InputStats))
+	assert.Equal(t, 1, outputEvent.InputStats[0].Records)
+	assert.Equal(t, 2, len(outputEvent.OutputStats))
+	assert.Equal(t, []string{"s3://landing/analyst/a.json"}, outputEvent.Lineage["s3://loading/456/a.json"])
+
+	checkpoint, _ = checkpoints.Load("456", "789")
+	assert.Nil(t, checkpoint)
+}
+
+func TestProcessEventResumesAnInterruptedCommit(t *testing.T) {
+	fmt.Println("name: Success when a commit that failed after moving some files is resumed by the redelivered event")
+
+	store := newObjectStoreMock()
+	store.objects["analyst/a.json"] = []byte(`[{"id": 1}]`)
+	store.objects["analyst/b.json"] = []byte(`[{"id": 2}]`)
+	throttledErr := etlerrors.New(etlerrors.ErrThrottled, "some s3 error", nil)
+	store.copyError = throttledErr
+	store.copyErrorOn = "_staging/456/b.json"
+	checkpoints := NewMemoryCheckpointStore()
+	transform := &countingTransform{}
+	event := &ManagerEvent{
+		ImportJobID: "456",
+		ProcessID:   "789",
+		InputFiles:  []string{"s3://landing/analyst/a.json", "s3://landing/analyst/b.json"},
+	}
+
+	runtime := newTestRuntime(store, transform)
+	runtime.SetCheckpointStore(checkpoints)
+
+	_, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Equal(t, throttledErr, err)
+	assert.Contains(t, store.objects, "456/a.json")
+	assert.NotContains(t, store.objects, "_staging/456/a.json")
+	assert.NotContains(t, store.objects, "456/_SUCCESS")
+
+	store.copyError = nil
+	transform.calls = 0
+
+	outputEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, transform.calls)
+	assert.Equal(t, []string{"s3://loading/456/a.json", "s3://loading/456/b.json"}, outputEvent.OutputFiles)
+	assert.Contains(t, store.objects, "456/_SUCCESS")
+	assert.NotContains(t, store.objects, "_staging/456/b.json")
+	var manifest Manifest
+	assert.Nil(t, json.Unmarshal(store.objects["456/_manifest.json"], &manifest))
+	assert.Equal(t, 2, len(manifest.Files))
+	checkpoint, _ := checkpoints.Load("456", "789")
+	assert.Nil(t, checkpoint)
+}
+
+func TestProcessEventReadsWithTheRoleOfTheEvent(t *testing.T) {
+	fmt.Println("name: Success when the input files are read through the landing zone of the role of the event")
+
+	store := newObjectStoreMock()
+	otherAccount := newObjectStoreMock()
+	otherAccount.objects["analyst/a.json"] = []byte(`[{"id": 1}]`)
+	transform := &countingTransform{}
+	runtime := newTestRuntime(store, transform)
+	roles := []string{}
+	runtime.SetLandingZoneProvider(func(roleArn string) LandingZoneHelper {
+		roles = append(roles, roleArn)
+		return NewLandingZoneHelper(otherAccount)
+	})
+	event := &ManagerEvent{
+		ImportJobID: "456",
+		ProcessID:   "789",
+		RoleArn:     "arn:aws:iam::111111111111:role/landing",
+		InputFiles:  []string{"s3://landing/analyst/a.json"},
+	}
+
+	outputEvent, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"arn:aws:iam::111111111111:role/landing"}, roles)
+	assert.Equal(t, []string{"s3://loading/456/a.json"}, outputEvent.OutputFiles)
+	assert.Equal(t, 1, outputEvent.InputStats[0].Records)
+}
+
+func TestProcessEventLogsWithTheFieldsOfTheEvent(t *testing.T) {
+	fmt.Println("name: Success when every log line of the event has its correlation fields")
+
+	store := newObjectStoreMock()
+	store.objects["analyst/a.json"] = []byte(`[{"id": 1}]`)
+	event := &ManagerEvent{
+		ImportJobID: "456",
+		ProcessID:   "789",
+		ProviderID:  "123",
+		DataSource:  "analyst",
+		MessageID:   "message-1",
+		InputFiles:  []string{"s3://landing/analyst/a.json"},
+	}
+
+	buffer := &bytes.Buffer{}
+	runtime := newTestRuntime(store, &countingTransform{})
+	runtime.SetLogger(logging.New(buffer, logging.DebugLevel))
+
+	_, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.True(t, len(lines) >= 4)
+	for _, line := range lines {
+		var fields map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &fields))
+		assert.Equal(t, "456", fields[logging.ImportJobID])
+		assert.Equal(t, "789", fields[logging.ProcessID])
+		assert.Equal(t, "123", fields[logging.ProviderID])
+		assert.Equal(t, "analyst", fields[logging.DataSource])
+		assert.Equal(t, "message-1", fields[logging.MessageID])
+	}
+}
+
+func TestProcessEventMetrics(t *testing.T) {
+	fmt.Println("name: Success when the records, bytes and result of the event are recorded with its data source")
+
+	store := newObjectStoreMock()
+	store.objects["analyst/a.json"] = []byte(`[{"id": 1}, {"id": 2}]`)
+	event := &ManagerEvent{ImportJobID: "456", DataSource: "analyst", InputFiles: []string{"s3://landing/analyst/a.json"}}
+
+	registry := metrics.NewRegistry()
+	runtime := newTestRuntime(store, &countingTransform{})
+	runtime.SetMetrics(registry)
+
+	_, err := runtime.ProcessEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	output := &bytes.Buffer{}
+	assert.Nil(t, registry.WritePrometheus(output))
+	assert.Contains(t, output.String(), `etl_events_processed_total{dataSource="analyst",result="success"} 1`)
+	assert.Contains(t, output.String(), `etl_records_decoded_total{dataSource="analyst"} 2`)
+	assert.Contains(t, output.String(), `etl_records_encoded_total{dataSource="analyst"} 2`)
+	assert.Contains(t, output.String(), fmt.Sprintf(`etl_s3_read_bytes_total{dataSource="analyst"} %d`, len(store.objects["analyst/a.json"])))
+	assert.Contains(t, output.String(), `etl_s3_write_duration_seconds_count{dataSource="analyst"} 1`)
+	assert.Contains(t, output.String(), `etl_event_duration_seconds_count{dataSource="analyst",result="success"} 1`)
+}
+
+func TestHandleEventTraces(t *testing.T) {
+	fmt.Println("name: Success when every stage of the event is a span of the trace started upstream")
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	upstream, upstreamSpan := otel.Tracer("workflow-manager").Start(context.Background(), "start-import")
+	upstreamSpan.End()
+	attributes := map[string]*sqs.MessageAttributeValue{}
+	tracing.Inject(upstream, attributes)
+
+	body := `{"Type": "Notification", "Message": "{\"importJobID\": \"456\", \"dataSource\": \"analyst\", \"inputFiles\": [\"s3://landing/analyst/a.json\"]}"}`
+	messages := make(chan *sqs.Message, 1)
+	messages <- &sqs.Message{Body: &body, MessageId: aws.String("message-1"), MessageAttributes: attributes}
+
+	event, err := NewWFMHelper(sqsClientMock{}, nil, WorkflowManagerConfig{WorkFlowManagerEnabled: true}).GetEvent(messages)
+	assert.Nil(t, err)
+
+	store := newObjectStoreMock()
+	store.objects["analyst/a.json"] = []byte(`[{"id": 1}]`)
+	err = newTestRuntime(store, &countingTransform{}).HandleEvent(event) //<--- function under test
+
+	assert.Nil(t, err)
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		assert.Equal(t, upstreamSpan.SpanContext().TraceID(), span.SpanContext().TraceID())
+	}
+	assert.Equal(t, upstreamSpan.SpanContext().SpanID(), spans[tracing.ReceiveSpan].Parent().SpanID())
+	for _, name := range []string{tracing.ParseSpan, tracing.ProcessSpan, tracing.SendTaskSuccessSpan} {
+		assert.Equal(t, spans[tracing.ReceiveSpan].SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+	for _, name := range []string{tracing.LandingZoneReadSpan, tracing.TransformSpan, tracing.LoadingZoneWriteSpan, tracing.LoadingZoneCommitSpan} {
+		assert.Equal(t, spans[tracing.ProcessSpan].SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+}
+
+func TestHandleEventHealth(t *testing.T) {
+	fmt.Println("name: Success when the processed and failed events are reported to the health monitor")
+
+	store := newObjectStoreMock()
+	store.objects["analyst/a.json"] = []byte(`[{"id": 1}]`)
+	monitor := health.NewMonitor(0)
+	runtime := newTestRuntime(store, &countingTransform{err: errors.New("some transform error"), failOn: "s3://landing/analyst/b.json"})
+	runtime.SetHealth(monitor)
+
+	errSuccess := runtime.HandleEvent(&ManagerEvent{ImportJobID: "456", DataSource: "analyst", InputFiles: []string{"s3://landing/analyst/a.json"}}) //<--- function under test
+	errFailure := runtime.HandleEvent(&ManagerEvent{ImportJobID: "457", DataSource: "analyst", InputFiles: []string{"s3://landing/analyst/b.json"}}) //<--- function under test
+
+	assert.Nil(t, errSuccess)
+	assert.NotNil(t, errFailure)
+	status := monitor.Status()
+	assert.Equal(t, 1, status.EventsProcessed)
+	assert.Equal(t, 1, status.EventsFailed)
+	assert.Equal(t, []health.Event{}, status.InFlight)
+	if assert.NotNil(t, status.LastError) {
+		assert.Equal(t, errFailure.Error(), status.LastError.Message)
+		assert.Equal(t, "457", status.LastError.Event.ImportJobID)
+	}
+}
+
+func TestHandleEventSettlesTheMessage(t *testing.T) {
+	tests := []struct {
+		name               string
+		err                error
+		sendErr            error
+		taskToken          string
+		expectedErr        error
+		expectedDeleted    int
+		expectedFailures   []string
+		expectedStaged     bool
+		expectedCheckpoint bool
+	}{
+		{
+			name:            "Success when the message of a processed event is deleted",
+			taskToken:       "task-token",
+			expectedDeleted: 1,
+		},
+		{
+			name:               "Success when a retryable failure keeps the message and the checkpoint to be retried",
+			err:                etlerrors.New(etlerrors.ErrThrottled, "some s3 error", nil),
+			taskToken:          "task-token",
+			expectedStaged:     true,
+			expectedCheckpoint: true,
+		},
+		{
+			name:             "Success when a permanent failure fails the task and deletes the message",
+			err:              errors.New("some transform error"),
+			taskToken:        "task-token",
+			expectedDeleted:  1,
+			expectedFailures: []string{"some transform error"},
+		},
+		{
+			name:             "Success when the output event could not be sent and the task is failed with the cause",
+			sendErr:          errors.New("some task success error"),
+			taskToken:        "task-token",
+			expectedErr:      errors.New("some task success error"),
+			expectedDeleted:  1,
+			expectedFailures: []string{"some task success error"},
+		},
+		{
+			name:        "Success when the output event could not be sent yet and the message is kept",
+			sendErr:     etlerrors.New(etlerrors.ErrThrottled, "some task success error", nil),
+			taskToken:   "task-token",
+			expectedErr: etlerrors.New(etlerrors.ErrThrottled, "some task success error", nil),
+		},
+		{
+			name: "Success when a permanent failure without a task token is left to the dead letter queue",
+			err:  etlerrors.New(etlerrors.ErrInvalidEvent, "some invalid event error", nil),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		store := newObjectStoreMock()
+		store.objects["analyst/a.json"] = []byte(`[{"id": 1}]`)
+		store.objects["analyst/b.json"] = []byte(`[{"id": 2}]`)
+		checkpoints := NewMemoryCheckpointStore()
+		settlement := &settlementMock{}
+		settlement.sendTaskError = test.sendErr
+		transform := &countingTransform{err: test.err, failOn: "s3://landing/analyst/b.json"}
+		runtime := NewEtlRuntime(nil,
+			NewLandingZoneHelper(store),
+			NewLoadingZoneHelper(store, LoadingZoneConfig{S3Bucket: "loading", LZHelperEnabled: true}),
+			NewWFMHelper(settlement, settlement, WorkflowManagerConfig{WorkFlowManagerEnabled: true}),
+			transform.apply)
+		runtime.SetCheckpointStore(checkpoints)
+		event := &ManagerEvent{
+			ImportJobID: "456",
+			ProcessID:   "789",
+			TaskToken:   test.taskToken,
+			InputFiles:  []string{"s3://landing/analyst/a.json", "s3://landing/analyst/b.json"},
+			message:     &sqs.Message{MessageId: aws.String("message-1")},
+		}
+
+		err := runtime.HandleEvent(event) //<--- function under test
+
+		if test.expectedErr == nil {
+			test.expectedErr = test.err
+		}
+		assert.Equal(t, test.expectedErr, err)
+		assert.Equal(t, test.expectedDeleted, settlement.deleted)
+		assert.Equal(t, 1, settlement.extended)
+		assert.Equal(t, test.expectedFailures, settlement.failures)
+		assert.Equal(t, test.expectedStaged, store.objects["_staging/456/a.json"] != nil)
+		checkpoint, _ := checkpoints.Load("456", "789")
+		assert.Equal(t, test.expectedCheckpoint, checkpoint != nil)
+	}
+}
@@ -0,0 +1,101 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/anhamdan/etl-base/s3aws"
+	"path"
+	"sync"
+	"time"
+)
+
+// IdempotencyStore records the units of work that were already committed to the loading zone, so a replayed
+// event can skip them
+type IdempotencyStore interface {
+	Get(key IdempotencyKey) (*IdempotencyRecord, error)
+	Put(record IdempotencyRecord) error
+}
+
+// IdempotencyKey identifies a single input file processed as part of an import job
+type IdempotencyKey struct {
+	ImportJobID string `json:"importJobID"`
+	ProcessID   string `json:"processID"`
+	InputFile   string `json:"inputFile"`
+}
+
+// IdempotencyRecord is a committed input file, its statistics are reported again when a replayed event skips it
+type IdempotencyRecord struct {
+	IdempotencyKey
+	OutputFiles []string       `json:"outputFiles"`
+	Stats       InputFileStats `json:"stats"`
+	CompletedAt time.Time      `json:"completedAt"`
+}
+
+type memoryIdempotencyStore struct {
+	records map[IdempotencyKey]IdempotencyRecord
+	mutex   sync.RWMutex
+}
+
+type s3IdempotencyStore struct {
+	s3Client s3aws.S3Client
+	bucket   string
+	prefix   string
+}
+
+func NewMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: map[IdempotencyKey]IdempotencyRecord{}}
+}
+
+func (store *memoryIdempotencyStore) Get(key IdempotencyKey) (*IdempotencyRecord, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	record, ok := store.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (store *memoryIdempotencyStore) Put(record IdempotencyRecord) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.records[record.IdempotencyKey] = record
+	return nil
+}
+
+// NewS3IdempotencyStore keeps one object per record under prefix, the client must be bound to the given bucket
+func NewS3IdempotencyStore(s3Client s3aws.S3Client, bucket, prefix string) *s3IdempotencyStore {
+	return &s3IdempotencyStore{s3Client: s3Client, bucket: bucket, prefix: prefix}
+}
+
+func (store *s3IdempotencyStore) Get(key IdempotencyKey) (*IdempotencyRecord, error) {
+	content, err := store.s3Client.Read(store.bucket, store.objectPath(key))
+	if err != nil {
+		if s3aws.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var record IdempotencyRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (store *s3IdempotencyStore) Put(record IdempotencyRecord) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.s3Client.Insert(store.objectPath(record.IdempotencyKey), content)
+	return err
+}
+
+// objectPath hashes the input file so any s3 path can be used as part of the key
+func (store *s3IdempotencyStore) objectPath(key IdempotencyKey) string {
+	return path.Join(store.prefix, "idempotency", key.ImportJobID, key.ProcessID, checksum([]byte(key.InputFile))+".json")
+}
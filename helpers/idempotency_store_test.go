@@ -0,0 +1,56 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type idempotencyStoreTest struct {
+	name  string
+	store IdempotencyStore
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	tests := []idempotencyStoreTest{
+		{
+			name:  "Success when recording units in memory",
+			store: NewMemoryIdempotencyStore(),
+		},
+		{
+			name:  "Success when recording units in s3",
+			store: NewS3IdempotencyStore(newObjectStoreMock(), "state-bucket", "_state"),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		key := IdempotencyKey{ImportJobID: "456", ProcessID: "789", InputFile: "s3://landing/input.json"}
+
+		record, err := test.store.Get(key) //<--- function under test
+		assert.Nil(t, err)
+		assert.Nil(t, record)
+
+		err = test.store.Put(IdempotencyRecord{IdempotencyKey: key, OutputFiles: []string{"s3://loading/456/input.json"}})
+		assert.Nil(t, err)
+
+		record, err = test.store.Get(key) //<--- function under test
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"s3://loading/456/input.json"}, record.OutputFiles)
+
+		otherProcess, err := test.store.Get(IdempotencyKey{ImportJobID: "456", ProcessID: "790", InputFile: key.InputFile})
+		assert.Nil(t, err)
+		assert.Nil(t, otherProcess)
+	}
+}
+
+func TestS3IdempotencyStoreFailure(t *testing.T) {
+	store := NewS3IdempotencyStore(mockS3Client{readError: errors.New("some s3 error")}, "state-bucket", "_state")
+
+	record, err := store.Get(IdempotencyKey{ImportJobID: "456"}) //<--- function under test
+
+	assert.Nil(t, record)
+	assert.Equal(t, errors.New("some s3 error"), err)
+}
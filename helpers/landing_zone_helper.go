@@ -1,26 +1,38 @@
 package helpers
 
 import (
+	"fmt"
+	"github.com/anhamdan/etl-base/config/settings"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/logging"
+	"github.com/anhamdan/etl-base/metrics"
 	"github.com/anhamdan/etl-base/s3aws"
+	"strings"
+	"time"
 )
 
 type LandingZoneHelper interface {
 	Read(bucket, path string) ([]byte, error)
+	SetStatsCollector(stats *StatsCollector)
+	SetLogger(logger logging.Logger)
+	SetMetrics(m metrics.Metrics)
 }
 
 type landingZoneHelper struct {
 	s3Client s3aws.S3Client
 	path     string
+	stats    *StatsCollector
+	logger   logging.Logger
+	metrics  metrics.Metrics
 }
 
-type LandingZoneConfig struct {
-	S3Bucket string
-	Path     string
-}
+type LandingZoneConfig = settings.LandingZoneConfig
 
 func NewLandingZoneHelper(s3Client s3aws.S3Client) *landingZoneHelper {
 	helper := landingZoneHelper{
 		s3Client: s3Client,
+		logger:   logging.Default(),
+		metrics:  metrics.Default(),
 	}
 	return &helper
 }
@@ -29,11 +41,32 @@ func (lzh *landingZoneHelper) SetPath(path string) {
 	lzh.path = path
 }
 
+// SetStatsCollector records the size and duration of every following read on stats
+func (lzh *landingZoneHelper) SetStatsCollector(stats *StatsCollector) {
+	lzh.stats = stats
+}
+
+// SetLogger writes the following reads on logger, the runtime sets the logger of the event it processes
+func (lzh *landingZoneHelper) SetLogger(logger logging.Logger) {
+	lzh.logger = logger
+}
+
+// SetMetrics records the bytes and duration of the following reads on m, the runtime labels it with the event
+func (lzh *landingZoneHelper) SetMetrics(m metrics.Metrics) {
+	lzh.metrics = m
+}
+
 func (lzh *landingZoneHelper) Read(bucket, path string) ([]byte, error) {
+	startedAt := time.Now()
 	body, err := lzh.s3Client.Read(bucket, path)
 	if err != nil {
 		return nil, err
 	}
+	duration := time.Since(startedAt)
+	lzh.stats.RecordRead("s3://"+bucket+"/"+path, len(body), duration)
+	lzh.metrics.Count(metrics.S3BytesRead, float64(len(body)))
+	lzh.metrics.Observe(metrics.S3ReadDuration, duration.Seconds())
+	lzh.logger.Debug("Read the input file", logging.F("file", "s3://"+bucket+"/"+path), logging.F("bytes", len(body)))
 	return body, nil
 }
 
@@ -44,3 +77,13 @@ func (lzh *landingZoneHelper) GetFilenames(path string) (*[]*string, error) {
 	}
 	return fileNames, nil
 }
+
+// parseS3Path splits a path like s3://bucket/some/key into its bucket and key
+func parseS3Path(s3Path string) (string, string, error) {
+	trimmed := strings.TrimPrefix(s3Path, "s3://")
+	parts := strings.SplitN(trimmed, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", etlerrors.New(etlerrors.ErrInvalidEvent, fmt.Sprintf("invalid s3 path: %s", s3Path), nil)
+	}
+	return parts[0], parts[1], nil
+}
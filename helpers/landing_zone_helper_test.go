@@ -24,6 +24,9 @@ type mockS3Client struct {
 	insertError    error
 	listResponse   *[]*string
 	listError      error
+	copyResponse   *string
+	copyError      error
+	deleteError    error
 }
 
 func (mock mockS3Client) Read(bucket, path string) ([]byte, error) {
@@ -38,6 +41,14 @@ func (mock mockS3Client) ListObjects(path string) (*[]*string, error) {
 	return mock.listResponse, mock.listError
 }
 
+func (mock mockS3Client) Copy(srcPath, dstPath string) (*string, error) {
+	return mock.copyResponse, mock.copyError
+}
+
+func (mock mockS3Client) Delete(path string) error {
+	return mock.deleteError
+}
+
 var expectedTreeElemResponse = `[{"treeElemId":123,"hierarchyId":123,"branchLevel":123,"slotNumber":123,"name":null,"containerType":null,"description":null,"elementEnable":null,"parentEnable":null,"hierarchyType":null,"alarmFlags":null,"parentId":null,"parentRefId":null,"referenceId":null,"good":null,"alert":null,"danger":null,"overdue":null,"channelEnable":null}]`
 
 func TestRead(t *testing.T) {
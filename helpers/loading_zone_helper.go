@@ -2,45 +2,408 @@ package helpers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/config/settings"
 	"github.com/anhamdan/etl-base/constants"
+	"github.com/anhamdan/etl-base/logging"
+	"github.com/anhamdan/etl-base/metrics"
 	"github.com/anhamdan/etl-base/s3aws"
-	"log"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 )
 
 type LoadingZoneHelper interface {
 	Insert(entities interface{}, fileName string) (string, error)
+	Begin(event *ManagerEvent) error
+	Commit() ([]string, error)
+	Abort() error
+	Suspend()
+	Staged() []ManifestFile
+	Restore(files []ManifestFile) error
+	SetStatsCollector(stats *StatsCollector)
+	SetLogger(logger logging.Logger)
+	SetMetrics(m metrics.Metrics)
 }
 
 type loadingZoneHelper struct {
-	s3Client s3aws.S3Client
-	enabled  bool
+	s3Client      s3aws.S3Client
+	bucket        string
+	enabled       bool
+	stagingPrefix string
+	outputPrefix  string
+	job           *loadingZoneJob
+	stats         *StatsCollector
+	logger        logging.Logger
+	metrics       metrics.Metrics
+	mutex         sync.Mutex
 }
 
-type LoadingZoneConfig struct {
-	S3Bucket        string
-	LZHelperEnabled bool
+type LoadingZoneConfig = settings.LoadingZoneConfig
+
+// loadingZoneJob keeps track of the files staged for a single import job until they are committed or aborted
+type loadingZoneJob struct {
+	importJobID   string
+	processID     string
+	inputFiles    []string
+	stagingPrefix string
+	outputPrefix  string
+	files         []stagedFile
+}
+
+type stagedFile struct {
+	stagingPath string
+	file        ManifestFile
 }
 
 func NewLoadingZoneHelper(s3Client s3aws.S3Client, config LoadingZoneConfig) *loadingZoneHelper {
+	stagingPrefix := config.StagingPrefix
+	if stagingPrefix == constants.EmptyString {
+		stagingPrefix = constants.DefaultStagingPrefix
+	}
+
 	helper := loadingZoneHelper{
-		s3Client: s3Client,
-		enabled:  config.LZHelperEnabled,
+		s3Client:      s3Client,
+		bucket:        config.S3Bucket,
+		enabled:       config.LZHelperEnabled,
+		stagingPrefix: stagingPrefix,
+		outputPrefix:  config.OutputPrefix,
+		logger:        logging.Default(),
+		metrics:       metrics.Default(),
 	}
 	return &helper
 }
 
+// SetStatsCollector records the rows, size and duration of every following write on stats
+func (lzh *loadingZoneHelper) SetStatsCollector(stats *StatsCollector) {
+	lzh.mutex.Lock()
+	defer lzh.mutex.Unlock()
+
+	lzh.stats = stats
+}
+
+// SetLogger writes the following operations on logger, the runtime sets the logger of the event it processes
+func (lzh *loadingZoneHelper) SetLogger(logger logging.Logger) {
+	lzh.mutex.Lock()
+	defer lzh.mutex.Unlock()
+
+	lzh.logger = logger
+}
+
+// SetMetrics records the bytes and duration of the following writes on m, the runtime labels it with the event
+func (lzh *loadingZoneHelper) SetMetrics(m metrics.Metrics) {
+	lzh.mutex.Lock()
+	defer lzh.mutex.Unlock()
+
+	lzh.metrics = m
+}
+
+// Begin starts an import job, every file inserted until Commit or Abort is written to the staging prefix of the job
+func (lzh *loadingZoneHelper) Begin(event *ManagerEvent) error {
+	if !lzh.enabled {
+		return nil
+	}
+	if event == nil || event.ImportJobID == constants.EmptyString {
+		return errors.New("an import job id is needed to begin a loading zone job")
+	}
+
+	lzh.mutex.Lock()
+	defer lzh.mutex.Unlock()
+
+	if lzh.job != nil {
+		return fmt.Errorf("loading zone job %s is still in progress", lzh.job.importJobID)
+	}
+
+	lzh.job = &loadingZoneJob{
+		importJobID:   event.ImportJobID,
+		processID:     event.ProcessID,
+		inputFiles:    event.InputFiles,
+		stagingPrefix: path.Join(lzh.stagingPrefix, event.ImportJobID),
+		outputPrefix:  path.Join(lzh.outputPrefix, event.ImportJobID),
+	}
+	return nil
+}
+
 func (lzh *loadingZoneHelper) Insert(entities interface{}, path string) (string, error) {
 	if !lzh.enabled {
-		log.Printf("Loading zone helper disabled, not populating file: %s to the landing zone \n", path)
+		lzh.logger.Info("Loading zone helper disabled, not writing the file", logging.F("file", path))
 		return "", nil
 	}
 
+	lzh.mutex.Lock()
+	job := lzh.job
+	stats := lzh.stats
+	m := lzh.metrics
+	lzh.mutex.Unlock()
+
+	startedAt := time.Now()
 	content := convertToJson(entities)
-	outputPath, err := lzh.s3Client.Insert(path, content)
+	rows := countRows(entities)
+	if job == nil {
+		outputPath, err := lzh.s3Client.Insert(path, content)
+		if err != nil {
+			return constants.EmptyString, err
+		}
+		stats.RecordWrite(getOutputPath(*outputPath), rows, len(content), time.Since(startedAt))
+		recordWriteMetrics(m, rows, len(content), time.Since(startedAt))
+		return getOutputPath(*outputPath), nil
+	}
+
+	// Inside a job the file is staged, the returned path is where it will be once the job is committed
+	outputPath, err := lzh.stage(job, path, content, rows)
 	if err != nil {
 		return constants.EmptyString, err
 	}
-	return getOutputPath(*outputPath), nil
+	stats.RecordWrite(outputPath, rows, len(content), time.Since(startedAt))
+	recordWriteMetrics(m, rows, len(content), time.Since(startedAt))
+	return outputPath, nil
+}
+
+func recordWriteMetrics(m metrics.Metrics, rows, bytes int, duration time.Duration) {
+	m.Count(metrics.RecordsEncoded, float64(rows))
+	m.Count(metrics.S3BytesWritten, float64(bytes))
+	m.Observe(metrics.S3WriteDuration, duration.Seconds())
+}
+
+// Commit moves the staged files of the current job to its final prefix, then writes the manifest and,
+// as the very last object, the success marker. It returns the final output paths of the job, the rejects files are
+// listed apart in the manifest and are not returned. An interrupted commit is
+// resumed by committing the job again with the files restored from its checkpoint
+func (lzh *loadingZoneHelper) Commit() ([]string, error) {
+	if !lzh.enabled {
+		return nil, nil
+	}
+
+	lzh.mutex.Lock()
+	defer lzh.mutex.Unlock()
+
+	job := lzh.job
+	if job == nil {
+		return nil, errors.New("there is no loading zone job to commit")
+	}
+
+	// A previous run of the same job could have left a marker behind, it must not cover a partial rewrite
+	if err := lzh.s3Client.Delete(path.Join(job.outputPrefix, constants.SuccessFileName)); err != nil {
+		return nil, err
+	}
+
+	outputFiles := make([]string, 0, len(job.files))
+	manifestFiles := make([]ManifestFile, 0, len(job.files))
+	for _, staged := range job.files {
+		if err := lzh.move(staged); err != nil {
+			return nil, err
+		}
+		if !job.isRejects(staged.file) {
+			outputFiles = append(outputFiles, lzh.outputPath(staged.file.Path))
+		}
+		manifestFiles = append(manifestFiles, staged.file)
+	}
+
+	// Files committed by an earlier event of the same job are still in the final prefix, so they stay listed
+	previous, err := lzh.readManifest(job)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		ImportJobID: job.importJobID,
+		ProcessID:   job.processID,
+		InputFiles:  job.inputFiles,
+		Files:       []ManifestFile{},
+		CommittedAt: time.Now().UTC(),
+	}
+	for _, file := range mergeManifestFiles(append(previous.Files, previous.Rejects...), manifestFiles) {
+		if job.isRejects(file) {
+			manifest.Rejects = append(manifest.Rejects, file)
+			continue
+		}
+		manifest.Files = append(manifest.Files, file)
+	}
+	if _, err := lzh.s3Client.Insert(path.Join(job.outputPrefix, constants.ManifestFileName), convertToJson(manifest)); err != nil {
+		return nil, err
+	}
+	if _, err := lzh.s3Client.Insert(path.Join(job.outputPrefix, constants.SuccessFileName), []byte{}); err != nil {
+		return nil, err
+	}
+
+	lzh.job = nil
+	lzh.logger.Info("Committed the loading zone job", logging.F("outputPrefix", job.outputPrefix), logging.F("files", len(outputFiles)))
+	return outputFiles, nil
+}
+
+// move copies a staged file to its final path then deletes it from the staging prefix. A file moved by an interrupted
+// commit of the job is no longer staged, it is skipped when its final object is the one that was staged
+func (lzh *loadingZoneHelper) move(staged stagedFile) error {
+	if _, err := lzh.s3Client.Copy(staged.stagingPath, staged.file.Path); err != nil {
+		if !s3aws.IsNotFound(err) {
+			return err
+		}
+		content, readErr := lzh.s3Client.Read(lzh.bucket, staged.file.Path)
+		if readErr != nil || checksum(content) != staged.file.Checksum {
+			return err
+		}
+		lzh.logger.Info("The staged file was already moved by an interrupted commit", logging.F("file", staged.file.Path))
+		return nil
+	}
+	return lzh.s3Client.Delete(staged.stagingPath)
+}
+
+// Abort removes everything that was staged for the current job
+func (lzh *loadingZoneHelper) Abort() error {
+	if !lzh.enabled {
+		return nil
+	}
+
+	lzh.mutex.Lock()
+	defer lzh.mutex.Unlock()
+
+	job := lzh.job
+	if job == nil {
+		return nil
+	}
+
+	stagingPaths := map[string]bool{}
+	for _, staged := range job.files {
+		stagingPaths[staged.stagingPath] = true
+	}
+
+	// Pick up files that were staged but not tracked, like the ones of a crashed run of the same job
+	leftovers, err := lzh.s3Client.ListObjects(job.stagingPrefix + "/")
+	if err != nil {
+		return err
+	}
+	for _, key := range *leftovers {
+		if key != nil {
+			stagingPaths[*key] = true
+		}
+	}
+
+	for stagingPath := range stagingPaths {
+		if err := lzh.s3Client.Delete(stagingPath); err != nil {
+			return err
+		}
+	}
+
+	lzh.job = nil
+	return nil
+}
+
+// Suspend forgets the current job but keeps its staged files, so a later run of the job can Restore them
+func (lzh *loadingZoneHelper) Suspend() {
+	lzh.mutex.Lock()
+	defer lzh.mutex.Unlock()
+
+	lzh.job = nil
+}
+
+// Staged returns the files staged for the current job so far
+func (lzh *loadingZoneHelper) Staged() []ManifestFile {
+	lzh.mutex.Lock()
+	defer lzh.mutex.Unlock()
+
+	if lzh.job == nil {
+		return nil
+	}
+
+	files := make([]ManifestFile, len(lzh.job.files))
+	for i, staged := range lzh.job.files {
+		files[i] = staged.file
+	}
+	return files
+}
+
+// Restore tracks the files staged by a suspended run of the current job, so they are committed with the new ones
+func (lzh *loadingZoneHelper) Restore(files []ManifestFile) error {
+	if !lzh.enabled {
+		return nil
+	}
+
+	lzh.mutex.Lock()
+	defer lzh.mutex.Unlock()
+
+	job := lzh.job
+	if job == nil {
+		return errors.New("there is no loading zone job to restore the staged files to")
+	}
+
+	for _, file := range files {
+		filePath := strings.TrimPrefix(file.Path, job.outputPrefix+"/")
+		job.files = append(job.files, stagedFile{stagingPath: path.Join(job.stagingPrefix, filePath), file: file})
+		lzh.stats.RecordWrite(lzh.outputPath(file.Path), file.Rows, file.Bytes, 0)
+	}
+	return nil
+}
+
+func (lzh *loadingZoneHelper) stage(job *loadingZoneJob, filePath string, content []byte, rows int) (string, error) {
+	stagingPath := path.Join(job.stagingPrefix, filePath)
+
+	if _, err := lzh.s3Client.Insert(stagingPath, content); err != nil {
+		return constants.EmptyString, err
+	}
+
+	staged := stagedFile{
+		stagingPath: stagingPath,
+		file: ManifestFile{
+			Path:     path.Join(job.outputPrefix, filePath),
+			Rows:     rows,
+			Bytes:    len(content),
+			Checksum: checksum(content),
+		},
+	}
+
+	lzh.mutex.Lock()
+	defer lzh.mutex.Unlock()
+	for i := range job.files {
+		if job.files[i].stagingPath == stagingPath {
+			job.files[i] = staged
+			return lzh.outputPath(staged.file.Path), nil
+		}
+	}
+	job.files = append(job.files, staged)
+
+	return lzh.outputPath(staged.file.Path), nil
+}
+
+func (lzh *loadingZoneHelper) outputPath(key string) string {
+	return getOutputPath(path.Join(lzh.bucket, key))
+}
+
+// isRejects reports the files written under the rejects directory of the job
+func (job *loadingZoneJob) isRejects(file ManifestFile) bool {
+	return strings.HasPrefix(file.Path, path.Join(job.outputPrefix, constants.RejectsDirectory)+"/")
+}
+
+func (lzh *loadingZoneHelper) readManifest(job *loadingZoneJob) (Manifest, error) {
+	var manifest Manifest
+	content, err := lzh.s3Client.Read(lzh.bucket, path.Join(job.outputPrefix, constants.ManifestFileName))
+	if err != nil {
+		if s3aws.IsNotFound(err) {
+			return manifest, nil
+		}
+		return manifest, err
+	}
+
+	err = json.Unmarshal(content, &manifest)
+	return manifest, err
+}
+
+// mergeManifestFiles keeps the previous files that were not overwritten by the current ones
+func mergeManifestFiles(previous, current []ManifestFile) []ManifestFile {
+	currentPaths := map[string]bool{}
+	for _, file := range current {
+		currentPaths[file.Path] = true
+	}
+
+	merged := make([]ManifestFile, 0, len(previous)+len(current))
+	for _, file := range previous {
+		if !currentPaths[file.Path] {
+			merged = append(merged, file)
+		}
+	}
+	return append(merged, current...)
 }
 
 func convertToJson(entities interface{}) []byte {
@@ -49,6 +412,27 @@ func convertToJson(entities interface{}) []byte {
 	return content
 }
 
+// countRows returns the number of entities in a slice or array, any other value is a single row
+func countRows(entities interface{}) int {
+	if entities == nil {
+		return 0
+	}
+
+	value := reflect.ValueOf(entities)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return 0
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		return value.Len()
+	}
+	return 1
+}
+
 func getOutputPath(path string) string {
 	return "s3://" + path
 }
@@ -1,10 +1,14 @@
 package helpers
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/anhamdan/etl-base/s3aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -18,34 +22,13 @@ type insertTest struct {
 	config        LoadingZoneConfig
 }
 
-type s3ClientMock struct {
-	readResponse   []byte
-	readError      error
-	insertResponse *string
-	insertError    error
-	listResponse   *[]*string
-	listError      error
-}
-
-func (mock s3ClientMock) Read(bucket, path string) ([]byte, error) {
-	return mock.readResponse, mock.readError
-}
-
-func (mock s3ClientMock) Insert(path string, content []byte) (*string, error) {
-	return mock.insertResponse, mock.insertError
-}
-
-func (mock s3ClientMock) ListObjects(path string) (*[]*string, error) {
-	return mock.listResponse, mock.listError
-}
-
 func TestInsert(t *testing.T) {
 	insertResponse := "some/path"
 
 	tests := []insertTest{
 		{
 			name:     "failed when inserting to the loading zone",
-			s3Client: s3ClientMock{insertError: errors.New("some inserting error")},
+			s3Client: mockS3Client{insertError: errors.New("some inserting error")},
 			config: LoadingZoneConfig{
 				LZHelperEnabled: true,
 			},
@@ -65,7 +48,7 @@ func TestInsert(t *testing.T) {
 			config: LoadingZoneConfig{
 				LZHelperEnabled: true,
 			},
-			s3Client:     s3ClientMock{insertResponse: &insertResponse},
+			s3Client:     mockS3Client{insertResponse: &insertResponse},
 			expectedPath: "s3://some/path",
 		},
 	}
@@ -80,3 +63,179 @@ func TestInsert(t *testing.T) {
 		assert.Equal(t, test.expectedError, err)
 	}
 }
+
+type objectStoreMock struct {
+	objects   map[string][]byte
+	writes    []string
+	copyError error
+	// copyErrorOn limits copyError to the copies of that source
+	copyErrorOn string
+}
+
+func newObjectStoreMock() *objectStoreMock {
+	return &objectStoreMock{objects: map[string][]byte{}}
+}
+
+func (mock *objectStoreMock) Read(bucket, path string) ([]byte, error) {
+	content, ok := mock.objects[path]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "object not found", nil)
+	}
+	return content, nil
+}
+
+func (mock *objectStoreMock) Insert(path string, content []byte) (*string, error) {
+	mock.objects[path] = content
+	mock.writes = append(mock.writes, path)
+	return &path, nil
+}
+
+func (mock *objectStoreMock) ListObjects(path string) (*[]*string, error) {
+	keys := []*string{}
+	for key := range mock.objects {
+		if strings.HasPrefix(key, path) {
+			key := key
+			keys = append(keys, &key)
+		}
+	}
+	return &keys, nil
+}
+
+func (mock *objectStoreMock) Copy(srcPath, dstPath string) (*string, error) {
+	if mock.copyError != nil && (mock.copyErrorOn == "" || mock.copyErrorOn == srcPath) {
+		return nil, mock.copyError
+	}
+	content, ok := mock.objects[srcPath]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "object not found", nil)
+	}
+	mock.objects[dstPath] = content
+	mock.writes = append(mock.writes, dstPath)
+	return &dstPath, nil
+}
+
+func (mock *objectStoreMock) Delete(path string) error {
+	delete(mock.objects, path)
+	return nil
+}
+
+func TestCommit(t *testing.T) {
+	store := newObjectStoreMock()
+	helper := NewLoadingZoneHelper(store, LoadingZoneConfig{S3Bucket: "loading", LZHelperEnabled: true, OutputPrefix: "analyst"})
+	event := &ManagerEvent{ImportJobID: "456", ProcessID: "789", InputFiles: []string{"s3://landing/input.json"}}
+
+	assert.Nil(t, helper.Begin(event))
+
+	outputPath, err := helper.Insert([]string{"a", "b"}, "output.json")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3://loading/analyst/456/output.json", outputPath)
+	assert.Contains(t, store.objects, "_staging/456/output.json")
+	assert.NotContains(t, store.objects, "analyst/456/output.json")
+	rejectsPath, err := helper.Insert([]string{"c"}, "_rejects/output.json")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3://loading/analyst/456/_rejects/output.json", rejectsPath)
+
+	outputFiles, err := helper.Commit() //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s3://loading/analyst/456/output.json"}, outputFiles)
+	assert.NotContains(t, store.objects, "_staging/456/output.json")
+	assert.Equal(t, "analyst/456/_SUCCESS", store.writes[len(store.writes)-1])
+
+	var manifest Manifest
+	assert.Nil(t, json.Unmarshal(store.objects["analyst/456/_manifest.json"], &manifest))
+	assert.Equal(t, "456", manifest.ImportJobID)
+	assert.Equal(t, event.InputFiles, manifest.InputFiles)
+	assert.Equal(t, 1, len(manifest.Files))
+	assert.Equal(t, "analyst/456/output.json", manifest.Files[0].Path)
+	assert.Equal(t, 2, manifest.Files[0].Rows)
+	assert.Equal(t, checksum(store.objects["analyst/456/output.json"]), manifest.Files[0].Checksum)
+	assert.Equal(t, 1, len(manifest.Rejects))
+	assert.Equal(t, "analyst/456/_rejects/output.json", manifest.Rejects[0].Path)
+	assert.Contains(t, store.objects, "analyst/456/_rejects/output.json")
+}
+
+func TestCommitFailure(t *testing.T) {
+	store := newObjectStoreMock()
+	store.copyError = errors.New("some copy error")
+	helper := NewLoadingZoneHelper(store, LoadingZoneConfig{LZHelperEnabled: true})
+
+	assert.Nil(t, helper.Begin(&ManagerEvent{ImportJobID: "456"}))
+	_, err := helper.Insert([]string{"a"}, "output.json")
+	assert.Nil(t, err)
+
+	_, err = helper.Commit() //<--- function under test
+
+	assert.Equal(t, errors.New("some copy error"), err)
+	assert.NotContains(t, store.objects, "456/_SUCCESS")
+	assert.NotContains(t, store.objects, "456/_manifest.json")
+}
+
+func TestCommitResumesMovedFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		final         []byte
+		expectedError error
+	}{
+		{
+			name:  "Success when the staged file was moved by an interrupted commit",
+			final: []byte("[\n  \"a\"\n]"),
+		},
+		{
+			name:          "Fail when the staged file is missing and the final one is another file",
+			final:         []byte(`["b"]`),
+			expectedError: awserr.New(s3.ErrCodeNoSuchKey, "object not found", nil),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		store := newObjectStoreMock()
+		helper := NewLoadingZoneHelper(store, LoadingZoneConfig{LZHelperEnabled: true})
+		assert.Nil(t, helper.Begin(&ManagerEvent{ImportJobID: "456"}))
+		_, err := helper.Insert([]string{"a"}, "output.json")
+		assert.Nil(t, err)
+		delete(store.objects, "_staging/456/output.json")
+		store.objects["456/output.json"] = test.final
+
+		_, err = helper.Commit() //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		assert.Equal(t, test.expectedError == nil, store.objects["456/_SUCCESS"] != nil)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	store := newObjectStoreMock()
+	store.objects["_staging/456/leftover.json"] = []byte(`[]`)
+	helper := NewLoadingZoneHelper(store, LoadingZoneConfig{LZHelperEnabled: true})
+
+	assert.Nil(t, helper.Begin(&ManagerEvent{ImportJobID: "456"}))
+	_, err := helper.Insert([]string{"a"}, "output.json")
+	assert.Nil(t, err)
+
+	err = helper.Abort() //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Empty(t, store.objects)
+	assert.Nil(t, helper.Begin(&ManagerEvent{ImportJobID: "457"}))
+}
+
+func TestCommitKeepsPreviousManifestFiles(t *testing.T) {
+	store := newObjectStoreMock()
+	helper := NewLoadingZoneHelper(store, LoadingZoneConfig{LZHelperEnabled: true})
+
+	for _, fileName := range []string{"first.json", "second.json"} {
+		assert.Nil(t, helper.Begin(&ManagerEvent{ImportJobID: "456"}))
+		_, err := helper.Insert([]string{"a"}, fileName)
+		assert.Nil(t, err)
+		_, err = helper.Commit() //<--- function under test
+		assert.Nil(t, err)
+	}
+
+	var manifest Manifest
+	assert.Nil(t, json.Unmarshal(store.objects["456/_manifest.json"], &manifest))
+	assert.Equal(t, 2, len(manifest.Files))
+	assert.Equal(t, "456/first.json", manifest.Files[0].Path)
+	assert.Equal(t, "456/second.json", manifest.Files[1].Path)
+}
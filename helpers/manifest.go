@@ -0,0 +1,31 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Manifest describes the files committed to the loading zone for a single import job
+type Manifest struct {
+	ImportJobID string         `json:"importJobID"`
+	ProcessID   string         `json:"processID"`
+	InputFiles  []string       `json:"inputFiles"`
+	Files       []ManifestFile `json:"files"`
+	// Rejects are the files of the records rejected from the input files, under _rejects, they are not outputs
+	Rejects     []ManifestFile `json:"rejects,omitempty"`
+	CommittedAt time.Time      `json:"committedAt"`
+}
+
+type ManifestFile struct {
+	Path     string `json:"path"`
+	Rows     int    `json:"rows"`
+	Bytes    int    `json:"bytes"`
+	Checksum string `json:"checksum"`
+}
+
+// checksum returns the hex encoded sha256 of the content
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
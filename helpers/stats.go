@@ -0,0 +1,232 @@
+package helpers
+
+import (
+	"github.com/anhamdan/etl-base/quality"
+	"sync"
+	"time"
+)
+
+type InputFileStats struct {
+	Path            string         `json:"path"`
+	Records         int            `json:"records"`
+	RejectedRecords int            `json:"rejectedRecords"`
+	RejectReasons   map[string]int `json:"rejectReasons,omitempty"`
+	// RuleResults count the records failing every quality rule, RejectsFile holds the rejected records
+	RuleResults         []quality.RuleResult `json:"ruleResults,omitempty"`
+	RejectsFile         string               `json:"rejectsFile,omitempty"`
+	Bytes               int                  `json:"bytes"`
+	ReadDurationMs      int64                `json:"readDurationMs"`
+	TransformDurationMs int64                `json:"transformDurationMs"`
+	Warnings            []string             `json:"warnings,omitempty"`
+}
+
+type OutputFileStats struct {
+	Path            string `json:"path"`
+	Records         int    `json:"records"`
+	Bytes           int    `json:"bytes"`
+	WriteDurationMs int64  `json:"writeDurationMs"`
+}
+
+// StatsCollector gathers the statistics of a single event, the zone helpers record every read and write on it.
+// All methods can be called on a nil collector, in which case nothing is recorded
+type StatsCollector struct {
+	inputs      map[string]*InputFileStats
+	inputOrder  []string
+	outputs     map[string]*OutputFileStats
+	outputOrder []string
+	lineage     map[string][]string
+	warnings    []string
+	startedAt   time.Time
+	mutex       sync.Mutex
+}
+
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{
+		inputs:    map[string]*InputFileStats{},
+		outputs:   map[string]*OutputFileStats{},
+		lineage:   map[string][]string{},
+		startedAt: time.Now(),
+	}
+}
+
+func (collector *StatsCollector) RecordRead(path string, bytes int, duration time.Duration) {
+	if collector == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	stats := collector.input(path)
+	stats.Bytes += bytes
+	stats.ReadDurationMs += duration.Milliseconds()
+}
+
+func (collector *StatsCollector) RecordTransform(path string, records, rejected int, rejectReasons map[string]int, warnings []string, duration time.Duration) {
+	if collector == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	stats := collector.input(path)
+	stats.Records += records
+	stats.RejectedRecords += rejected
+	for reason, count := range rejectReasons {
+		if stats.RejectReasons == nil {
+			stats.RejectReasons = map[string]int{}
+		}
+		stats.RejectReasons[reason] += count
+	}
+	stats.Warnings = append(stats.Warnings, warnings...)
+	stats.TransformDurationMs += duration.Milliseconds()
+}
+
+// RecordQuality adds the results of the quality rules of the input file and the path of its rejects file
+func (collector *StatsCollector) RecordQuality(path string, ruleResults []quality.RuleResult, rejectsFile string) {
+	if collector == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	stats := collector.input(path)
+	for _, result := range ruleResults {
+		merged := false
+		for i := range stats.RuleResults {
+			if stats.RuleResults[i].Rule == result.Rule {
+				stats.RuleResults[i].Failed += result.Failed
+				merged = true
+			}
+		}
+		if !merged {
+			stats.RuleResults = append(stats.RuleResults, result)
+		}
+	}
+	if rejectsFile != "" {
+		stats.RejectsFile = rejectsFile
+	}
+}
+
+// Totals returns the records and the rejected records of every input file
+func (collector *StatsCollector) Totals() (records, rejected int) {
+	if collector == nil {
+		return 0, 0
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	for _, stats := range collector.inputs {
+		records += stats.Records
+		rejected += stats.RejectedRecords
+	}
+	return records, rejected
+}
+
+// Input returns the statistics collected so far for the input file
+func (collector *StatsCollector) Input(path string) InputFileStats {
+	if collector == nil {
+		return InputFileStats{Path: path}
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	return *collector.input(path)
+}
+
+// RestoreInput adds the statistics of an input file processed by an earlier run of the same job
+func (collector *StatsCollector) RestoreInput(stats InputFileStats) {
+	if collector == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	*collector.input(stats.Path) = stats
+}
+
+func (collector *StatsCollector) RecordWrite(path string, records, bytes int, duration time.Duration) {
+	if collector == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	stats, ok := collector.outputs[path]
+	if !ok {
+		stats = &OutputFileStats{Path: path}
+		collector.outputs[path] = stats
+		collector.outputOrder = append(collector.outputOrder, path)
+	}
+	// A rewrite of the same file replaces it, so the latest write wins
+	stats.Records = records
+	stats.Bytes = bytes
+	stats.WriteDurationMs = duration.Milliseconds()
+}
+
+// RecordLineage marks the input files as sources of the output file
+func (collector *StatsCollector) RecordLineage(outputPath string, inputPaths ...string) {
+	if collector == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	for _, inputPath := range inputPaths {
+		if !containsString(collector.lineage[outputPath], inputPath) {
+			collector.lineage[outputPath] = append(collector.lineage[outputPath], inputPath)
+		}
+	}
+}
+
+func (collector *StatsCollector) Warn(warning string) {
+	if collector == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	collector.warnings = append(collector.warnings, warning)
+}
+
+// Fill copies the collected statistics into the output event
+func (collector *StatsCollector) Fill(outputEvent *ManagerOutputEvent) {
+	if collector == nil || outputEvent == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	outputEvent.InputStats = make([]InputFileStats, 0, len(collector.inputOrder))
+	for _, path := range collector.inputOrder {
+		outputEvent.InputStats = append(outputEvent.InputStats, *collector.inputs[path])
+	}
+	outputEvent.OutputStats = make([]OutputFileStats, 0, len(collector.outputOrder))
+	for _, path := range collector.outputOrder {
+		outputEvent.OutputStats = append(outputEvent.OutputStats, *collector.outputs[path])
+	}
+	outputEvent.Lineage = map[string][]string{}
+	for outputPath, inputPaths := range collector.lineage {
+		outputEvent.Lineage[outputPath] = append([]string{}, inputPaths...)
+	}
+	outputEvent.Warnings = append([]string{}, collector.warnings...)
+	outputEvent.DurationMs = time.Since(collector.startedAt).Milliseconds()
+}
+
+func (collector *StatsCollector) input(path string) *InputFileStats {
+	stats, ok := collector.inputs[path]
+	if !ok {
+		stats = &InputFileStats{Path: path}
+		collector.inputs[path] = stats
+		collector.inputOrder = append(collector.inputOrder, path)
+	}
+	return stats
+}
+
+func containsString(values []string, value string) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+	return false
+}
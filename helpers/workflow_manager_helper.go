@@ -1,13 +1,22 @@
 package helpers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/anhamdan/etl-base/config/settings"
 	"github.com/anhamdan/etl-base/constants"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/logging"
+	"github.com/anhamdan/etl-base/metrics"
 	"github.com/anhamdan/etl-base/sfnaws"
 	"github.com/anhamdan/etl-base/sqsaws"
+	"github.com/anhamdan/etl-base/tracing"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"io/ioutil"
 	"sync"
 	"time"
 )
@@ -23,35 +32,87 @@ type ManagerEvent struct {
 	TaskToken       string   `json:"taskToken"`
 	RoleArn         string   `json:"roleArn"`
 	EtlSpecificData string   `json:"etlSpecificData"`
+	// MessageID is the id of the sqs message that delivered the event
+	MessageID string `json:"-"`
+
+	ctx context.Context
+	// message is deleted from the queue once the event is settled, see FailureActionFor
+	message *sqs.Message
+}
+
+// Context carries the trace of the event, continued from the attributes of its message. It is never nil
+func (event *ManagerEvent) Context() context.Context {
+	if event.ctx == nil {
+		return context.Background()
+	}
+	return event.ctx
+}
+
+func (event *ManagerEvent) SetContext(ctx context.Context) {
+	event.ctx = ctx
+}
+
+// EventFields are the fields correlating the log lines of an event
+func EventFields(event *ManagerEvent) []logging.Field {
+	if event == nil {
+		return nil
+	}
+
+	fields := []logging.Field{
+		logging.F(logging.ImportJobID, event.ImportJobID),
+		logging.F(logging.ProcessID, event.ProcessID),
+		logging.F(logging.ProviderID, event.ProviderID),
+		logging.F(logging.DataSource, event.DataSource),
+	}
+	if event.MessageID != constants.EmptyString {
+		fields = append(fields, logging.F(logging.MessageID, event.MessageID))
+	}
+	return fields
+}
+
+// EventAttributes are the span attributes of the ids of an event
+func EventAttributes(event *ManagerEvent) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		tracing.ImportJobID.String(event.ImportJobID),
+		tracing.ProcessID.String(event.ProcessID),
+		tracing.ProviderID.String(event.ProviderID),
+		tracing.DataSource.String(event.DataSource),
+	}
 }
 
 type ManagerOutputEvent struct {
-	OutputFiles []string `json:"outputFiles"`
+	OutputFiles []string            `json:"outputFiles"`
+	InputStats  []InputFileStats    `json:"inputStats,omitempty"`
+	OutputStats []OutputFileStats   `json:"outputStats,omitempty"`
+	Lineage     map[string][]string `json:"lineage,omitempty"`
+	Warnings    []string            `json:"warnings,omitempty"`
+	DurationMs  int64               `json:"durationMs,omitempty"`
 }
 
 type WorkflowManagerHelper interface {
 	ReceiveEvents(chn chan *sqs.Message, errChan chan error, wg *sync.WaitGroup)
 	SendEvent(outputEvent interface{}, sess *session.Session, roleARN, taskToken string) error
+	SendFailure(cause error, sess *session.Session, roleARN, taskToken string) error
 	DeleteMessage(msg *sqs.Message) error
+	KeepInvisible(msg *sqs.Message) (stop func())
 	GetEvent(chnMessages chan *sqs.Message) (*ManagerEvent, error)
 	ParseEvent(msg []byte) (*ManagerEvent, error)
 	IsEnabled() bool
 }
 
 type workflowManagerHelper struct {
-	sqsClient sqsaws.SQSClient
-	sfnClient sfnaws.SFNClient
-	topic     string
-	groupID   string
-	enabled   bool
+	sqsClient         sqsaws.SQSClient
+	sfnClient         sfnaws.SFNClient
+	topic             string
+	groupID           string
+	enabled           bool
+	localEventPath    string
+	visibilityTimeout time.Duration
+	logger            logging.Logger
+	metrics           metrics.Metrics
 }
 
-type WorkflowManagerConfig struct {
-	WorkFlowManagerEnabled bool
-	SQSURL                 string
-	TopicARN               string
-	GroupID                string
-}
+type WorkflowManagerConfig = settings.WorkflowManagerConfig
 
 type sqsBody struct {
 	Type           string    `json:"Type"`
@@ -64,7 +125,20 @@ type sqsBody struct {
 }
 
 func NewWFMHelper(sqsClient sqsaws.SQSClient, sfnClient sfnaws.SFNClient, config WorkflowManagerConfig) *workflowManagerHelper {
-	return &workflowManagerHelper{sqsClient: sqsClient, sfnClient: sfnClient, enabled: config.WorkFlowManagerEnabled, topic: config.TopicARN, groupID: config.GroupID}
+	visibilityTimeout := config.VisibilityTimeout
+	if visibilityTimeout == 0 {
+		visibilityTimeout = constants.DefaultVisibilityTimeout
+	}
+	return &workflowManagerHelper{sqsClient: sqsClient, sfnClient: sfnClient, enabled: config.WorkFlowManagerEnabled, topic: config.TopicARN, groupID: config.GroupID, localEventPath: config.LocalEventPath, visibilityTimeout: visibilityTimeout, logger: logging.Default(), metrics: metrics.Default()}
+}
+
+func (helper *workflowManagerHelper) SetLogger(logger logging.Logger) {
+	helper.logger = logger
+}
+
+// SetMetrics counts the parsed events and the task results sent to the workflow manager on m
+func (helper *workflowManagerHelper) SetMetrics(m metrics.Metrics) {
+	helper.metrics = m
 }
 
 func (helper *workflowManagerHelper) ReceiveEvents(chn chan *sqs.Message, errChan chan error, wg *sync.WaitGroup) {
@@ -85,11 +159,30 @@ func (helper *workflowManagerHelper) SendEvent(outputEvent interface{}, sess *se
 
 		err = helper.sfnClient.SendTaskSuccess(string(msg), taskToken, awsSFNClient)
 		if err != nil {
+			helper.metrics.Count(metrics.TaskSuccesses, 1, metrics.L(metrics.Result, metrics.Failure))
 			return err
 		}
+		helper.metrics.Count(metrics.TaskSuccesses, 1, metrics.L(metrics.Result, metrics.Success))
 
 	} else {
-		log.Println("Downstream events disabled, not sending message to workflow manager")
+		helper.logger.Info("Downstream events disabled, not sending the output event to the workflow manager")
+	}
+	return nil
+}
+
+func (helper *workflowManagerHelper) SendFailure(cause error, sess *session.Session, roleARN, taskToken string) error {
+	if helper.enabled {
+		awsSFNClient := helper.sfnClient.CreateSFNClient(sess, roleARN)
+
+		err := helper.sfnClient.SendTaskFailure(constants.TaskFailureErrorCode, cause.Error(), taskToken, awsSFNClient)
+		if err != nil {
+			helper.metrics.Count(metrics.TaskFailures, 1, metrics.L(metrics.Result, metrics.Failure))
+			return err
+		}
+		helper.metrics.Count(metrics.TaskFailures, 1, metrics.L(metrics.Result, metrics.Success))
+
+	} else {
+		helper.logger.Info("Downstream events disabled, not sending the failure to the workflow manager", logging.Err(cause))
 	}
 	return nil
 }
@@ -101,76 +194,116 @@ func (helper *workflowManagerHelper) DeleteMessage(msg *sqs.Message) error {
 		}
 
 	} else {
-		log.Println("Work Flow Manager disabled, not deleting message from queue")
+		helper.logger.Info("Workflow manager disabled, not deleting the message from the queue")
 	}
 	return nil
 }
 
+// KeepInvisible hides the message from the other workers for the visibility timeout, and again every half of it until
+// stop is called, so a long event is not delivered to another worker while it is processed. The failed extensions
+// are logged, the message may then be delivered again
+func (helper *workflowManagerHelper) KeepInvisible(msg *sqs.Message) (stop func()) {
+	if !helper.enabled || msg == nil {
+		return func() {}
+	}
+
+	extend := func() {
+		if err := helper.sqsClient.ChangeVisibility(msg, helper.visibilityTimeout); err != nil {
+			helper.logger.Error("Could not extend the visibility of the message", logging.F(logging.MessageID, aws.StringValue(msg.MessageId)), logging.Err(err))
+		}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		extend()
+		ticker := time.NewTicker(helper.visibilityTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				extend()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// GetEvent receives the next event. Its message stays in the queue until the runtime settles the event, so an event
+// that fails with a retryable error is delivered again. Without a workflow manager the event is the one of the local
+// event file, which must be set
 func (helper *workflowManagerHelper) GetEvent(chnMessages chan *sqs.Message) (*ManagerEvent, error) {
-	var event *ManagerEvent
-	var err error
 	if helper.enabled {
-		message := <-chnMessages
-		event, err = helper.ParseEvent([]byte(*message.Body))
+		return helper.receive(<-chnMessages)
+	}
+	if helper.localEventPath == constants.EmptyString {
+		return nil, errors.New("workflowManager.localEventPath is required when the workflow manager is disabled")
+	}
+	return helper.readLocalEvent()
+}
 
-		if err := helper.DeleteMessage(message); err != nil {
-			log.Printf("Could not delete message from the sqs queue %s", err.Error())
-		}
-	} else {
-		body := constants.EmptyString
-		message := &sqs.Message{Body: &body}
-		event, _ = helper.ParseEvent([]byte(*message.Body))
+// receive parses the event of a message, continuing the trace of the message. A message that is not an event is
+// logged and left in the queue
+func (helper *workflowManagerHelper) receive(message *sqs.Message) (*ManagerEvent, error) {
+	ctx, receiveSpan := tracing.Start(tracing.Extract(context.Background(), message), tracing.ReceiveSpan,
+		tracing.MessageID.String(aws.StringValue(message.MessageId)))
 
-		//Todo this is only temporary for dev purposes. It is needed when receiving events from the step function
-		// state machine
-		/*fileNames, err := landingZoneHelper.GetFilenames("adam/analyst/")
-		if err != nil {
-			log.Fatalf("error: %+v\n", err)
-		}*/
-		event = &ManagerEvent{}
-		event.InputFiles = []string{
-			/*"s3://landing-zone-poc/analyst/data_init_2021.11.25_11:12:09.644.json",
-			"s3://landing-zone-poc/analyst/data_init_2021.11.25_11:12:10.687.json",
-			"s3://landing-zone-poc/analyst/data_init_2021.11.25_11:12:10.891.json",*/
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:39:49.210.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:39:52.691.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:39:53.580.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:39:55.765.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:39:58.006.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:05.896.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:08.725.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:10.684.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:13.215.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:16.324.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:20.703.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:26.109.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:45.640.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:48.713.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:52.384.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:40:56.855.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:41:00.822.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:41:05.756.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:41:14.144.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:41:15.782.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:41:24.404.json",
-			"s3://landing-zone-poc/adam/analyst/data_init_2022-01-09T16:41:27.272.json",
-		}
+	_, parseSpan := tracing.Start(ctx, tracing.ParseSpan)
+	event, err := helper.ParseEvent([]byte(*message.Body))
+	tracing.End(parseSpan, err)
+	if event != nil {
+		event.MessageID = aws.StringValue(message.MessageId)
+		event.SetContext(ctx)
+		event.message = message
+		receiveSpan.SetAttributes(EventAttributes(event)...)
+	} else {
+		// Nothing can be reported for a message that is not an event, the redrive policy of the queue moves it
+		// to the dead letter queue
+		helper.logger.Error("Could not parse the message, it is left to the dead letter queue",
+			logging.F(logging.MessageID, aws.StringValue(message.MessageId)), logging.Err(err))
 	}
+	tracing.End(receiveSpan, err)
 	return event, err
 }
 
+// readLocalEvent reads the event from a plain ManagerEvent json file, so an ETL can run without the workflow manager
+func (helper *workflowManagerHelper) readLocalEvent() (*ManagerEvent, error) {
+	content, err := ioutil.ReadFile(helper.localEventPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var event ManagerEvent
+	if err := json.Unmarshal(content, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
 func (helper *workflowManagerHelper) ParseEvent(msg []byte) (*ManagerEvent, error) {
 	var sqsBody sqsBody
 
 	if err := json.Unmarshal(msg, &sqsBody); err != nil {
-		return nil, err
+		helper.metrics.Count(metrics.EventsParsed, 1, metrics.L(metrics.Result, metrics.Failure))
+		return nil, etlerrors.New(etlerrors.ErrInvalidEvent, "failed to parse the event", err)
 	}
 
 	var event ManagerEvent
 	if err := json.Unmarshal([]byte(sqsBody.Message), &event); err != nil {
-		return nil, err
+		helper.metrics.Count(metrics.EventsParsed, 1, metrics.L(metrics.Result, metrics.Failure))
+		return nil, etlerrors.New(etlerrors.ErrInvalidEvent, "failed to parse the event", err)
 	}
 
+	helper.metrics.Count(metrics.EventsParsed, 1, metrics.L(metrics.Result, metrics.Success), metrics.L(metrics.DataSource, event.DataSource))
 	return &event, nil
 }
 
@@ -5,14 +5,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/anhamdan/etl-base/etlerrors"
 	"github.com/anhamdan/etl-base/sfnaws"
 	"github.com/anhamdan/etl-base/sqsaws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sfn"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 )
 
 type wfmHelperTestCase struct {
@@ -55,15 +59,24 @@ func (sqsMock sqsClientMock) DeleteMessage(msg *sqs.Message) error {
 	return sqsMock.deleteMessageError
 }
 
+func (sqsMock sqsClientMock) ChangeVisibility(msg *sqs.Message, timeout time.Duration) error {
+	return nil
+}
+
 type sfnClientMock struct {
-	sendTaskError error
+	sendTaskError        error
+	sendTaskFailureError error
 }
 
 func (sfnMock sfnClientMock) SendTaskSuccess(output, taskToken string, svc sfnaws.SFNMessageClient) error {
 	return sfnMock.sendTaskError
 }
 
-func (sfnMock sfnClientMock) CreateSFNClient(sess *session.Session, roleArn string) *sfn.SFN {
+func (sfnMock sfnClientMock) SendTaskFailure(errorCode, cause, taskToken string, svc sfnaws.SFNMessageClient) error {
+	return sfnMock.sendTaskFailureError
+}
+
+func (sfnMock sfnClientMock) CreateSFNClient(sess *session.Session, roleArn string) sfnaws.SFNMessageClient {
 	return &sfn.SFN{}
 }
 
@@ -131,6 +144,54 @@ func TestDeleteMessage(t *testing.T) {
 	}
 }
 
+// visibilityMock records the visibility timeouts of the messages
+type visibilityMock struct {
+	sqsClientMock
+	timeouts []time.Duration
+	mutex    sync.Mutex
+}
+
+func (mock *visibilityMock) ChangeVisibility(msg *sqs.Message, timeout time.Duration) error {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	mock.timeouts = append(mock.timeouts, timeout)
+	return nil
+}
+
+func (mock *visibilityMock) changes() int {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	return len(mock.timeouts)
+}
+
+func TestKeepInvisible(t *testing.T) {
+	fmt.Println("name: Success when the visibility of the message is extended at once and every half timeout until stopped")
+
+	sqsMock := &visibilityMock{}
+	wfmHelper := NewWFMHelper(sqsMock, nil, WorkflowManagerConfig{WorkFlowManagerEnabled: true, VisibilityTimeout: 20 * time.Millisecond})
+
+	stop := wfmHelper.KeepInvisible(&sqs.Message{}) //<--- function under test
+
+	assert.Eventually(t, func() bool { return sqsMock.changes() >= 3 }, time.Second, time.Millisecond)
+	stop()
+	stop()
+	changes := sqsMock.changes()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, changes, sqsMock.changes())
+	assert.Equal(t, 20*time.Millisecond, sqsMock.timeouts[0])
+
+	fmt.Println("name: Success when a message read from a local file is not extended")
+
+	sqsMock = &visibilityMock{}
+	wfmHelper = NewWFMHelper(sqsMock, nil, WorkflowManagerConfig{})
+
+	wfmHelper.KeepInvisible(&sqs.Message{})() //<--- function under test
+
+	assert.Equal(t, 0, sqsMock.changes())
+}
+
 func TestParseEvent(t *testing.T) {
 	var tempEvent ManagerEvent
 	expectedJsonErr := json.Unmarshal([]byte(`>`), &tempEvent)
@@ -139,12 +200,12 @@ func TestParseEvent(t *testing.T) {
 		{
 			name:          "Fail when trying to parse sqs body from the event",
 			input:         []byte(`>`),
-			expectedError: expectedJsonErr,
+			expectedError: etlerrors.New(etlerrors.ErrInvalidEvent, "failed to parse the event", expectedJsonErr),
 		},
 		{
 			name:          "Fail when trying to parse sqs body message from the event",
 			input:         []byte(`{"Message": ">"}`),
-			expectedError: expectedJsonErr,
+			expectedError: etlerrors.New(etlerrors.ErrInvalidEvent, "failed to parse the event", expectedJsonErr),
 		},
 		{
 			name:          "Success when trying to parse sqs body message to an event",
@@ -220,6 +281,82 @@ func TestSendEvent(t *testing.T) {
 
 }
 
+func TestSendFailure(t *testing.T) {
+	tests := []wfmHelperTestCase{
+		{
+			name: "Fail sending task failure to step functions",
+			sfnClient: sfnClientMock{
+				sendTaskFailureError: errors.New("some send task error"),
+			},
+			expectedError: errors.New("some send task error"),
+			config: WorkflowManagerConfig{
+				WorkFlowManagerEnabled: true,
+			},
+		},
+		{
+			name:      "Success when sending failure helper enabled",
+			sfnClient: sfnClientMock{},
+			config: WorkflowManagerConfig{
+				WorkFlowManagerEnabled: true,
+			},
+		},
+		{
+			name: "Success when sending failure helper disabled",
+			config: WorkflowManagerConfig{
+				WorkFlowManagerEnabled: false,
+			},
+		},
+	}
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		wfmHelper := NewWFMHelper(test.sqsClient, test.sfnClient, test.config)
+
+		err := wfmHelper.SendFailure(errors.New("some etl error"), nil, "", "") //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+	}
+}
+
+func TestGetEventFromLocalFile(t *testing.T) {
+	eventPath := filepath.Join(t.TempDir(), "event.json")
+	content, _ := json.Marshal(getExpectedManagerEvent())
+	assert.Nil(t, ioutil.WriteFile(eventPath, content, 0644))
+
+	tests := []wfmHelperTestCase{
+		{
+			name:          "Success when reading the event from a local file",
+			input:         eventPath,
+			expectedEvent: getExpectedManagerEvent(),
+		},
+		{
+			name:          "Fail when the local event file does not exist",
+			input:         filepath.Join(t.TempDir(), "missing.json"),
+			expectedError: errors.New("no such file"),
+		},
+		{
+			name:          "Fail when the local event file is not set",
+			input:         "",
+			expectedError: errors.New("workflowManager.localEventPath is required when the workflow manager is disabled"),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		wfmHelper := NewWFMHelper(nil, nil, WorkflowManagerConfig{LocalEventPath: test.input.(string)})
+
+		event, err := wfmHelper.GetEvent(nil) //<--- function under test
+
+		assert.Equal(t, test.expectedEvent, event)
+		if test.expectedError != nil {
+			assert.Contains(t, err.Error(), test.expectedError.Error())
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+}
+
 func getManagerEvent() string {
 	var buffer bytes.Buffer
 
@@ -0,0 +1,222 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys of the fields that correlate the log lines of an event, filter on them in CloudWatch Logs Insights like
+// `filter importJobID = "456"`
+const (
+	ImportJobID = "importJobID"
+	ProcessID   = "processID"
+	ProviderID  = "providerID"
+	DataSource  = "dataSource"
+	MessageID   = "messageID"
+	ErrorKey    = "error"
+)
+
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (level Level) String() string {
+	switch level {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel reads debug, info, warn or error in any case, an empty level is info
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DebugLevel, nil
+	case "", "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return InfoLevel, errors.New(fmt.Sprintf("%q is not one of debug, info, warn, error", name))
+}
+
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err is the field of an error, nil errors are left out
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: ErrorKey}
+	}
+	return Field{Key: ErrorKey, Value: err.Error()}
+}
+
+// Logger writes leveled messages with fields. With returns a logger adding its fields to every line, the helpers
+// use it to attach the correlation fields of the event they process
+type Logger interface {
+	Debug(message string, fields ...Field)
+	Info(message string, fields ...Field)
+	Warn(message string, fields ...Field)
+	Error(message string, fields ...Field)
+	With(fields ...Field) Logger
+}
+
+// jsonLogger writes one json object per line: time, level, msg and then the fields in the order they were added
+type jsonLogger struct {
+	output *output
+	level  Level
+	fields []Field
+}
+
+// output is shared by a logger and the ones returned by its With, so their lines are never interleaved
+type output struct {
+	writer io.Writer
+	now    func() time.Time
+	mutex  sync.Mutex
+}
+
+func New(writer io.Writer, level Level) *jsonLogger {
+	return &jsonLogger{output: &output{writer: writer, now: time.Now}, level: level}
+}
+
+func (logger *jsonLogger) Debug(message string, fields ...Field) {
+	logger.write(DebugLevel, message, fields)
+}
+
+func (logger *jsonLogger) Info(message string, fields ...Field) {
+	logger.write(InfoLevel, message, fields)
+}
+
+func (logger *jsonLogger) Warn(message string, fields ...Field) {
+	logger.write(WarnLevel, message, fields)
+}
+
+func (logger *jsonLogger) Error(message string, fields ...Field) {
+	logger.write(ErrorLevel, message, fields)
+}
+
+func (logger *jsonLogger) With(fields ...Field) Logger {
+	return &jsonLogger{output: logger.output, level: logger.level, fields: merge(logger.fields, fields)}
+}
+
+func (logger *jsonLogger) write(level Level, message string, fields []Field) {
+	if level < logger.level {
+		return
+	}
+
+	line := &bytes.Buffer{}
+	line.WriteString(`{"time":`)
+	writeValue(line, logger.output.now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeValue(line, level.String())
+	line.WriteString(`,"msg":`)
+	writeValue(line, message)
+	for _, field := range merge(logger.fields, fields) {
+		if field.Value == nil {
+			continue
+		}
+		line.WriteString(",")
+		writeValue(line, field.Key)
+		line.WriteString(":")
+		writeValue(line, field.Value)
+	}
+	line.WriteString("}\n")
+
+	logger.output.mutex.Lock()
+	defer logger.output.mutex.Unlock()
+	logger.output.writer.Write(line.Bytes())
+}
+
+func writeValue(line *bytes.Buffer, value interface{}) {
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	line.Write(encoded)
+}
+
+// merge appends more to fields, a key that is already there keeps its position and takes the new value
+func merge(fields, more []Field) []Field {
+	if len(more) == 0 {
+		return fields
+	}
+
+	merged := make([]Field, len(fields), len(fields)+len(more))
+	copy(merged, fields)
+	for _, field := range more {
+		replaced := false
+		for i := range merged {
+			if merged[i].Key == field.Key {
+				merged[i] = field
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, field)
+		}
+	}
+	return merged
+}
+
+type nopLogger struct{}
+
+// Nop discards every line
+func Nop() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(string, ...Field) {}
+func (nopLogger) Info(string, ...Field)  {}
+func (nopLogger) Warn(string, ...Field)  {}
+func (nopLogger) Error(string, ...Field) {}
+func (nopLogger) With(...Field) Logger   { return nopLogger{} }
+
+var (
+	defaultLogger Logger = New(os.Stdout, InfoLevel)
+	defaultMutex  sync.RWMutex
+)
+
+// Default is the logger of the helpers and clients that were not given one
+func Default() Logger {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+
+	return defaultLogger
+}
+
+func SetDefault(logger Logger) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	defaultLogger = logger
+}
@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger(level Level) (*jsonLogger, *bytes.Buffer) {
+	buffer := &bytes.Buffer{}
+	logger := New(buffer, level)
+	logger.output.now = func() time.Time { return time.Date(2022, 2, 14, 10, 30, 0, 0, time.UTC) }
+	return logger, buffer
+}
+
+func TestLogger(t *testing.T) {
+	tests := []struct {
+		name          string
+		level         Level
+		log           func(logger Logger)
+		expectedLines []string
+	}{
+		{
+			name:  "Success when writing a json line with the fields in order",
+			level: InfoLevel,
+			log: func(logger Logger) {
+				logger.Info("Processed the event", F(ImportJobID, "456"), F("files", 2))
+			},
+			expectedLines: []string{
+				`{"time":"2022-02-14T10:30:00Z","level":"info","msg":"Processed the event","importJobID":"456","files":2}`,
+			},
+		},
+		{
+			name:  "Success when the lines below the level are left out",
+			level: WarnLevel,
+			log: func(logger Logger) {
+				logger.Debug("debug")
+				logger.Info("info")
+				logger.Warn("warn")
+				logger.Error("error", Err(errors.New("access denied")))
+			},
+			expectedLines: []string{
+				`{"time":"2022-02-14T10:30:00Z","level":"warn","msg":"warn"}`,
+				`{"time":"2022-02-14T10:30:00Z","level":"error","msg":"error","error":"access denied"}`,
+			},
+		},
+		{
+			name:  "Success when the fields of With are on every line and can be replaced",
+			level: DebugLevel,
+			log: func(logger Logger) {
+				eventLogger := logger.With(F(ImportJobID, "456"), F(ProcessID, "789"))
+				eventLogger.Debug("first", F(MessageID, "m-1"))
+				eventLogger.With(F(ProcessID, "790")).Info("second", Err(nil))
+				logger.Info("third")
+			},
+			expectedLines: []string{
+				`{"time":"2022-02-14T10:30:00Z","level":"debug","msg":"first","importJobID":"456","processID":"789","messageID":"m-1"}`,
+				`{"time":"2022-02-14T10:30:00Z","level":"info","msg":"second","importJobID":"456","processID":"790"}`,
+				`{"time":"2022-02-14T10:30:00Z","level":"info","msg":"third"}`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		logger, buffer := newTestLogger(test.level)
+
+		test.log(logger) //<--- function under test
+
+		assert.Equal(t, test.expectedLines, strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n"))
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		expectedResponse Level
+		expectedError    error
+	}{
+		{
+			name:             "Success when the level is in upper case",
+			input:            "DEBUG",
+			expectedResponse: DebugLevel,
+		},
+		{
+			name:             "Success when an empty level is info",
+			input:            "",
+			expectedResponse: InfoLevel,
+		},
+		{
+			name:             "Fail when the level is unknown",
+			input:            "verbose",
+			expectedResponse: InfoLevel,
+			expectedError:    errors.New(`"verbose" is not one of debug, info, warn, error`),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		response, err := ParseLevel(test.input) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		assert.Equal(t, test.expectedResponse, response)
+	}
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
-	"github.com/aws/aws-sdk-go/aws/session"
-	"sync"
+	"github.com/anhamdan/etl-base/config"
+	// ETL types hosted by this binary, the events are routed to them by their data source
+	"github.com/anhamdan/etl-base/etls/analyst"
+	"github.com/anhamdan/etl-base/helpers"
+	"github.com/anhamdan/etl-base/logging"
+	"os"
 )
 
-var awsSession *session.Session
-
 func main() {
-	// Set up the functionality for concurrent message handling
-	wg := &sync.WaitGroup{}
-	wg.Add(2)
-	wg.Wait()
+	// ETL_TYPE selects the config of the worker, the events of the other registered types are handled with it too
+	typeOfImport := config.GetAsString("ETL_TYPE", analyst.Name)
+	helper := helpers.NewBaseHelper(typeOfImport)
+	// -config <file> and -set <section.field>=<value> override the file of CONFIG_FILE and the environment variables
+	helper.SetArgs(os.Args[1:])
+	if err := helper.Run(); err != nil {
+		logging.Default().Error("The worker stopped", logging.Err(err))
+		os.Exit(1)
+	}
 }
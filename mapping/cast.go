@@ -0,0 +1,159 @@
+package mapping
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of the target fields
+const (
+	StringType    = "string"
+	IntType       = "int"
+	FloatType     = "float"
+	BoolType      = "bool"
+	TimestampType = "timestamp"
+)
+
+// cast converts value to the type of a field, null stays null
+func cast(value interface{}, fieldType string, format string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch fieldType {
+	case "":
+		return value, nil
+	case StringType:
+		return toString(value), nil
+	case IntType:
+		return toInt(value)
+	case FloatType:
+		return toFloat(value)
+	case BoolType:
+		return toBool(value)
+	case TimestampType:
+		return toTimestamp(value, format)
+	}
+	return nil, errors.New(fmt.Sprintf("unknown type %q", fieldType))
+}
+
+func castError(value interface{}, fieldType string) error {
+	return errors.New(fmt.Sprintf("cannot cast %#v to %s", value, fieldType))
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case json.Number:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+func toInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, castError(value, IntType)
+		}
+		return int64(v), nil
+	case json.Number:
+		// The numbers decoded with UseNumber keep the ids above 2^53 that a float64 would round
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := v.Float64()
+		if err != nil || f != math.Trunc(f) {
+			return 0, castError(value, IntType)
+		}
+		return int64(f), nil
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return 0, castError(value, IntType)
+		}
+		return i, nil
+	}
+	return 0, castError(value, IntType)
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, castError(value, FloatType)
+		}
+		return f, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, castError(value, FloatType)
+		}
+		return f, nil
+	}
+	return 0, castError(value, FloatType)
+}
+
+func toBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, castError(value, BoolType)
+		}
+		return b, nil
+	}
+	if f, err := toFloat(value); err == nil && (f == 0 || f == 1) {
+		return f == 1, nil
+	}
+	return false, castError(value, BoolType)
+}
+
+// toTimestamp parses the strings with format and the numbers as unix seconds
+func toTimestamp(value interface{}, format string) (time.Time, error) {
+	if format == "" {
+		format = time.RFC3339
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		t, err := time.Parse(format, strings.TrimSpace(v))
+		if err != nil {
+			return time.Time{}, castError(value, TimestampType)
+		}
+		return t.UTC(), nil
+	}
+	if f, err := toFloat(value); err == nil {
+		seconds, fraction := math.Modf(f)
+		return time.Unix(int64(seconds), int64(fraction*float64(time.Second))).UTC(), nil
+	}
+	return time.Time{}, castError(value, TimestampType)
+}
@@ -0,0 +1,405 @@
+package mapping
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// node is a compiled expression, evaluated against the source record and the target fields mapped before it
+type node interface {
+	eval(env *env) (interface{}, error)
+}
+
+type env struct {
+	source  interface{}
+	targets map[string]interface{}
+}
+
+// functions of the expressions, their arguments are evaluated first
+var functions = map[string]func(args []interface{}) (interface{}, error){
+	// concat joins its arguments as strings, skipping the nulls
+	"concat": func(args []interface{}) (interface{}, error) {
+		var builder strings.Builder
+		for _, arg := range args {
+			if arg != nil {
+				builder.WriteString(toString(arg))
+			}
+		}
+		return builder.String(), nil
+	},
+	// coalesce is its first argument that is not null
+	"coalesce": func(args []interface{}) (interface{}, error) {
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	},
+	"upper": stringFunction("upper", strings.ToUpper),
+	"lower": stringFunction("lower", strings.ToLower),
+	"trim":  stringFunction("trim", strings.TrimSpace),
+	// round rounds a number to its second argument of decimals, 0 by default
+	"round": func(args []interface{}) (interface{}, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, errors.New("round takes a number and an optional number of decimals")
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		number, err := toFloat(args[0])
+		if err != nil {
+			return nil, err
+		}
+		var decimals int64
+		if len(args) == 2 {
+			if decimals, err = toInt(args[1]); err != nil {
+				return nil, err
+			}
+		}
+		scale := math.Pow(10, float64(decimals))
+		return math.Round(number*scale) / scale, nil
+	},
+}
+
+func stringFunction(name string, fn func(string) string) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errors.New(fmt.Sprintf("%s takes one argument", name))
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		return fn(toString(args[0])), nil
+	}
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (n literal) eval(*env) (interface{}, error) {
+	return n.value, nil
+}
+
+type pathNode struct {
+	path Path
+}
+
+func (n pathNode) eval(env *env) (interface{}, error) {
+	return n.path.Get(env.source), nil
+}
+
+// targetNode is a target field mapped before the one of the expression
+type targetNode struct {
+	name string
+}
+
+func (n targetNode) eval(env *env) (interface{}, error) {
+	return env.targets[n.name], nil
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n callNode) eval(env *env) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return functions[n.name](args)
+}
+
+type negateNode struct {
+	operand node
+}
+
+func (n negateNode) eval(env *env) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	number, err := toFloat(value)
+	if err != nil {
+		return nil, err
+	}
+	return -number, nil
+}
+
+// binaryNode is an arithmetic operation, + concatenates two strings, a null operand gives null
+type binaryNode struct {
+	operator    byte
+	left, right node
+}
+
+func (n binaryNode) eval(env *env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	leftString, leftIsString := left.(string)
+	rightString, rightIsString := right.(string)
+	if n.operator == '+' && leftIsString && rightIsString {
+		return leftString + rightString, nil
+	}
+	a, err := toFloat(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toFloat(right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.operator {
+	case '+':
+		return a + b, nil
+	case '-':
+		return a - b, nil
+	case '*':
+		return a * b, nil
+	}
+	if b == 0 {
+		return nil, errors.New("division by zero")
+	}
+	return a / b, nil
+}
+
+// parser reads the expressions, with the usual precedence of * and / over + and -:
+//
+//	expression := term (("+" | "-") term)*
+//	term       := unary (("*" | "/") unary)*
+//	unary      := "-" unary | primary
+//	primary    := number | string | true | false | null | path | field | function "(" arguments ")" | "(" expression ")"
+type parser struct {
+	input string
+	pos   int
+	// targets are the fields an expression can refer to
+	targets map[string]bool
+}
+
+func parseExpression(input string, targets map[string]bool) (node, error) {
+	p := &parser{input: input, targets: targets}
+	n, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos])
+	}
+	return n, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return errors.New(fmt.Sprintf("invalid expression %q at %d: %s", p.input, p.pos, fmt.Sprintf(format, args...)))
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek skips the spaces and returns the next byte, 0 at the end
+func (p *parser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) expression() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for operator := p.peek(); operator == '+' || operator == '-'; operator = p.peek() {
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for operator := p.peek(); operator == '*' || operator == '/'; operator = p.peek() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negateNode{operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, p.errorf("unexpected end")
+	case c == '(':
+		p.pos++
+		n, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return n, nil
+	case c == '"' || c == '\'':
+		return p.stringLiteral(c)
+	case c == '$':
+		return p.path()
+	case c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	case c == '_' || unicode.IsLetter(rune(c)):
+		return p.identifier()
+	}
+	return nil, p.errorf("unexpected %q", c)
+}
+
+func (p *parser) stringLiteral(quote byte) (node, error) {
+	var builder strings.Builder
+	for p.pos++; p.pos < len(p.input); p.pos++ {
+		c := p.input[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.input):
+			p.pos++
+			builder.WriteByte(p.input[p.pos])
+		case c == quote:
+			p.pos++
+			return literal{value: builder.String()}, nil
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return nil, p.errorf("unclosed string")
+}
+
+// path reads up to the end of the json path, the brackets may hold any character
+func (p *parser) path() (node, error) {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if c == '[' {
+			end := strings.IndexByte(p.input[p.pos:], ']')
+			if end < 0 {
+				return nil, p.errorf("unclosed [")
+			}
+			p.pos += end + 1
+			continue
+		}
+		if c != '$' && c != '.' && c != '_' && !unicode.IsLetter(rune(c)) && !unicode.IsDigit(rune(c)) {
+			break
+		}
+		p.pos++
+	}
+	path, err := ParsePath(p.input[start:p.pos])
+	if err != nil {
+		return nil, p.errorf("%s", err.Error())
+	}
+	return pathNode{path: path}, nil
+}
+
+func (p *parser) number() (node, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] == '.' || (p.input[p.pos] >= '0' && p.input[p.pos] <= '9')) {
+		p.pos++
+	}
+	number, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %q", p.input[start:p.pos])
+	}
+	return literal{value: number}, nil
+}
+
+func (p *parser) identifier() (node, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] == '_' || unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+
+	switch name {
+	case "true":
+		return literal{value: true}, nil
+	case "false":
+		return literal{value: false}, nil
+	case "null":
+		return literal{value: nil}, nil
+	}
+
+	if p.peek() != '(' {
+		if !p.targets[name] {
+			return nil, p.errorf("%q is not a target field defined before", name)
+		}
+		return targetNode{name: name}, nil
+	}
+	if _, ok := functions[name]; !ok {
+		return nil, p.errorf("unknown function %q", name)
+	}
+	p.pos++
+	call := callNode{name: name}
+	if p.peek() == ')' {
+		p.pos++
+		return call, nil
+	}
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return call, nil
+		default:
+			return nil, p.errorf("missing ) after the arguments of %s", name)
+		}
+	}
+}
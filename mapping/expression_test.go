@@ -0,0 +1,90 @@
+package mapping
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExpression(t *testing.T) {
+	source := map[string]interface{}{
+		"firstName": "Ada",
+		"lastName":  "Lovelace",
+		"price":     10.0,
+		"tags":      []interface{}{"a", "b"},
+		"odd key":   " x ",
+	}
+	targets := map[string]interface{}{"quantity": int64(3)}
+
+	tests := []struct {
+		name          string
+		expression    string
+		expectedValue interface{}
+		expectedError error
+	}{
+		{
+			name:          "Success when concatenating paths and literals",
+			expression:    `concat($.firstName, ' ', $.lastName, " #", $.tags[1])`,
+			expectedValue: "Ada Lovelace #b",
+		},
+		{
+			name:          "Success when computing with the precedence of the operators",
+			expression:    "-$.price + quantity * 2 / (1 + 1)",
+			expectedValue: float64(-7),
+		},
+		{
+			name:          "Success when adding two strings",
+			expression:    `$.firstName + "!"`,
+			expectedValue: "Ada!",
+		},
+		{
+			name:          "Success when a null operand gives null and coalesce replaces it",
+			expression:    `coalesce($.missing * 2, lower(trim($['odd key'])))`,
+			expectedValue: "x",
+		},
+		{
+			name:          "Success when rounding a number",
+			expression:    "round($.price / 3, 2)",
+			expectedValue: 3.33,
+		},
+		{
+			name:          "Fail when dividing by zero",
+			expression:    "$.price / 0",
+			expectedError: errors.New("division by zero"),
+		},
+		{
+			name:          "Fail when computing with a string",
+			expression:    "$.firstName * 2",
+			expectedError: errors.New(`cannot cast "Ada" to float`),
+		},
+		{
+			name:          "Fail when the function is unknown",
+			expression:    "reverse($.firstName)",
+			expectedError: errors.New(`invalid expression "reverse($.firstName)" at 7: unknown function "reverse"`),
+		},
+		{
+			name:          "Fail when a parenthesis is missing",
+			expression:    "concat($.firstName",
+			expectedError: errors.New(`invalid expression "concat($.firstName" at 18: missing ) after the arguments of concat`),
+		},
+		{
+			name:          "Fail when the expression has trailing tokens",
+			expression:    "$.price 2",
+			expectedError: errors.New(`invalid expression "$.price 2" at 8: unexpected '2'`),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		var value interface{}
+		expression, err := parseExpression(test.expression, map[string]bool{"quantity": true}) //<--- function under test
+		if err == nil {
+			value, err = expression.eval(&env{source: source, targets: targets}) //<--- function under test
+		}
+
+		assert.Equal(t, test.expectedError, err)
+		assert.Equal(t, test.expectedValue, value)
+	}
+}
@@ -0,0 +1,175 @@
+package mapping
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/pipeline"
+)
+
+// Column is a target field of a mapped record
+type Column struct {
+	Name  string
+	Value interface{}
+}
+
+// Record is a mapped record, it marshals to a json object with the fields in the order of the spec
+type Record []Column
+
+// Get is the value of a field, nil when the record has no such field
+func (record Record) Get(name string) interface{} {
+	for _, column := range record {
+		if column.Name == name {
+			return column.Value
+		}
+	}
+	return nil
+}
+
+func (record Record) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, column := range record {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		name, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(column.Value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+type compiledField struct {
+	Field
+	path       *Path
+	expression node
+	lookup     map[string]interface{}
+}
+
+type mapper struct {
+	fields []compiledField
+}
+
+// Compile checks the spec and compiles its paths and expressions, the errors name the field
+func Compile(spec Spec) (*mapper, error) {
+	if len(spec.Fields) == 0 {
+		return nil, errors.New("the mapping spec has no fields")
+	}
+
+	m := &mapper{}
+	targets := map[string]bool{}
+	for i, field := range spec.Fields {
+		compiled, err := compileField(field, spec.Lookups, targets)
+		if err != nil {
+			name := field.Target
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, errors.New(fmt.Sprintf("invalid mapping of the field %s, error: %s", name, err.Error()))
+		}
+		m.fields = append(m.fields, compiled)
+		targets[field.Target] = true
+	}
+	return m, nil
+}
+
+func compileField(field Field, lookups map[string]map[string]interface{}, targets map[string]bool) (compiledField, error) {
+	compiled := compiledField{Field: field}
+	switch {
+	case field.Target == "":
+		return compiled, errors.New("the target is required")
+	case targets[field.Target]:
+		return compiled, errors.New("the target is mapped twice")
+	case field.Source != "" && field.Expression != "":
+		return compiled, errors.New("the source and the expression are exclusive")
+	case field.Source == "" && field.Expression == "" && field.Default == nil:
+		return compiled, errors.New("one of the source, the expression or the default is required")
+	}
+	switch field.Type {
+	case "", StringType, IntType, FloatType, BoolType, TimestampType:
+	default:
+		return compiled, errors.New(fmt.Sprintf("unknown type %q", field.Type))
+	}
+	if _, err := cast(field.Default, field.Type, field.Format); err != nil {
+		return compiled, errors.New(fmt.Sprintf("the default %s", err.Error()))
+	}
+
+	if field.Source != "" {
+		path, err := ParsePath(field.Source)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.path = &path
+	}
+	if field.Expression != "" {
+		expression, err := parseExpression(field.Expression, targets)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.expression = expression
+	}
+	if field.Lookup != "" {
+		lookup, ok := lookups[field.Lookup]
+		if !ok {
+			return compiled, errors.New(fmt.Sprintf("the lookup %q is not defined", field.Lookup))
+		}
+		compiled.lookup = lookup
+	}
+	return compiled, nil
+}
+
+// Map maps a source record, decoded from json, to the target fields
+func (m *mapper) Map(source interface{}) (Record, error) {
+	env := &env{source: source, targets: make(map[string]interface{}, len(m.fields))}
+	record := make(Record, 0, len(m.fields))
+	for _, field := range m.fields {
+		value, err := field.value(env)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("failed to map the field %s, error: %s", field.Target, err.Error()))
+		}
+		env.targets[field.Target] = value
+		record = append(record, Column{Name: field.Target, Value: value})
+	}
+	return record, nil
+}
+
+func (field compiledField) value(env *env) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch {
+	case field.path != nil:
+		value = field.path.Get(env.source)
+	case field.expression != nil:
+		if value, err = field.expression.eval(env); err != nil {
+			return nil, err
+		}
+	}
+	if field.lookup != nil && value != nil {
+		value = field.lookup[toString(value)]
+	}
+	if value == nil {
+		value = field.Default
+	}
+	if value == nil && field.Required {
+		return nil, errors.New("the value is required")
+	}
+	return cast(value, field.Type, field.Format)
+}
+
+// Stage maps every record of a pipeline
+func (m *mapper) Stage(opts ...pipeline.Option) pipeline.Stage[map[string]interface{}, Record] {
+	return pipeline.Map(func(source map[string]interface{}) (Record, error) {
+		return m.Map(source)
+	}, opts...)
+}
@@ -0,0 +1,234 @@
+package mapping
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/pipeline"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+const treeElemSpec = `
+fields:
+  - target: tree_elem_id
+    source: $.treeElemId
+    type: int
+    required: true
+  - target: name
+    source: $.name
+    type: string
+    default: unnamed
+  - target: container
+    source: $.containerType
+    lookup: containerTypes
+    default: unknown
+  - target: parent_id
+    source: $.parent.ids[0]
+    type: string
+  - target: label
+    expression: upper(concat(name, " (", container, ")"))
+  - target: updated_at
+    source: $['updated at']
+    type: timestamp
+    format: "2006-01-02 15:04"
+  - target: enabled
+    source: $.elementEnable
+    type: bool
+lookups:
+  containerTypes:
+    1: folder
+    2: file
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expectedSpec  Spec
+		expectedError error
+	}{
+		{
+			name:    "Success when parsing a json spec",
+			content: `{"fields": [{"target": "id", "source": "$.id", "type": "int"}], "lookups": {"kinds": {"a": "b"}}}`,
+			expectedSpec: Spec{
+				Fields:  []Field{{Target: "id", Source: "$.id", Type: "int"}},
+				Lookups: map[string]map[string]interface{}{"kinds": {"a": "b"}},
+			},
+		},
+		{
+			name:          "Fail when the spec has an unknown key",
+			content:       "fields:\n  - target: id\n    sources: $.id\n",
+			expectedError: errors.New("failed to parse the mapping spec, error: yaml: unmarshal errors:\n  line 3: field sources not found in type mapping.Field"),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		spec, err := Parse([]byte(test.content)) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		assert.Equal(t, test.expectedSpec, spec)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name          string
+		fields        []Field
+		expectedError error
+	}{
+		{
+			name:          "Fail when a field has no target",
+			fields:        []Field{{Source: "$.id"}},
+			expectedError: errors.New("invalid mapping of the field #1, error: the target is required"),
+		},
+		{
+			name:          "Fail when a target is mapped twice",
+			fields:        []Field{{Target: "id", Source: "$.id"}, {Target: "id", Source: "$.key"}},
+			expectedError: errors.New("invalid mapping of the field id, error: the target is mapped twice"),
+		},
+		{
+			name:          "Fail when a field has neither a source, an expression nor a default",
+			fields:        []Field{{Target: "id"}},
+			expectedError: errors.New("invalid mapping of the field id, error: one of the source, the expression or the default is required"),
+		},
+		{
+			name:          "Fail when the type is unknown",
+			fields:        []Field{{Target: "id", Source: "$.id", Type: "integer"}},
+			expectedError: errors.New(`invalid mapping of the field id, error: unknown type "integer"`),
+		},
+		{
+			name:          "Fail when the default does not match the type",
+			fields:        []Field{{Target: "id", Source: "$.id", Type: "int", Default: "none"}},
+			expectedError: errors.New(`invalid mapping of the field id, error: the default cannot cast "none" to int`),
+		},
+		{
+			name:          "Fail when the source is not a json path",
+			fields:        []Field{{Target: "id", Source: "id"}},
+			expectedError: errors.New(`invalid mapping of the field id, error: the path "id" does not start with $`),
+		},
+		{
+			name:          "Fail when the lookup is not defined",
+			fields:        []Field{{Target: "id", Source: "$.id", Lookup: "ids"}},
+			expectedError: errors.New(`invalid mapping of the field id, error: the lookup "ids" is not defined`),
+		},
+		{
+			name:          "Fail when an expression refers to a field defined after it",
+			fields:        []Field{{Target: "label", Expression: "upper(name)"}, {Target: "name", Source: "$.name"}},
+			expectedError: errors.New(`invalid mapping of the field label, error: invalid expression "upper(name)" at 10: "name" is not a target field defined before`),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		_, err := Compile(Spec{Fields: test.fields}) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+	}
+}
+
+func TestMap(t *testing.T) {
+	spec, err := Parse([]byte(treeElemSpec))
+	assert.Nil(t, err)
+	mapper, err := Compile(spec)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name           string
+		source         string
+		expectedRecord Record
+		expectedError  error
+	}{
+		{
+			name:   "Success when mapping every field of the spec",
+			source: `{"treeElemId": "12", "name": "root", "containerType": 1, "parent": {"ids": [7, 8]}, "updated at": "2022-02-14 10:30", "elementEnable": 1}`,
+			expectedRecord: Record{
+				{Name: "tree_elem_id", Value: int64(12)},
+				{Name: "name", Value: "root"},
+				{Name: "container", Value: "folder"},
+				{Name: "parent_id", Value: "7"},
+				{Name: "label", Value: "ROOT (FOLDER)"},
+				{Name: "updated_at", Value: time.Date(2022, 2, 14, 10, 30, 0, 0, time.UTC)},
+				{Name: "enabled", Value: true},
+			},
+		},
+		{
+			name:   "Success when the missing fields and lookups take their defaults",
+			source: `{"treeElemId": 12, "containerType": 9}`,
+			expectedRecord: Record{
+				{Name: "tree_elem_id", Value: int64(12)},
+				{Name: "name", Value: "unnamed"},
+				{Name: "container", Value: "unknown"},
+				{Name: "parent_id", Value: nil},
+				{Name: "label", Value: "UNNAMED (UNKNOWN)"},
+				{Name: "updated_at", Value: nil},
+				{Name: "enabled", Value: nil},
+			},
+		},
+		{
+			name:          "Fail when a required field is missing",
+			source:        `{"name": "root"}`,
+			expectedError: errors.New("failed to map the field tree_elem_id, error: the value is required"),
+		},
+		{
+			name:          "Fail when a value cannot be cast",
+			source:        `{"treeElemId": 1.5}`,
+			expectedError: errors.New("failed to map the field tree_elem_id, error: cannot cast 1.5 to int"),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		var source map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(test.source), &source))
+
+		record, err := mapper.Map(source) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		assert.Equal(t, test.expectedRecord, record)
+	}
+}
+
+func TestMapNumbers(t *testing.T) {
+	fmt.Println("name: Success when the numbers decoded with UseNumber keep the ids above 2^53")
+
+	spec, err := Parse([]byte(treeElemSpec))
+	assert.Nil(t, err)
+	mapper, err := Compile(spec)
+	assert.Nil(t, err)
+	decoder := json.NewDecoder(strings.NewReader(`{"treeElemId": 9007199254740993, "containerType": 1, "parent": {"ids": [9007199254740995]}, "elementEnable": 0}`))
+	decoder.UseNumber()
+	var source map[string]interface{}
+	assert.Nil(t, decoder.Decode(&source))
+
+	record, err := mapper.Map(source) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9007199254740993), record.Get("tree_elem_id"))
+	assert.Equal(t, "folder", record.Get("container"))
+	assert.Equal(t, "9007199254740995", record.Get("parent_id"))
+	assert.Equal(t, false, record.Get("enabled"))
+}
+
+func TestStage(t *testing.T) {
+	fmt.Println("name: Success when the compiled stage maps the records of a pipeline, marshalled in the order of the spec")
+
+	mapper, err := Compile(Spec{Fields: []Field{
+		{Target: "id", Source: "$.id", Type: "int"},
+		{Target: "code", Source: "$.code", Type: "string", Default: "n/a"},
+	}})
+	assert.Nil(t, err)
+	var records []Record
+
+	err = pipeline.Run(context.Background(), pipeline.Through(pipeline.FromSlice([]map[string]interface{}{{"id": 2.0}, {"id": "3", "code": 44.0}}), mapper.Stage()), pipeline.Collect(&records)) //<--- function under test
+
+	assert.Nil(t, err)
+	content, _ := json.Marshal(records)
+	assert.Equal(t, `[{"id":2,"code":"n/a"},{"id":3,"code":"44"}]`, string(content))
+}
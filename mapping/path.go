@@ -0,0 +1,87 @@
+package mapping
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled path of the json path subset of the specs: $ followed by .key, ['key'] or [index] segments
+type Path struct {
+	expression string
+	segments   []segment
+}
+
+type segment struct {
+	key   string
+	index int
+	// isIndex selects index instead of key
+	isIndex bool
+}
+
+// ParsePath compiles a json path like $.name, $.parent.ids[0] or $['odd key']
+func ParsePath(expression string) (Path, error) {
+	path := Path{expression: expression}
+	if !strings.HasPrefix(expression, "$") {
+		return path, errors.New(fmt.Sprintf("the path %q does not start with $", expression))
+	}
+
+	rest := expression[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return path, errors.New(fmt.Sprintf("the path %q has an empty key", expression))
+			}
+			path.segments = append(path.segments, segment{key: key})
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return path, errors.New(fmt.Sprintf("the path %q has an unclosed [", expression))
+			}
+			inside := rest[1:end]
+			if len(inside) >= 2 && (inside[0] == '\'' || inside[0] == '"') && inside[len(inside)-1] == inside[0] {
+				path.segments = append(path.segments, segment{key: inside[1 : len(inside)-1]})
+			} else {
+				index, err := strconv.Atoi(inside)
+				if err != nil || index < 0 {
+					return path, errors.New(fmt.Sprintf("the path %q has an invalid index %q", expression, inside))
+				}
+				path.segments = append(path.segments, segment{index: index, isIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return path, errors.New(fmt.Sprintf("the path %q has an unexpected %q", expression, rest[0]))
+		}
+	}
+	return path, nil
+}
+
+// Get is the value at the path in a record decoded from json, nil when a key or an index is missing
+func (path Path) Get(record interface{}) interface{} {
+	value := record
+	for _, segment := range path.segments {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			if segment.isIndex {
+				return nil
+			}
+			value = current[segment.key]
+		case []interface{}:
+			if !segment.isIndex || segment.index >= len(current) {
+				return nil
+			}
+			value = current[segment.index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
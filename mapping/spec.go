@@ -0,0 +1,57 @@
+// Package mapping compiles a declarative spec, written in yaml or json, into a transform stage mapping the source
+// records to the target fields: renames through json paths, type casts, defaults, lookups and simple expressions
+package mapping
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+)
+
+// Spec lists the target fields of a record in their output order
+type Spec struct {
+	Fields []Field `yaml:"fields"`
+	// Lookups are the tables of the fields with a lookup, by name, their keys are matched with the value as a string
+	Lookups map[string]map[string]interface{} `yaml:"lookups"`
+}
+
+// Field is a target field. Its value is the one of Source, or of Expression, replaced through Lookup, then Default
+// when it is still null, then cast to Type
+type Field struct {
+	Target string `yaml:"target"`
+	// Source is a json path in the source record, like $.name, $.parent.id or $.tags[0]
+	Source string `yaml:"source"`
+	// Expression computes the value from the source record and the target fields before this one, like
+	// concat($.firstName, " ", $.lastName) or price * 1.2
+	Expression string `yaml:"expression"`
+	// Type is one of string, int, float, bool or timestamp, the value is kept as it is when it is empty
+	Type string `yaml:"type"`
+	// Format is the layout of the timestamps given as strings, RFC 3339 by default
+	Format   string      `yaml:"format"`
+	Default  interface{} `yaml:"default"`
+	Lookup   string      `yaml:"lookup"`
+	Required bool        `yaml:"required"`
+}
+
+// Parse reads a spec in yaml or json, the unknown keys are errors
+func Parse(content []byte) (Spec, error) {
+	var spec Spec
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil && err != io.EOF {
+		return Spec{}, errors.New(fmt.Sprintf("failed to parse the mapping spec, error: %s", err.Error()))
+	}
+	return spec, nil
+}
+
+// Load reads the spec of a file
+func Load(path string) (Spec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Spec{}, err
+	}
+	return Parse(content)
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxEMFValues is the most values cloudwatch accepts for a metric in one document
+const maxEMFValues = 100
+
+// emfExporter buffers the values and writes them as CloudWatch Embedded Metric Format documents, one json line per
+// label set. Counters are summed since the previous flush, every observation of a histogram is kept
+type emfExporter struct {
+	writer    io.Writer
+	namespace string
+	now       func() time.Time
+	groups    map[string]*emfGroup
+	mutex     sync.Mutex
+}
+
+type emfGroup struct {
+	labels []Label
+	names  []string
+	values map[string][]float64
+}
+
+type EMFExporter interface {
+	Metrics
+	Flush() error
+	Start(interval time.Duration) (stop func())
+}
+
+func NewEMFExporter(writer io.Writer, namespace string) EMFExporter {
+	exporter := &emfExporter{writer: writer, namespace: namespace, now: time.Now, groups: map[string]*emfGroup{}}
+	return emfMetrics{withLabels: withLabels{recorder: exporter}, exporter: exporter}
+}
+
+// emfMetrics adds the With of the labels to the exporter
+type emfMetrics struct {
+	withLabels
+	exporter *emfExporter
+}
+
+func (metrics emfMetrics) Flush() error {
+	return metrics.exporter.Flush()
+}
+
+func (metrics emfMetrics) Start(interval time.Duration) (stop func()) {
+	return metrics.exporter.Start(interval)
+}
+
+func (exporter *emfExporter) Count(name string, value float64, labels ...Label) {
+	exporter.record(name, value, labels, true)
+}
+
+func (exporter *emfExporter) Observe(name string, value float64, labels ...Label) {
+	exporter.record(name, value, labels, false)
+}
+
+func (exporter *emfExporter) record(name string, value float64, labels []Label, sum bool) {
+	labels = sortedLabels(labels)
+	key := seriesKey("", labels)
+
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	group, ok := exporter.groups[key]
+	if !ok {
+		group = &emfGroup{labels: labels, values: map[string][]float64{}}
+		exporter.groups[key] = group
+	}
+	values, ok := group.values[name]
+	if !ok {
+		group.names = append(group.names, name)
+	}
+	if sum && len(values) == 1 {
+		values[0] += value
+		return
+	}
+	group.values[name] = append(values, value)
+}
+
+// Flush writes the buffered values and starts over, nothing is written when there are none
+func (exporter *emfExporter) Flush() error {
+	exporter.mutex.Lock()
+	groups := exporter.groups
+	exporter.groups = map[string]*emfGroup{}
+	exporter.mutex.Unlock()
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	timestamp := exporter.now().UnixNano() / int64(time.Millisecond)
+	for _, key := range keys {
+		for _, document := range exporter.documents(groups[key], timestamp) {
+			line, err := json.Marshal(document)
+			if err != nil {
+				return err
+			}
+			if _, err := exporter.writer.Write(append(line, '\n')); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// documents splits the values of a group in documents of at most maxEMFValues values per metric
+func (exporter *emfExporter) documents(group *emfGroup, timestamp int64) []map[string]interface{} {
+	dimensions := make([]string, len(group.labels))
+	for i, label := range group.labels {
+		dimensions[i] = label.Key
+	}
+	names := append([]string{}, group.names...)
+	sort.Strings(names)
+
+	documents := []map[string]interface{}{}
+	for start := 0; ; start += maxEMFValues {
+		document := map[string]interface{}{}
+		definitions := []map[string]string{}
+		for _, name := range names {
+			values := group.values[name]
+			if start >= len(values) {
+				continue
+			}
+			end := start + maxEMFValues
+			if end > len(values) {
+				end = len(values)
+			}
+			definitions = append(definitions, map[string]string{"Name": name, "Unit": unit(name)})
+			if end-start == 1 {
+				document[name] = values[start]
+			} else {
+				document[name] = values[start:end]
+			}
+		}
+		if len(definitions) == 0 {
+			return documents
+		}
+
+		for _, label := range group.labels {
+			document[label.Key] = label.Value
+		}
+		document["_aws"] = map[string]interface{}{
+			"Timestamp": timestamp,
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  exporter.namespace,
+				"Dimensions": [][]string{dimensions},
+				"Metrics":    definitions,
+			}},
+		}
+		documents = append(documents, document)
+	}
+}
+
+// Start flushes every interval until stop is called, stop flushes what is left
+func (exporter *emfExporter) Start(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				exporter.Flush()
+			case <-done:
+				exporter.Flush()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
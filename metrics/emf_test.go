@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEMFExporter(t *testing.T) {
+	fmt.Println("name: Success when writing one document per label set with the summed counters and the observations")
+
+	output := &bytes.Buffer{}
+	exporter := NewEMFExporter(output, "etl")
+	exporter.(emfMetrics).exporter.now = func() time.Time { return time.Date(2022, 2, 14, 10, 30, 0, 0, time.UTC) }
+
+	analyst := exporter.With(L(DataSource, "analyst"))
+	analyst.Count(RecordsDecoded, 10)
+	analyst.Count(RecordsDecoded, 5)
+	analyst.Observe(EventDuration, 1.5)
+	analyst.Observe(EventDuration, 0.5)
+	exporter.Count(MessagesFailed, 1, L(Operation, "receive"))
+
+	err := exporter.Flush() //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		`{"_aws":{"CloudWatchMetrics":[{"Dimensions":[["dataSource"]],"Metrics":[{"Name":"etl_event_duration_seconds","Unit":"Seconds"},{"Name":"etl_records_decoded_total","Unit":"Count"}],"Namespace":"etl"}],"Timestamp":1644834600000},"dataSource":"analyst","etl_event_duration_seconds":[1.5,0.5],"etl_records_decoded_total":15}`,
+		`{"_aws":{"CloudWatchMetrics":[{"Dimensions":[["operation"]],"Metrics":[{"Name":"etl_messages_failed_total","Unit":"Count"}],"Namespace":"etl"}],"Timestamp":1644834600000},"etl_messages_failed_total":1,"operation":"receive"}`,
+	}, strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n"))
+
+	output.Reset()
+	err = exporter.Flush() //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, "", output.String())
+}
+
+func TestEMFExporterSplitsLargeHistograms(t *testing.T) {
+	fmt.Println("name: Success when a histogram with more than 100 observations is split in several documents")
+
+	output := &bytes.Buffer{}
+	exporter := NewEMFExporter(output, "etl")
+	for i := 0; i < 150; i++ {
+		exporter.Observe(S3WriteDuration, 0.1)
+	}
+
+	err := exporter.Flush() //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(output.String(), "\n"))
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Names of the metrics of the helpers. Counters end with _total, histograms with their unit
+const (
+	MessagesReceived = "etl_messages_received_total"
+	MessagesDeleted  = "etl_messages_deleted_total"
+	MessagesFailed   = "etl_messages_failed_total"
+	EventsParsed     = "etl_events_parsed_total"
+	EventsProcessed  = "etl_events_processed_total"
+	EventDuration    = "etl_event_duration_seconds"
+	S3BytesRead      = "etl_s3_read_bytes_total"
+	S3BytesWritten   = "etl_s3_written_bytes_total"
+	S3ReadDuration   = "etl_s3_read_duration_seconds"
+	S3WriteDuration  = "etl_s3_write_duration_seconds"
+	RecordsDecoded   = "etl_records_decoded_total"
+	RecordsEncoded   = "etl_records_encoded_total"
+	RecordsRejected  = "etl_records_rejected_total"
+	TaskSuccesses    = "etl_task_successes_total"
+	TaskFailures     = "etl_task_failures_total"
+	Retries          = "etl_retries_total"
+)
+
+// Keys and values of the labels. Only values with a small number of variants are used, like the data source, never
+// ids of jobs or messages
+const (
+	DataSource = "dataSource"
+	Operation  = "operation"
+	Result     = "result"
+	Success    = "success"
+	Failure    = "failure"
+)
+
+type Label struct {
+	Key   string
+	Value string
+}
+
+func L(key, value string) Label {
+	return Label{Key: key, Value: value}
+}
+
+// Metrics records counters and histograms. With returns metrics adding its labels to every value, the runtime uses
+// it to label the values of an event with its data source
+type Metrics interface {
+	Count(name string, value float64, labels ...Label)
+	Observe(name string, value float64, labels ...Label)
+	With(labels ...Label) Metrics
+}
+
+// recorder is what an exporter implements, With is added by withLabels
+type recorder interface {
+	Count(name string, value float64, labels ...Label)
+	Observe(name string, value float64, labels ...Label)
+}
+
+type withLabels struct {
+	recorder recorder
+	labels   []Label
+}
+
+func (metrics withLabels) Count(name string, value float64, labels ...Label) {
+	metrics.recorder.Count(name, value, merge(metrics.labels, labels)...)
+}
+
+func (metrics withLabels) Observe(name string, value float64, labels ...Label) {
+	metrics.recorder.Observe(name, value, merge(metrics.labels, labels)...)
+}
+
+func (metrics withLabels) With(labels ...Label) Metrics {
+	return withLabels{recorder: metrics.recorder, labels: merge(metrics.labels, labels)}
+}
+
+// merge appends more to labels, a key that is already there takes the new value
+func merge(labels, more []Label) []Label {
+	merged := make([]Label, len(labels), len(labels)+len(more))
+	copy(merged, labels)
+	for _, label := range more {
+		replaced := false
+		for i := range merged {
+			if merged[i].Key == label.Key {
+				merged[i] = label
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, label)
+		}
+	}
+	return merged
+}
+
+// sortedLabels orders the labels by key, so a label set always has the same series key
+func sortedLabels(labels []Label) []Label {
+	sorted := merge(nil, labels)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	return sorted
+}
+
+func seriesKey(name string, labels []Label) string {
+	key := strings.Builder{}
+	key.WriteString(name)
+	for _, label := range labels {
+		key.WriteString("\x00" + label.Key + "=" + label.Value)
+	}
+	return key.String()
+}
+
+// unit is the unit of a metric from the suffix of its name
+func unit(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		return "Seconds"
+	case strings.HasSuffix(name, "_bytes") || strings.HasSuffix(name, "_bytes_total"):
+		return "Bytes"
+	default:
+		return "Count"
+	}
+}
+
+type nopMetrics struct{}
+
+// Nop discards every value
+func Nop() Metrics {
+	return nopMetrics{}
+}
+
+func (nopMetrics) Count(string, float64, ...Label)   {}
+func (nopMetrics) Observe(string, float64, ...Label) {}
+func (nopMetrics) With(...Label) Metrics             { return nopMetrics{} }
+
+// Multi records every value on all of metrics, like a prometheus registry and cloudwatch
+func Multi(metrics ...Metrics) Metrics {
+	return withLabels{recorder: multi(metrics)}
+}
+
+type multi []Metrics
+
+func (metrics multi) Count(name string, value float64, labels ...Label) {
+	for _, m := range metrics {
+		m.Count(name, value, labels...)
+	}
+}
+
+func (metrics multi) Observe(name string, value float64, labels ...Label) {
+	for _, m := range metrics {
+		m.Observe(name, value, labels...)
+	}
+}
+
+var (
+	defaultMetrics Metrics = Nop()
+	defaultMutex   sync.RWMutex
+)
+
+// Default is the metrics of the helpers and clients that were not given one, nothing is recorded until it is set
+func Default() Metrics {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+
+	return defaultMetrics
+}
+
+func SetDefault(metrics Metrics) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	defaultMetrics = metrics
+}
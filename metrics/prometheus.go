@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Buckets of the histograms by unit, the upper bounds of the seconds ones follow the prometheus client defaults
+var (
+	SecondsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+	BytesBuckets   = []float64{1 << 10, 16 << 10, 256 << 10, 1 << 20, 16 << 20, 256 << 20, 1 << 30}
+	CountBuckets   = []float64{1, 10, 100, 1000, 10000, 100000, 1000000}
+)
+
+// registry keeps the counters and histograms in memory and writes them in the prometheus text exposition format
+type registry struct {
+	counters   map[string]*counterSeries
+	histograms map[string]*histogramSeries
+	mutex      sync.Mutex
+}
+
+type counterSeries struct {
+	name   string
+	labels []Label
+	value  float64
+}
+
+type histogramSeries struct {
+	name    string
+	labels  []Label
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+type Registry interface {
+	Metrics
+	WritePrometheus(writer io.Writer) error
+	Handler() http.Handler
+}
+
+func NewRegistry() Registry {
+	registry := &registry{counters: map[string]*counterSeries{}, histograms: map[string]*histogramSeries{}}
+	return registryMetrics{withLabels: withLabels{recorder: registry}, registry: registry}
+}
+
+// registryMetrics adds the With of the labels to the registry
+type registryMetrics struct {
+	withLabels
+	registry *registry
+}
+
+func (metrics registryMetrics) WritePrometheus(writer io.Writer) error {
+	return metrics.registry.WritePrometheus(writer)
+}
+
+func (metrics registryMetrics) Handler() http.Handler {
+	return metrics.registry.Handler()
+}
+
+func (registry *registry) Count(name string, value float64, labels ...Label) {
+	labels = sortedLabels(labels)
+	key := seriesKey(name, labels)
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	series, ok := registry.counters[key]
+	if !ok {
+		series = &counterSeries{name: name, labels: labels}
+		registry.counters[key] = series
+	}
+	series.value += value
+}
+
+func (registry *registry) Observe(name string, value float64, labels ...Label) {
+	labels = sortedLabels(labels)
+	key := seriesKey(name, labels)
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	series, ok := registry.histograms[key]
+	if !ok {
+		buckets := bucketsOf(name)
+		series = &histogramSeries{name: name, labels: labels, buckets: buckets, counts: make([]uint64, len(buckets))}
+		registry.histograms[key] = series
+	}
+	for i, bound := range series.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+func bucketsOf(name string) []float64 {
+	switch unit(name) {
+	case "Seconds":
+		return SecondsBuckets
+	case "Bytes":
+		return BytesBuckets
+	default:
+		return CountBuckets
+	}
+}
+
+// WritePrometheus writes every series sorted by name and labels, the bucket counts are cumulative
+func (registry *registry) WritePrometheus(writer io.Writer) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	output := &bytes.Buffer{}
+
+	counters := make([]*counterSeries, 0, len(registry.counters))
+	for _, series := range registry.counters {
+		counters = append(counters, series)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return seriesKey(counters[i].name, counters[i].labels) < seriesKey(counters[j].name, counters[j].labels)
+	})
+	for i, series := range counters {
+		if i == 0 || counters[i-1].name != series.name {
+			fmt.Fprintf(output, "# TYPE %s counter\n", series.name)
+		}
+		fmt.Fprintf(output, "%s%s %s\n", series.name, formatLabels(series.labels), formatValue(series.value))
+	}
+
+	histograms := make([]*histogramSeries, 0, len(registry.histograms))
+	for _, series := range registry.histograms {
+		histograms = append(histograms, series)
+	}
+	sort.Slice(histograms, func(i, j int) bool {
+		return seriesKey(histograms[i].name, histograms[i].labels) < seriesKey(histograms[j].name, histograms[j].labels)
+	})
+	for i, series := range histograms {
+		if i == 0 || histograms[i-1].name != series.name {
+			fmt.Fprintf(output, "# TYPE %s histogram\n", series.name)
+		}
+		for j, bound := range series.buckets {
+			fmt.Fprintf(output, "%s_bucket%s %d\n", series.name, formatLabels(series.labels, L("le", formatValue(bound))), series.counts[j])
+		}
+		fmt.Fprintf(output, "%s_bucket%s %d\n", series.name, formatLabels(series.labels, L("le", "+Inf")), series.count)
+		fmt.Fprintf(output, "%s_sum%s %s\n", series.name, formatLabels(series.labels), formatValue(series.sum))
+		fmt.Fprintf(output, "%s_count%s %d\n", series.name, formatLabels(series.labels), series.count)
+	}
+
+	_, err := writer.Write(output.Bytes())
+	return err
+}
+
+// Handler serves the text exposition, mount it on /metrics
+func (registry *registry) Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := registry.WritePrometheus(writer); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels []Label, more ...Label) string {
+	all := append(append([]Label{}, labels...), more...)
+	if len(all) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(all))
+	for i, label := range all {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, label.Key, labelValueEscaper.Replace(label.Value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
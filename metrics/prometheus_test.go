@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	fmt.Println("name: Success when writing the counters and histograms in the text exposition format")
+
+	registry := NewRegistry()
+	analyst := registry.With(L(DataSource, "analyst"))
+	analyst.Count(MessagesReceived, 2)
+	analyst.Count(MessagesReceived, 1)
+	registry.Count(MessagesFailed, 1, L(Operation, "delete"))
+	analyst.Observe(S3ReadDuration, 0.2)
+	analyst.Observe(S3ReadDuration, 4)
+
+	output := &bytes.Buffer{}
+	err := registry.WritePrometheus(output) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, `# TYPE etl_messages_failed_total counter
+etl_messages_failed_total{operation="delete"} 1
+# TYPE etl_messages_received_total counter
+etl_messages_received_total{dataSource="analyst"} 3
+# TYPE etl_s3_read_duration_seconds histogram
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="0.005"} 0
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="0.01"} 0
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="0.025"} 0
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="0.05"} 0
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="0.1"} 0
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="0.25"} 1
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="0.5"} 1
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="1"} 1
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="2.5"} 1
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="5"} 2
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="10"} 2
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="30"} 2
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="60"} 2
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="300"} 2
+etl_s3_read_duration_seconds_bucket{dataSource="analyst",le="+Inf"} 2
+etl_s3_read_duration_seconds_sum{dataSource="analyst"} 4.2
+etl_s3_read_duration_seconds_count{dataSource="analyst"} 2
+`, output.String())
+}
+
+func TestRegistryHandler(t *testing.T) {
+	fmt.Println("name: Success when the handler serves the text exposition")
+
+	registry := NewRegistry()
+	registry.Count(TaskSuccesses, 1, L(DataSource, `an"alyst`))
+	recorder := httptest.NewRecorder()
+
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil)) //<--- function under test
+
+	body, _ := ioutil.ReadAll(recorder.Body)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE etl_task_successes_total counter\netl_task_successes_total{dataSource=\"an\\\"alyst\"} 1\n", string(body))
+}
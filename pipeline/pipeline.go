@@ -0,0 +1,147 @@
+// Package pipeline runs records through typed stages connected by channels, Source[T] → Stage[T, U]... → Sink[U].
+// A full channel blocks the stage writing to it, so a slow stage or sink slows down the ones before it instead of
+// buffering the whole input, and the first error stops every stage
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// bufferSize is the capacity of the channels between the stages
+const bufferSize = 64
+
+// Source writes its records on out, the pipeline closes out once it returns
+type Source[T any] func(ctx context.Context, out chan<- T) error
+
+// Stage reads the records of in until it is closed and writes its records on out, the pipeline closes out once it
+// returns
+type Stage[T, U any] func(ctx context.Context, in <-chan T, out chan<- U) error
+
+// Sink reads the records of in until it is closed
+type Sink[T any] func(ctx context.Context, in <-chan T) error
+
+// Run pumps the records of source into sink, it returns the first error of a stage or of ctx
+func Run[T any](ctx context.Context, source Source[T], sink Sink[T]) error {
+	g := newGroup(ctx)
+	records := make(chan T, bufferSize)
+	g.run(func(ctx context.Context) error {
+		defer close(records)
+		return source(ctx, records)
+	})
+	g.run(func(ctx context.Context) error {
+		return sink(ctx, records)
+	})
+	return g.wait()
+}
+
+// Through is the source of the records of source transformed by stage
+func Through[T, U any](source Source[T], stage Stage[T, U]) Source[U] {
+	return func(ctx context.Context, out chan<- U) error {
+		g := newGroup(ctx)
+		records := make(chan T, bufferSize)
+		g.run(func(ctx context.Context) error {
+			defer close(records)
+			return source(ctx, records)
+		})
+		g.run(func(ctx context.Context) error {
+			return stage(ctx, records, out)
+		})
+		return g.wait()
+	}
+}
+
+// Then is the stage running the records through first and then second
+func Then[T, U, V any](first Stage[T, U], second Stage[U, V]) Stage[T, V] {
+	return func(ctx context.Context, in <-chan T, out chan<- V) error {
+		g := newGroup(ctx)
+		records := make(chan U, bufferSize)
+		g.run(func(ctx context.Context) error {
+			defer close(records)
+			return first(ctx, in, records)
+		})
+		g.run(func(ctx context.Context) error {
+			return second(ctx, records, out)
+		})
+		return g.wait()
+	}
+}
+
+// FromSlice is the source of records
+func FromSlice[T any](records []T) Source[T] {
+	return func(ctx context.Context, out chan<- T) error {
+		for _, record := range records {
+			if err := send(ctx, out, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Collect appends the records to records
+func Collect[T any](records *[]T) Sink[T] {
+	return func(ctx context.Context, in <-chan T) error {
+		for {
+			record, ok, err := receive(ctx, in)
+			if !ok {
+				return err
+			}
+			*records = append(*records, record)
+		}
+	}
+}
+
+// send blocks until out takes the record or ctx is done
+func send[T any](ctx context.Context, out chan<- T, record T) error {
+	select {
+	case out <- record:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// receive blocks until in has a record, ok is false once in is closed or ctx is done, with the error of ctx
+func receive[T any](ctx context.Context, in <-chan T) (record T, ok bool, err error) {
+	select {
+	case record, ok = <-in:
+		return record, ok, nil
+	case <-ctx.Done():
+		return record, false, ctx.Err()
+	}
+}
+
+// group runs the goroutines of a pipeline, the first error cancels the context of the others
+type group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+func newGroup(ctx context.Context) *group {
+	ctx, cancel := context.WithCancel(ctx)
+	return &group{ctx: ctx, cancel: cancel}
+}
+
+func (g *group) run(fn func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := fn(g.ctx); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+// wait returns the first error once every goroutine returned
+func (g *group) wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
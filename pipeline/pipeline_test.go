@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	double := Map(func(record int) (int, error) { return record * 2, nil })
+	even := Filter(func(record int) bool { return record%2 == 0 })
+	repeat := FlatMap(func(record int) ([]int, error) { return []int{record, record}, nil })
+	failing := Map(func(record int) (int, error) {
+		if record == 3 {
+			return 0, errors.New("some record error")
+		}
+		return record, nil
+	})
+
+	tests := []struct {
+		name            string
+		stage           Stage[int, int]
+		expectedRecords []int
+		expectedError   error
+	}{
+		{
+			name:            "Success when mapping every record",
+			stage:           double,
+			expectedRecords: []int{2, 4, 6, 8, 10},
+		},
+		{
+			name:            "Success when filtering the records",
+			stage:           even,
+			expectedRecords: []int{2, 4},
+		},
+		{
+			name:            "Success when chaining the stages",
+			stage:           Then(even, Then(repeat, double)),
+			expectedRecords: []int{4, 4, 8, 8},
+		},
+		{
+			name: "Success when the workers of a stage keep the order of the records",
+			stage: Map(func(record int) (int, error) {
+				time.Sleep(time.Duration(5-record) * time.Millisecond)
+				return record * 10, nil
+			}, Workers(4)),
+			expectedRecords: []int{10, 20, 30, 40, 50},
+		},
+		{
+			name:          "Fail when a record of a chained stage fails",
+			stage:         Then(failing, double),
+			expectedError: errors.New("some record error"),
+		},
+		{
+			name: "Fail when a record of a stage with workers fails",
+			stage: Then(double, Map(func(record int) (int, error) {
+				if record == 6 {
+					return 0, errors.New("some record error")
+				}
+				return record, nil
+			}, Workers(2))),
+			expectedError: errors.New("some record error"),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		var records []int
+		err := Run(context.Background(), Through(FromSlice([]int{1, 2, 3, 4, 5}), test.stage), Collect(&records)) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		if test.expectedError == nil {
+			assert.Equal(t, test.expectedRecords, records)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	fmt.Println("name: Success when batching the records, the last batch holds what is left")
+
+	var batches [][]string
+	source := Through(FromSlice([]int{1, 2, 3, 4, 5}), Map(func(record int) (string, error) { return strconv.Itoa(record), nil }))
+
+	err := Run(context.Background(), Through(source, Batch[string](2)), Collect(&batches)) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"1", "2"}, {"3", "4"}, {"5"}}, batches)
+}
+
+func TestFanOut(t *testing.T) {
+	fmt.Println("name: Success when every branch gets every record")
+
+	var records []string
+	stage := FanOut(
+		Map(func(record int) (string, error) { return fmt.Sprintf("a%d", record), nil }),
+		Map(func(record int) (string, error) { return fmt.Sprintf("b%d", record), nil }),
+	)
+
+	err := Run(context.Background(), Through(FromSlice([]int{1, 2}), stage), Collect(&records)) //<--- function under test
+
+	assert.Nil(t, err)
+	sort.Strings(records)
+	assert.Equal(t, []string{"a1", "a2", "b1", "b2"}, records)
+}
+
+func TestBackpressure(t *testing.T) {
+	fmt.Println("name: Success when a blocked sink stops the source once the channels are full")
+
+	var produced int64
+	source := Source[int](func(ctx context.Context, out chan<- int) error {
+		for i := 0; ; i++ {
+			if err := send(ctx, out, i); err != nil {
+				return err
+			}
+			atomic.AddInt64(&produced, 1)
+		}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := Sink[int](func(ctx context.Context, in <-chan int) error {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := Run(ctx, Through(source, Map(func(record int) (int, error) { return record, nil })), sink) //<--- function under test
+
+	assert.Equal(t, context.Canceled, err)
+	assert.LessOrEqual(t, atomic.LoadInt64(&produced), int64(3*bufferSize))
+}
@@ -0,0 +1,208 @@
+package pipeline
+
+import (
+	"context"
+)
+
+// Option configures a stage
+type Option func(*options)
+
+type options struct {
+	workers int
+}
+
+// Workers applies the function of the stage to up to n records at once, the records keep their order
+func Workers(n int) Option {
+	return func(options *options) {
+		options.workers = n
+	}
+}
+
+func newOptions(opts []Option) options {
+	options := options{workers: 1}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// Map emits the record returned by fn for every record
+func Map[T, U any](fn func(record T) (U, error), opts ...Option) Stage[T, U] {
+	return process(func(record T) ([]U, error) {
+		mapped, err := fn(record)
+		if err != nil {
+			return nil, err
+		}
+		return []U{mapped}, nil
+	}, opts)
+}
+
+// Filter emits the records for which keep is true
+func Filter[T any](keep func(record T) bool, opts ...Option) Stage[T, T] {
+	return process(func(record T) ([]T, error) {
+		if !keep(record) {
+			return nil, nil
+		}
+		return []T{record}, nil
+	}, opts)
+}
+
+// FlatMap emits every record returned by fn for every record
+func FlatMap[T, U any](fn func(record T) ([]U, error), opts ...Option) Stage[T, U] {
+	return process(fn, opts)
+}
+
+// Batch emits the records by slices of size, the last one holds what is left
+func Batch[T any](size int) Stage[T, []T] {
+	return func(ctx context.Context, in <-chan T, out chan<- []T) error {
+		batch := make([]T, 0, size)
+		for {
+			record, ok, err := receive(ctx, in)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			batch = append(batch, record)
+			if len(batch) >= size {
+				if err := send(ctx, out, batch); err != nil {
+					return err
+				}
+				batch = make([]T, 0, size)
+			}
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		return send(ctx, out, batch)
+	}
+}
+
+// FanOut sends every record to each of the branches and merges what they emit. The branches share the records and
+// their outputs are interleaved, the slowest branch paces the others
+func FanOut[T, U any](branches ...Stage[T, U]) Stage[T, U] {
+	return func(ctx context.Context, in <-chan T, out chan<- U) error {
+		g := newGroup(ctx)
+		inputs := make([]chan T, len(branches))
+		for i, branch := range branches {
+			inputs[i] = make(chan T, bufferSize)
+			branch, input := branch, inputs[i]
+			g.run(func(ctx context.Context) error {
+				return branch(ctx, input, out)
+			})
+		}
+		g.run(func(ctx context.Context) error {
+			defer func() {
+				for _, input := range inputs {
+					close(input)
+				}
+			}()
+			for {
+				record, ok, err := receive(ctx, in)
+				if !ok {
+					return err
+				}
+				for _, input := range inputs {
+					if err := send(ctx, input, record); err != nil {
+						return err
+					}
+				}
+			}
+		})
+		return g.wait()
+	}
+}
+
+// process emits the records returned by fn for every record, with the workers of the options
+func process[T, U any](fn func(record T) ([]U, error), opts []Option) Stage[T, U] {
+	options := newOptions(opts)
+	if options.workers <= 1 {
+		return func(ctx context.Context, in <-chan T, out chan<- U) error {
+			for {
+				record, ok, err := receive(ctx, in)
+				if !ok {
+					return err
+				}
+				results, err := fn(record)
+				if err != nil {
+					return err
+				}
+				for _, result := range results {
+					if err := send(ctx, out, result); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return ordered(fn, options.workers)
+}
+
+type result[U any] struct {
+	records []U
+	err     error
+}
+
+type job[T, U any] struct {
+	record T
+	result chan result[U]
+}
+
+// ordered hands the records to workers and emits their results in the order of the records. The results waiting
+// for an earlier one are bounded by the number of workers
+func ordered[T, U any](fn func(record T) ([]U, error), workers int) Stage[T, U] {
+	return func(ctx context.Context, in <-chan T, out chan<- U) error {
+		g := newGroup(ctx)
+		jobs := make(chan job[T, U])
+		pending := make(chan chan result[U], workers)
+
+		g.run(func(ctx context.Context) error {
+			defer close(jobs)
+			defer close(pending)
+			for {
+				record, ok, err := receive(ctx, in)
+				if !ok {
+					return err
+				}
+				job := job[T, U]{record: record, result: make(chan result[U], 1)}
+				if err := send(ctx, pending, job.result); err != nil {
+					return err
+				}
+				if err := send(ctx, jobs, job); err != nil {
+					return err
+				}
+			}
+		})
+		for i := 0; i < workers; i++ {
+			g.run(func(ctx context.Context) error {
+				for job := range jobs {
+					records, err := fn(job.record)
+					job.result <- result[U]{records: records, err: err}
+				}
+				return nil
+			})
+		}
+		g.run(func(ctx context.Context) error {
+			for {
+				next, ok, err := receive(ctx, pending)
+				if !ok {
+					return err
+				}
+				result, _, err := receive(ctx, next)
+				if err != nil {
+					return err
+				}
+				if result.err != nil {
+					return result.err
+				}
+				for _, record := range result.records {
+					if err := send(ctx, out, record); err != nil {
+						return err
+					}
+				}
+			}
+		})
+		return g.wait()
+	}
+}
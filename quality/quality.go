@@ -0,0 +1,264 @@
+package quality
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/mapping"
+	"regexp"
+	"strconv"
+)
+
+// Failure is a rule failed by a record
+type Failure struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Reject is a record failing at least one rule, Index is its position in the input file
+type Reject struct {
+	Index    int
+	Failures []Failure
+}
+
+// RuleResult counts the records failing a rule
+type RuleResult struct {
+	Rule   string `json:"rule"`
+	Failed int    `json:"failed"`
+}
+
+// Result lists the rejected records in the order of the file and the results of the rules in the order of the spec
+type Result struct {
+	Rejects []Reject
+	Rules   []RuleResult
+}
+
+type compiledRule struct {
+	Rule
+	field     mapping.Path
+	pattern   *regexp.Regexp
+	values    map[string]bool
+	reference mapping.Path
+}
+
+type checker struct {
+	rules []compiledRule
+}
+
+// Compile checks the rules of the spec, the errors name the rule
+func Compile(spec Spec) (*checker, error) {
+	c := &checker{}
+	names := map[string]bool{}
+	for i, rule := range spec.Rules {
+		if rule.Name == "" {
+			rule.Name = rule.Check + " " + rule.Field
+		}
+		compiled, err := compileRule(rule)
+		if err == nil && names[rule.Name] {
+			err = errors.New("the name is used by another rule")
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid quality rule #%d %s, error: %s", i+1, rule.Name, err.Error()))
+		}
+		names[rule.Name] = true
+		c.rules = append(c.rules, compiled)
+	}
+
+	thresholds := spec.Thresholds
+	if thresholds.MaxRejectedRatio != nil && (*thresholds.MaxRejectedRatio < 0 || *thresholds.MaxRejectedRatio > 1) {
+		return nil, errors.New("invalid quality thresholds, error: the max rejected ratio must be between 0 and 1")
+	}
+	if thresholds.MaxRejected != nil && *thresholds.MaxRejected < 0 {
+		return nil, errors.New("invalid quality thresholds, error: the max rejected must not be negative")
+	}
+	return c, nil
+}
+
+func compileRule(rule Rule) (compiledRule, error) {
+	compiled := compiledRule{Rule: rule}
+	field, err := mapping.ParsePath(rule.Field)
+	if err != nil {
+		return compiled, err
+	}
+	compiled.field = field
+
+	switch rule.Check {
+	case NotNull, Unique:
+	case Range:
+		if rule.Min == nil && rule.Max == nil {
+			return compiled, errors.New("a range needs a min or a max")
+		}
+	case Regex:
+		if compiled.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+			return compiled, err
+		}
+	case Enum:
+		if len(rule.Values) == 0 {
+			return compiled, errors.New("an enum needs values")
+		}
+		compiled.values = map[string]bool{}
+		for _, value := range rule.Values {
+			compiled.values[compareKey(value)] = true
+		}
+	case Reference:
+		if compiled.reference, err = mapping.ParsePath(rule.Reference); err != nil {
+			return compiled, err
+		}
+	default:
+		return compiled, errors.New(fmt.Sprintf("unknown check %q, expected one of %s, %s, %s, %s, %s, %s", rule.Check, NotNull, Range, Regex, Enum, Unique, Reference))
+	}
+	return compiled, nil
+}
+
+// Check runs the rules on the records of a file, decoded from json
+func (c *checker) Check(records []interface{}) Result {
+	failures := make([][]Failure, len(records))
+	result := Result{Rules: make([]RuleResult, 0, len(c.rules))}
+
+	for _, rule := range c.rules {
+		ruleResult := RuleResult{Rule: rule.Name}
+		check := rule.checkFunc(records)
+		for i, record := range records {
+			if message, ok := check(rule.field.Get(record)); !ok {
+				failures[i] = append(failures[i], Failure{Rule: rule.Name, Message: message})
+				ruleResult.Failed++
+			}
+		}
+		result.Rules = append(result.Rules, ruleResult)
+	}
+
+	for i, recordFailures := range failures {
+		if len(recordFailures) > 0 {
+			result.Rejects = append(result.Rejects, Reject{Index: i, Failures: recordFailures})
+		}
+	}
+	return result
+}
+
+// checkFunc returns the check of a value, with the records of the file for the checks that need them. The checks
+// return the message of the failure and false when the value fails
+func (rule compiledRule) checkFunc(records []interface{}) func(value interface{}) (string, bool) {
+	switch rule.Check {
+	case NotNull:
+		return func(value interface{}) (string, bool) {
+			return "the value is null", value != nil
+		}
+	case Range:
+		return func(value interface{}) (string, bool) {
+			if value == nil {
+				return "", true
+			}
+			number, ok := toFloat(value)
+			if !ok {
+				return fmt.Sprintf("%s is not a number", key(value)), false
+			}
+			if (rule.Min != nil && number < *rule.Min) || (rule.Max != nil && number > *rule.Max) {
+				return fmt.Sprintf("%s is out of %s", key(value), rule.bounds()), false
+			}
+			return "", true
+		}
+	case Regex:
+		return func(value interface{}) (string, bool) {
+			if value == nil || rule.pattern.MatchString(key(value)) {
+				return "", true
+			}
+			return fmt.Sprintf("%s does not match %s", key(value), rule.Pattern), false
+		}
+	case Enum:
+		return func(value interface{}) (string, bool) {
+			if value == nil || rule.values[compareKey(value)] {
+				return "", true
+			}
+			return fmt.Sprintf("%s is not an allowed value", key(value)), false
+		}
+	case Unique:
+		seen := map[string]bool{}
+		return func(value interface{}) (string, bool) {
+			if value == nil {
+				return "", true
+			}
+			k := compareKey(value)
+			if seen[k] {
+				return fmt.Sprintf("%s is a duplicate", key(value)), false
+			}
+			seen[k] = true
+			return "", true
+		}
+	}
+
+	references := map[string]bool{}
+	for _, record := range records {
+		if reference := rule.reference.Get(record); reference != nil {
+			references[compareKey(reference)] = true
+		}
+	}
+	return func(value interface{}) (string, bool) {
+		if value == nil || references[compareKey(value)] {
+			return "", true
+		}
+		return fmt.Sprintf("%s does not match the %s of any record", key(value), rule.Reference), false
+	}
+}
+
+// toFloat is the number of a value decoded from json, with or without UseNumber
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (rule compiledRule) bounds() string {
+	lower, upper := "-inf", "+inf"
+	if rule.Min != nil {
+		lower = strconv.FormatFloat(*rule.Min, 'f', -1, 64)
+	}
+	if rule.Max != nil {
+		upper = strconv.FormatFloat(*rule.Max, 'f', -1, 64)
+	}
+	return fmt.Sprintf("[%s, %s]", lower, upper)
+}
+
+// key is the value as it is reported, strings as they are and the other values as json, so the 1 of a yaml spec is
+// the 1.0 of a json record
+func key(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case json.Number:
+		// The records decoded with UseNumber keep the ids above 2^53, the other numbers are written like a float64
+		if i, err := v.Int64(); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+		if f, err := v.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return v.String()
+	}
+	content, _ := json.Marshal(value)
+	return string(content)
+}
+
+// compareKey is the value as it is compared, its key prefixed with its kind, so the string "1" does not match the
+// number 1 while the 1 of a yaml spec still matches the 1.0 of a json record
+func compareKey(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string:" + key(value)
+	case float64, int, int64, uint64, json.Number:
+		return "number:" + key(value)
+	}
+	return "json:" + key(value)
+}
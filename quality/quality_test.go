@@ -0,0 +1,261 @@
+package quality
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const treeElemSpec = `
+rules:
+  - field: $.treeElemId
+    check: notNull
+  - field: $.treeElemId
+    check: unique
+  - name: branch level
+    field: $.branchLevel
+    check: range
+    min: 0
+    max: 10
+  - field: $.name
+    check: regex
+    pattern: ^[A-Z]
+  - field: $.containerType
+    check: enum
+    values: [1, 2]
+  - field: $.parentId
+    check: reference
+    reference: $.treeElemId
+thresholds:
+  maxRejectedRatio: 0.01
+`
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func TestParse(t *testing.T) {
+	fmt.Println("name: Success when parsing the rules and the thresholds of a spec")
+
+	spec, err := Parse([]byte(treeElemSpec)) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(spec.Rules))
+	assert.Equal(t, Rule{Name: "branch level", Field: "$.branchLevel", Check: Range, Min: float(0), Max: float(10)}, spec.Rules[2])
+	assert.Equal(t, []interface{}{1, 2}, spec.Rules[4].Values)
+	assert.Equal(t, float(0.01), spec.Thresholds.MaxRejectedRatio)
+
+	fmt.Println("name: Fail when the spec has an unknown key")
+
+	_, err = Parse([]byte("rules:\n  - field: $.id\n    checks: notNull\n")) //<--- function under test
+
+	assert.Equal(t, errors.New("failed to parse the quality spec, error: yaml: unmarshal errors:\n  line 3: field checks not found in type quality.Rule"), err)
+}
+
+func TestCompile(t *testing.T) {
+	maxRejected := -1
+	tests := []struct {
+		name          string
+		spec          Spec
+		expectedError error
+	}{
+		{
+			name:          "Fail when the check is unknown",
+			spec:          Spec{Rules: []Rule{{Field: "$.id", Check: "positive"}}},
+			expectedError: errors.New(`invalid quality rule #1 positive $.id, error: unknown check "positive", expected one of notNull, range, regex, enum, unique, reference`),
+		},
+		{
+			name:          "Fail when the field is not a json path",
+			spec:          Spec{Rules: []Rule{{Field: "id", Check: NotNull}}},
+			expectedError: errors.New(`invalid quality rule #1 notNull id, error: the path "id" does not start with $`),
+		},
+		{
+			name:          "Fail when a range has no bounds",
+			spec:          Spec{Rules: []Rule{{Field: "$.id", Check: Range}}},
+			expectedError: errors.New("invalid quality rule #1 range $.id, error: a range needs a min or a max"),
+		},
+		{
+			name:          "Fail when the pattern is not a regular expression",
+			spec:          Spec{Rules: []Rule{{Field: "$.id", Check: Regex, Pattern: "("}}},
+			expectedError: errors.New("invalid quality rule #1 regex $.id, error: error parsing regexp: missing closing ): `(`"),
+		},
+		{
+			name:          "Fail when two rules have the same name",
+			spec:          Spec{Rules: []Rule{{Field: "$.id", Check: NotNull}, {Field: "$.id", Check: NotNull}}},
+			expectedError: errors.New("invalid quality rule #2 notNull $.id, error: the name is used by another rule"),
+		},
+		{
+			name:          "Fail when the thresholds are out of bounds",
+			spec:          Spec{Thresholds: Thresholds{MaxRejectedRatio: float(2)}},
+			expectedError: errors.New("invalid quality thresholds, error: the max rejected ratio must be between 0 and 1"),
+		},
+		{
+			name:          "Fail when the max rejected is negative",
+			spec:          Spec{Thresholds: Thresholds{MaxRejected: &maxRejected}},
+			expectedError: errors.New("invalid quality thresholds, error: the max rejected must not be negative"),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		_, err := Compile(test.spec) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	fmt.Println("name: Success when every record failing a rule is rejected with the failures of all its rules")
+
+	spec, err := Parse([]byte(treeElemSpec))
+	assert.Nil(t, err)
+	checker, err := Compile(spec)
+	assert.Nil(t, err)
+	var records []interface{}
+	assert.Nil(t, json.Unmarshal([]byte(`[
+		{"treeElemId": 1, "branchLevel": 0, "name": "Root", "containerType": 1},
+		{"treeElemId": 2, "branchLevel": 1, "name": "Child", "containerType": 2, "parentId": 1},
+		{"treeElemId": 2, "branchLevel": 11, "name": "child", "containerType": 3, "parentId": 9},
+		{"branchLevel": "1"}
+	]`), &records))
+
+	result := checker.Check(records) //<--- function under test
+
+	assert.Equal(t, []Reject{
+		{Index: 2, Failures: []Failure{
+			{Rule: "unique $.treeElemId", Message: "2 is a duplicate"},
+			{Rule: "branch level", Message: "11 is out of [0, 10]"},
+			{Rule: "regex $.name", Message: "child does not match ^[A-Z]"},
+			{Rule: "enum $.containerType", Message: "3 is not an allowed value"},
+			{Rule: "reference $.parentId", Message: "9 does not match the $.treeElemId of any record"},
+		}},
+		{Index: 3, Failures: []Failure{
+			{Rule: "notNull $.treeElemId", Message: "the value is null"},
+			{Rule: "branch level", Message: "1 is not a number"},
+		}},
+	}, result.Rejects)
+	assert.Equal(t, []RuleResult{
+		{Rule: "notNull $.treeElemId", Failed: 1},
+		{Rule: "unique $.treeElemId", Failed: 1},
+		{Rule: "branch level", Failed: 2},
+		{Rule: "regex $.name", Failed: 1},
+		{Rule: "enum $.containerType", Failed: 1},
+		{Rule: "reference $.parentId", Failed: 1},
+	}, result.Rules)
+}
+
+func TestCheckComparesTheTypes(t *testing.T) {
+	fmt.Println("name: Success when a string does not match the number of the same key")
+
+	spec, err := Parse([]byte(`
+rules:
+  - field: $.id
+    check: unique
+  - field: $.type
+    check: enum
+    values: ["1", 2]
+  - field: $.parentId
+    check: reference
+    reference: $.id
+`))
+	assert.Nil(t, err)
+	checker, err := Compile(spec)
+	assert.Nil(t, err)
+	var records []interface{}
+	assert.Nil(t, json.Unmarshal([]byte(`[
+		{"id": 1, "type": "1"},
+		{"id": "1", "type": 2.0, "parentId": 1},
+		{"id": 2, "type": 1, "parentId": "2"}
+	]`), &records))
+
+	result := checker.Check(records) //<--- function under test
+
+	assert.Equal(t, []Reject{
+		{Index: 2, Failures: []Failure{
+			{Rule: "enum $.type", Message: "1 is not an allowed value"},
+			{Rule: "reference $.parentId", Message: "2 does not match the $.id of any record"},
+		}},
+	}, result.Rejects)
+}
+
+func TestCheckLargeIds(t *testing.T) {
+	fmt.Println("name: Success when the ids above 2^53 decoded with UseNumber keep their value")
+
+	spec, err := Parse([]byte(`
+rules:
+  - field: $.id
+    check: unique
+  - field: $.parentId
+    check: reference
+    reference: $.id
+  - field: $.level
+    check: range
+    min: 0
+    max: 10
+`))
+	assert.Nil(t, err)
+	checker, err := Compile(spec)
+	assert.Nil(t, err)
+	decoder := json.NewDecoder(strings.NewReader(`[
+		{"id": 9007199254740992, "level": 0},
+		{"id": 9007199254740993, "parentId": 9007199254740992, "level": 1.5},
+		{"id": 9007199254740994, "parentId": 9007199254740995, "level": 11}
+	]`))
+	decoder.UseNumber()
+	var records []interface{}
+	assert.Nil(t, decoder.Decode(&records))
+
+	result := checker.Check(records) //<--- function under test
+
+	assert.Equal(t, []Reject{
+		{Index: 2, Failures: []Failure{
+			{Rule: "reference $.parentId", Message: "9007199254740995 does not match the $.id of any record"},
+			{Rule: "range $.level", Message: "11 is out of [0, 10]"},
+		}},
+	}, result.Rejects)
+}
+
+func TestThresholds(t *testing.T) {
+	maxRejected := 2
+	tests := []struct {
+		name          string
+		thresholds    Thresholds
+		rejected      int
+		expectedError error
+	}{
+		{
+			name:       "Success when no threshold is set",
+			thresholds: Thresholds{},
+			rejected:   100,
+		},
+		{
+			name:       "Success when the rejected records are at the ratio",
+			thresholds: Thresholds{MaxRejectedRatio: float(0.01)},
+			rejected:   2,
+		},
+		{
+			name:          "Fail when the rejected records are over the ratio",
+			thresholds:    Thresholds{MaxRejectedRatio: float(0.01)},
+			rejected:      3,
+			expectedError: errors.New("3 of 200 records were rejected, more than the 1% allowed"),
+		},
+		{
+			name:          "Fail when the rejected records are over the count",
+			thresholds:    Thresholds{MaxRejected: &maxRejected},
+			rejected:      3,
+			expectedError: errors.New("3 of 200 records were rejected, more than the 2 allowed"),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		err := test.thresholds.Check(200, test.rejected) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+	}
+}
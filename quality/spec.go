@@ -0,0 +1,88 @@
+// Package quality checks the records of an input file against declarative rules, the records failing a rule are
+// rejected with the reason, and fails the event when its rejected records go over the thresholds
+package quality
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+)
+
+// Checks of the rules
+const (
+	// NotNull fails the records where the field is null or missing
+	NotNull = "notNull"
+	// Range fails the numbers lower than Min or greater than Max, and the values that are not numbers
+	Range = "range"
+	// Regex fails the values not matching Pattern, the numbers and booleans are matched as json
+	Regex = "regex"
+	// Enum fails the values that are not one of Values
+	Enum = "enum"
+	// Unique fails the records repeating the value of an earlier record of the file
+	Unique = "unique"
+	// Reference fails the values that are not the value at the path Reference of a record of the file, like a
+	// parent id that is not the id of any record
+	Reference = "reference"
+)
+
+// Spec lists the rules of every record of an input file and the thresholds of the event
+type Spec struct {
+	Rules      []Rule     `yaml:"rules"`
+	Thresholds Thresholds `yaml:"thresholds"`
+}
+
+// Rule checks the value of a field, the checks other than notNull let the null values pass
+type Rule struct {
+	// Name is the reason of the rejects, "<check> <field>" by default
+	Name string `yaml:"name"`
+	// Field is a json path in the record, like $.parentId
+	Field     string        `yaml:"field"`
+	Check     string        `yaml:"check"`
+	Min       *float64      `yaml:"min"`
+	Max       *float64      `yaml:"max"`
+	Pattern   string        `yaml:"pattern"`
+	Values    []interface{} `yaml:"values"`
+	Reference string        `yaml:"reference"`
+}
+
+// Thresholds fail the event when its input files have more rejected records, the thresholds left to nil are not
+// checked
+type Thresholds struct {
+	// MaxRejectedRatio is a fraction of the records, 0.01 fails the event when more than 1% are rejected
+	MaxRejectedRatio *float64 `yaml:"maxRejectedRatio"`
+	MaxRejected      *int     `yaml:"maxRejected"`
+}
+
+// Check returns an error when rejected out of records is over a threshold
+func (thresholds Thresholds) Check(records, rejected int) error {
+	if thresholds.MaxRejected != nil && rejected > *thresholds.MaxRejected {
+		return errors.New(fmt.Sprintf("%d of %d records were rejected, more than the %d allowed", rejected, records, *thresholds.MaxRejected))
+	}
+	if thresholds.MaxRejectedRatio != nil && records > 0 && float64(rejected)/float64(records) > *thresholds.MaxRejectedRatio {
+		return errors.New(fmt.Sprintf("%d of %d records were rejected, more than the %g%% allowed", rejected, records, *thresholds.MaxRejectedRatio*100))
+	}
+	return nil
+}
+
+// Parse reads a spec in yaml or json, the unknown keys are errors
+func Parse(content []byte) (Spec, error) {
+	var spec Spec
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil && err != io.EOF {
+		return Spec{}, errors.New(fmt.Sprintf("failed to parse the quality spec, error: %s", err.Error()))
+	}
+	return spec, nil
+}
+
+// Load reads the spec of a file
+func Load(path string) (Spec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Spec{}, err
+	}
+	return Parse(content)
+}
@@ -0,0 +1,174 @@
+// Package retry calls the aws operations again after a retryable error, with an exponential backoff and jitter, until
+// the call succeeds, the error is permanent or the policy of the operation gives up
+package retry
+
+import (
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/metrics"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Policy is the backoff of an operation, its zero fields take the ones of DefaultPolicy
+type Policy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// Multiplier grows the interval after every attempt
+	Multiplier float64
+	// Jitter randomizes every interval by up to this fraction of it, 0.5 waits between 50% and 150% of the interval
+	Jitter float64
+	// MaxElapsedTime stops the retries when the next attempt would start later than this after the first one
+	MaxElapsedTime time.Duration
+	// MaxAttempts bounds the calls, the first one included. 0 is only bounded by MaxElapsedTime
+	MaxAttempts int
+}
+
+// DefaultPolicy waits 100ms, then twice longer after every attempt up to 10s, for at most a minute
+func DefaultPolicy() Policy {
+	return Policy{
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.5,
+		MaxElapsedTime:  time.Minute,
+	}
+}
+
+func (policy Policy) withDefaults() Policy {
+	defaults := DefaultPolicy()
+	if policy.InitialInterval == 0 {
+		policy.InitialInterval = defaults.InitialInterval
+	}
+	if policy.MaxInterval == 0 {
+		policy.MaxInterval = defaults.MaxInterval
+	}
+	if policy.Multiplier == 0 {
+		policy.Multiplier = defaults.Multiplier
+	}
+	if policy.Jitter == 0 {
+		policy.Jitter = defaults.Jitter
+	}
+	if policy.MaxElapsedTime == 0 {
+		policy.MaxElapsedTime = defaults.MaxElapsedTime
+	}
+	return policy
+}
+
+// Retrier calls an operation until it succeeds or its policy gives up, the operations are named after the aws api,
+// like GetObject or SendTaskSuccess
+type Retrier interface {
+	Do(operation string, call func() error) error
+}
+
+type retrier struct {
+	policy     Policy
+	operations map[string]Policy
+	retryable  func(err error) bool
+	metrics    metrics.Metrics
+	now        func() time.Time
+	sleep      func(time.Duration)
+	random     func() float64
+	mutex      sync.RWMutex
+}
+
+// New retries every operation with policy and the errors classified as retryable by etlerrors
+func New(policy Policy) *retrier {
+	return &retrier{
+		policy:     policy.withDefaults(),
+		operations: map[string]Policy{},
+		retryable:  etlerrors.Retryable,
+		metrics:    metrics.Default(),
+		now:        time.Now,
+		sleep:      time.Sleep,
+		random:     rand.Float64,
+	}
+}
+
+// SetPolicy overrides the policy of one operation
+func (r *retrier) SetPolicy(operation string, policy Policy) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.operations[operation] = policy.withDefaults()
+}
+
+// SetMetrics counts the retries of every operation on m
+func (r *retrier) SetMetrics(m metrics.Metrics) {
+	r.metrics = m
+}
+
+// Do returns the error of the last call, it keeps the kind of the failure
+func (r *retrier) Do(operation string, call func() error) error {
+	policy := r.policyOf(operation)
+	startedAt := r.now()
+	interval := policy.InitialInterval
+
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || !r.retryable(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		wait := r.jitter(interval, policy.Jitter)
+		if r.now().Add(wait).Sub(startedAt) > policy.MaxElapsedTime {
+			return err
+		}
+		r.metrics.Count(metrics.Retries, 1, metrics.L(metrics.Operation, operation))
+		r.sleep(wait)
+
+		interval = time.Duration(float64(interval) * policy.Multiplier)
+		if interval > policy.MaxInterval {
+			interval = policy.MaxInterval
+		}
+	}
+}
+
+func (r *retrier) policyOf(operation string) Policy {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if policy, ok := r.operations[operation]; ok {
+		return policy
+	}
+	return r.policy
+}
+
+func (r *retrier) jitter(interval time.Duration, jitter float64) time.Duration {
+	delta := jitter * float64(interval)
+	return time.Duration(float64(interval) - delta + 2*delta*r.random())
+}
+
+type nopRetrier struct{}
+
+// Nop calls every operation once
+func Nop() Retrier {
+	return nopRetrier{}
+}
+
+func (nopRetrier) Do(operation string, call func() error) error {
+	return call()
+}
+
+var (
+	defaultRetrier Retrier = New(DefaultPolicy())
+	defaultMutex   sync.RWMutex
+)
+
+// Default is the retrier of the clients that were not given one, it follows DefaultPolicy
+func Default() Retrier {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+
+	return defaultRetrier
+}
+
+func SetDefault(retrier Retrier) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	defaultRetrier = retrier
+}
@@ -0,0 +1,113 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// newTestRetrier waits without sleeping and without jitter, the waits are recorded
+func newTestRetrier(policy Policy, waits *[]time.Duration) *retrier {
+	now := time.Date(2022, 2, 14, 10, 30, 0, 0, time.UTC)
+	r := New(policy)
+	r.now = func() time.Time { return now }
+	r.sleep = func(wait time.Duration) {
+		*waits = append(*waits, wait)
+		now = now.Add(wait)
+	}
+	r.random = func() float64 { return 0.5 }
+	return r
+}
+
+func TestDo(t *testing.T) {
+	throttled := etlerrors.New(etlerrors.ErrThrottled, "some throttled error", nil)
+	permanent := errors.New("some permanent error")
+
+	tests := []struct {
+		name          string
+		policy        Policy
+		errs          []error
+		expectedCalls int
+		expectedWaits []time.Duration
+		expectedError error
+	}{
+		{
+			name:          "Success when the call succeeds at once",
+			errs:          []error{nil},
+			expectedCalls: 1,
+		},
+		{
+			name:          "Success when the retryable errors back off exponentially up to the max interval",
+			policy:        Policy{InitialInterval: time.Second, MaxInterval: 3 * time.Second},
+			errs:          []error{throttled, throttled, throttled, nil},
+			expectedCalls: 4,
+			expectedWaits: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second},
+		},
+		{
+			name:          "Fail when the error is permanent",
+			errs:          []error{permanent},
+			expectedCalls: 1,
+			expectedError: permanent,
+		},
+		{
+			name:          "Fail when the max attempts are reached",
+			policy:        Policy{MaxAttempts: 2},
+			errs:          []error{throttled, throttled, nil},
+			expectedCalls: 2,
+			expectedWaits: []time.Duration{100 * time.Millisecond},
+			expectedError: throttled,
+		},
+		{
+			name:          "Fail when the next attempt would start after the max elapsed time",
+			policy:        Policy{InitialInterval: time.Second, MaxElapsedTime: 2 * time.Second},
+			errs:          []error{throttled, throttled, throttled},
+			expectedCalls: 2,
+			expectedWaits: []time.Duration{time.Second},
+			expectedError: throttled,
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		var waits []time.Duration
+		calls := 0
+
+		err := newTestRetrier(test.policy, &waits).Do("GetObject", func() error { //<--- function under test
+			calls++
+			return test.errs[calls-1]
+		})
+
+		assert.Equal(t, test.expectedError, err)
+		assert.Equal(t, test.expectedCalls, calls)
+		assert.Equal(t, test.expectedWaits, waits)
+	}
+}
+
+func TestDoWithThePolicyOfTheOperation(t *testing.T) {
+	fmt.Println("name: Success when the policy of the operation overrides the default one")
+
+	var waits []time.Duration
+	r := newTestRetrier(Policy{MaxAttempts: 5}, &waits)
+	r.SetPolicy("SendTaskSuccess", Policy{MaxAttempts: 1})
+	transient := etlerrors.New(etlerrors.ErrTransient, "some transient error", nil)
+	calls := map[string]int{}
+
+	_ = r.Do("SendTaskSuccess", func() error { calls["SendTaskSuccess"]++; return transient }) //<--- function under test
+	_ = r.Do("GetObject", func() error { calls["GetObject"]++; return transient })             //<--- function under test
+
+	assert.Equal(t, map[string]int{"SendTaskSuccess": 1, "GetObject": 5}, calls)
+}
+
+func TestJitter(t *testing.T) {
+	fmt.Println("name: Success when the jitter spreads the interval around it")
+
+	r := New(DefaultPolicy())
+
+	r.random = func() float64 { return 0 }
+	assert.Equal(t, 50*time.Millisecond, r.jitter(100*time.Millisecond, 0.5)) //<--- function under test
+	r.random = func() float64 { return 1 }
+	assert.Equal(t, 150*time.Millisecond, r.jitter(100*time.Millisecond, 0.5)) //<--- function under test
+}
@@ -0,0 +1,220 @@
+package s3aws
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxKeys = 1000
+	tmpFilePrefix  = ".tmp-"
+)
+
+// fsSvcClient implements SvcClient on the local filesystem, every bucket is a directory under root and every
+// object a file inside it. It is meant for running ETLs offline, without AWS credentials
+type fsSvcClient struct {
+	root string
+}
+
+func NewFSSvcClient(root string) *fsSvcClient {
+	return &fsSvcClient{root: root}
+}
+
+func (client fsSvcClient) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	objectPath, err := client.objectPath(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(objectPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, awserr.New(s3.ErrCodeNoSuchKey, fmt.Sprintf("the key %s does not exist", aws.StringValue(input.Key)), err)
+		}
+		return nil, err
+	}
+
+	info, err := os.Stat(objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          ioutil.NopCloser(bytes.NewReader(content)),
+		ContentLength: aws.Int64(int64(len(content))),
+		LastModified:  aws.Time(info.ModTime()),
+	}, nil
+}
+
+func (client fsSvcClient) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	objectPath, err := client.objectPath(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	if input.Body != nil {
+		if content, err = ioutil.ReadAll(input.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeFile(objectPath, content); err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (client fsSvcClient) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	bucketPath, err := client.bucketPath(aws.StringValue(input.Bucket))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := aws.StringValue(input.Prefix)
+	marker := aws.StringValue(input.Marker)
+	keys := []string{}
+	err = filepath.Walk(bucketPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filePath == bucketPath {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), tmpFilePrefix) {
+			return nil
+		}
+		relative, err := filepath.Rel(bucketPath, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	maxKeys := int(aws.Int64Value(input.MaxKeys))
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	truncated := len(keys) > maxKeys
+	if truncated {
+		keys = keys[:maxKeys]
+	}
+
+	contents := make([]*s3.Object, len(keys))
+	for i, key := range keys {
+		contents[i] = &s3.Object{Key: aws.String(key)}
+	}
+
+	return &s3.ListObjectsOutput{
+		Name:        input.Bucket,
+		Prefix:      input.Prefix,
+		Marker:      input.Marker,
+		Contents:    contents,
+		IsTruncated: aws.Bool(truncated),
+	}, nil
+}
+
+func (client fsSvcClient) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	source, err := url.PathUnescape(aws.StringValue(input.CopySource))
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	if len(parts) != 2 {
+		return nil, awserr.New("InvalidArgument", fmt.Sprintf("invalid copy source: %s", source), nil)
+	}
+
+	object, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String(parts[0]), Key: aws.String(parts[1])})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	content, err := ioutil.ReadAll(object.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	objectPath, err := client.objectPath(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(objectPath, content); err != nil {
+		return nil, err
+	}
+	return &s3.CopyObjectOutput{CopyObjectResult: &s3.CopyObjectResult{LastModified: aws.Time(time.Now())}}, nil
+}
+
+// DeleteObject behaves like s3 and does not fail when the object does not exist
+func (client fsSvcClient) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	objectPath, err := client.objectPath(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(objectPath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (client fsSvcClient) bucketPath(bucket string) (string, error) {
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || bucket == "." || bucket == ".." {
+		return "", awserr.New(s3.ErrCodeNoSuchBucket, fmt.Sprintf("invalid bucket name: %s", bucket), nil)
+	}
+	return filepath.Join(client.root, bucket), nil
+}
+
+// objectPath maps a key inside the bucket directory, keys escaping the bucket are rejected
+func (client fsSvcClient) objectPath(bucket, key string) (string, error) {
+	bucketPath, err := client.bucketPath(bucket)
+	if err != nil {
+		return "", err
+	}
+
+	objectPath := filepath.Join(bucketPath, filepath.FromSlash(key))
+	if key == "" || !strings.HasPrefix(objectPath, bucketPath+string(filepath.Separator)) {
+		return "", awserr.New("InvalidArgument", fmt.Sprintf("invalid key: %s", key), nil)
+	}
+	return objectPath, nil
+}
+
+// writeFile writes to a temporary file first, so readers never see a partially written object
+func writeFile(objectPath string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(objectPath), tmpFilePrefix+filepath.Base(objectPath))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), objectPath)
+}
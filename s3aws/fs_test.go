@@ -0,0 +1,56 @@
+package s3aws
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFSSvcClient(t *testing.T) {
+	fmt.Println("name: Success when reading and writing objects on the local filesystem")
+
+	s3Client := NewS3Client(NewFSSvcClient(t.TempDir()), defaultBucket)
+
+	outputPath, err := s3Client.Insert("staging/some/path.json", []byte(`[{"TreeElemId": 123}]`))
+	assert.Nil(t, err)
+	assert.Equal(t, "someBucket/staging/some/path.json", *outputPath)
+
+	_, err = s3Client.Copy("staging/some/path.json", "final/some/path.json")
+	assert.Nil(t, err)
+	assert.Nil(t, s3Client.Delete("staging/some/path.json"))
+
+	content, err := s3Client.Read(defaultBucket, "final/some/path.json")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`[{"TreeElemId": 123}]`), content)
+
+	fileNames, err := s3Client.ListObjects("final/")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(*fileNames))
+	assert.Equal(t, "final/some/path.json", *(*fileNames)[0])
+
+	_, err = s3Client.Read(defaultBucket, "staging/some/path.json")
+	assert.True(t, IsNotFound(err))
+}
+
+func TestFSSvcClientRejectsKeysOutsideTheBucket(t *testing.T) {
+	fmt.Println("name: Fail when a key escapes the bucket directory")
+
+	svc := NewFSSvcClient(t.TempDir())
+
+	_, err := svc.PutObject(&s3.PutObjectInput{Bucket: aws.String(defaultBucket), Key: aws.String("../other/path")})
+
+	assert.NotNil(t, err)
+}
+
+func TestFSSvcClientListMissingBucket(t *testing.T) {
+	fmt.Println("name: Success when listing a bucket that has no objects yet")
+
+	s3Client := NewS3Client(NewFSSvcClient(t.TempDir()), defaultBucket)
+
+	fileNames, err := s3Client.ListObjects("some/")
+
+	assert.Nil(t, err)
+	assert.Empty(t, *fileNames)
+}
@@ -0,0 +1,286 @@
+package s3aws
+
+import (
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"math"
+	"path"
+	"sync"
+	"time"
+)
+
+// Limit caps the requests of one kind to one prefix of a bucket. A zero RequestsPerSecond or MaxConcurrency is not
+// limited, a zero Burst is one second of requests
+type Limit struct {
+	RequestsPerSecond float64
+	Burst             int
+	MaxConcurrency    int
+}
+
+// Request rates of s3 for one prefix, https://docs.aws.amazon.com/AmazonS3/latest/userguide/optimizing-performance.html
+const (
+	DefaultGetRequestsPerSecond = 5500
+	DefaultPutRequestsPerSecond = 3500
+)
+
+const (
+	// After a slow down the rate is halved, down to minRateFraction of the limit, then every successful request gives
+	// back recoveryFraction of the limit
+	minRateFraction  = 0.05
+	recoveryFraction = 0.02
+	// idlePrefixTTL is how long a prefix without requests keeps its limiter, then it starts again from the full rate
+	idlePrefixTTL = 10 * time.Minute
+)
+
+// Limiter paces the requests to every prefix of a bucket, gets and puts separately. S3 partitions its request rates by
+// prefix, so the parallel reads and writes of one landing zone prefix share the same limit. It is built by NewLimiter
+type Limiter interface {
+	acquire(kind requestKind, bucket, key string) (release func(err error))
+}
+
+type requestKind int
+
+const (
+	getRequest requestKind = iota
+	putRequest
+)
+
+type limiter struct {
+	limits   map[requestKind]Limit
+	prefixes map[prefixKey]*prefixLimiter
+	// evictedAt is when the idle prefixes were last evicted, they are looked for once every idlePrefixTTL
+	evictedAt time.Time
+	now       func() time.Time
+	sleep     func(time.Duration)
+	mutex     sync.Mutex
+}
+
+type prefixKey struct {
+	kind   requestKind
+	bucket string
+	prefix string
+}
+
+// NewLimiter limits the gets, GetObject and ListObjects, and the puts, PutObject, CopyObject and DeleteObject, of
+// every prefix
+func NewLimiter(get, put Limit) *limiter {
+	return &limiter{
+		limits:   map[requestKind]Limit{getRequest: get, putRequest: put},
+		prefixes: map[prefixKey]*prefixLimiter{},
+		now:      time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// acquire waits for a token and a free slot of the prefix of key. release frees the slot and adapts the rate to the
+// result of the request
+func (l *limiter) acquire(kind requestKind, bucket, key string) func(err error) {
+	prefixLimiter := l.prefixLimiter(prefixKey{kind: kind, bucket: bucket, prefix: prefixOf(key)})
+	if prefixLimiter.slots != nil {
+		prefixLimiter.slots <- struct{}{}
+	}
+	if wait := prefixLimiter.reserve(); wait > 0 {
+		l.sleep(wait)
+	}
+
+	return func(err error) {
+		prefixLimiter.adapt(err)
+		if prefixLimiter.slots != nil {
+			<-prefixLimiter.slots
+		}
+		l.mutex.Lock()
+		prefixLimiter.requests--
+		prefixLimiter.usedAt = l.now()
+		l.mutex.Unlock()
+	}
+}
+
+// prefixLimiter returns the limiter of the prefix with the request counted in, so it is not evicted before the
+// request is released
+func (l *limiter) prefixLimiter(key prefixKey) *prefixLimiter {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	if now.Sub(l.evictedAt) >= idlePrefixTTL {
+		l.evictIdlePrefixes(now)
+	}
+
+	prefixLimiter, ok := l.prefixes[key]
+	if !ok {
+		prefixLimiter = newPrefixLimiter(l.limits[key.kind], l.now)
+		l.prefixes[key] = prefixLimiter
+	}
+	prefixLimiter.requests++
+	prefixLimiter.usedAt = now
+	return prefixLimiter
+}
+
+// evictIdlePrefixes forgets the prefixes without requests for idlePrefixTTL, so the prefixes of every job do not
+// pile up in a long running worker
+func (l *limiter) evictIdlePrefixes(now time.Time) {
+	for key, prefixLimiter := range l.prefixes {
+		if prefixLimiter.requests == 0 && now.Sub(prefixLimiter.usedAt) >= idlePrefixTTL {
+			delete(l.prefixes, key)
+		}
+	}
+	l.evictedAt = now
+}
+
+// prefixOf is the prefix s3 partitions the key by, its directory
+func prefixOf(key string) string {
+	if dir := path.Dir(key); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// prefixLimiter is a token bucket whose rate goes down on slow downs and back up to the limit on successes, with a
+// semaphore capping the requests in flight
+type prefixLimiter struct {
+	limit  float64
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	slots  chan struct{}
+	mutex  sync.Mutex
+	// requests in flight and usedAt, when the last one started or ended, are guarded by the mutex of the limiter
+	requests int
+	usedAt   time.Time
+}
+
+func newPrefixLimiter(limit Limit, now func() time.Time) *prefixLimiter {
+	burst := float64(limit.Burst)
+	if burst == 0 {
+		burst = math.Max(1, math.Ceil(limit.RequestsPerSecond))
+	}
+
+	prefixLimiter := &prefixLimiter{
+		limit:  limit.RequestsPerSecond,
+		rate:   limit.RequestsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   now(),
+		now:    now,
+	}
+	if limit.MaxConcurrency > 0 {
+		prefixLimiter.slots = make(chan struct{}, limit.MaxConcurrency)
+	}
+	return prefixLimiter
+}
+
+// reserve takes a token and returns how long to wait for it. Tokens are reserved ahead, so the waiting requests are
+// spread at the rate instead of all starting when a token comes back
+func (prefixLimiter *prefixLimiter) reserve() time.Duration {
+	if prefixLimiter.limit <= 0 {
+		return 0
+	}
+
+	prefixLimiter.mutex.Lock()
+	defer prefixLimiter.mutex.Unlock()
+
+	now := prefixLimiter.now()
+	elapsed := now.Sub(prefixLimiter.last).Seconds()
+	prefixLimiter.last = now
+	prefixLimiter.tokens = math.Min(prefixLimiter.burst, prefixLimiter.tokens+elapsed*prefixLimiter.rate)
+
+	prefixLimiter.tokens--
+	if prefixLimiter.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-prefixLimiter.tokens / prefixLimiter.rate * float64(time.Second))
+}
+
+// adapt halves the rate after a slow down of s3 and raises it back by a step after a success
+func (prefixLimiter *prefixLimiter) adapt(err error) {
+	if prefixLimiter.limit <= 0 {
+		return
+	}
+
+	prefixLimiter.mutex.Lock()
+	defer prefixLimiter.mutex.Unlock()
+
+	switch {
+	case err == nil:
+		prefixLimiter.rate = math.Min(prefixLimiter.limit, prefixLimiter.rate+prefixLimiter.limit*recoveryFraction)
+	case etlerrors.Kind(err) == etlerrors.ErrThrottled:
+		prefixLimiter.rate = math.Max(prefixLimiter.limit*minRateFraction, prefixLimiter.rate/2)
+		// The tokens saved up at the previous rate would let the next requests through at once
+		prefixLimiter.tokens = math.Min(prefixLimiter.tokens, 0)
+	}
+}
+
+type limitedSvcClient struct {
+	svc     SvcClient
+	limiter Limiter
+}
+
+// NewLimitedSvcClient paces the requests of svc with limiter. Wrap it with NewRetrySvcClient so every retry is paced
+// too and the slow downs are seen by the limiter
+func NewLimitedSvcClient(svc SvcClient, limiter Limiter) *limitedSvcClient {
+	return &limitedSvcClient{svc: svc, limiter: limiter}
+}
+
+func (client limitedSvcClient) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	release := client.limiter.acquire(getRequest, aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	output, err := client.svc.GetObject(input)
+	release(err)
+	return output, err
+}
+
+// ListObjects is paced with the gets of the listed prefix
+func (client limitedSvcClient) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	release := client.limiter.acquire(getRequest, aws.StringValue(input.Bucket), aws.StringValue(input.Prefix)+"/")
+	output, err := client.svc.ListObjects(input)
+	release(err)
+	return output, err
+}
+
+func (client limitedSvcClient) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	release := client.limiter.acquire(putRequest, aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	output, err := client.svc.PutObject(input)
+	release(err)
+	return output, err
+}
+
+// CopyObject is paced with the puts of the destination
+func (client limitedSvcClient) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	release := client.limiter.acquire(putRequest, aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	output, err := client.svc.CopyObject(input)
+	release(err)
+	return output, err
+}
+
+func (client limitedSvcClient) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	release := client.limiter.acquire(putRequest, aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	output, err := client.svc.DeleteObject(input)
+	release(err)
+	return output, err
+}
+
+var (
+	defaultLimiter Limiter = NewLimiter(
+		Limit{RequestsPerSecond: DefaultGetRequestsPerSecond},
+		Limit{RequestsPerSecond: DefaultPutRequestsPerSecond},
+	)
+	defaultLimiterMutex sync.RWMutex
+)
+
+// DefaultLimiter is shared by the limited clients that were not given one, so the clients of the landing zone, the
+// loading zone and the state store pace the same prefixes together. It follows the request rates of s3
+func DefaultLimiter() Limiter {
+	defaultLimiterMutex.RLock()
+	defer defaultLimiterMutex.RUnlock()
+
+	return defaultLimiter
+}
+
+func SetDefaultLimiter(limiter Limiter) {
+	defaultLimiterMutex.Lock()
+	defer defaultLimiterMutex.Unlock()
+
+	defaultLimiter = limiter
+}
@@ -0,0 +1,123 @@
+package s3aws
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// newTestLimiter runs on a clock that only moves when a request waits, the waits are recorded
+func newTestLimiter(get, put Limit, waits *[]time.Duration) *limiter {
+	now := time.Date(2022, 2, 14, 10, 30, 0, 0, time.UTC)
+	l := NewLimiter(get, put)
+	l.now = func() time.Time { return now }
+	l.sleep = func(wait time.Duration) {
+		*waits = append(*waits, wait)
+	}
+	return l
+}
+
+func TestLimiterPacesEveryPrefix(t *testing.T) {
+	fmt.Println("name: Success when the requests over the burst of a prefix wait for their token")
+
+	var waits []time.Duration
+	l := newTestLimiter(Limit{RequestsPerSecond: 10, Burst: 2}, Limit{RequestsPerSecond: 1}, &waits)
+
+	for i := 0; i < 4; i++ {
+		l.acquire(getRequest, "landing", fmt.Sprintf("analyst/%d.json", i))(nil) //<--- function under test
+	}
+	l.acquire(getRequest, "landing", "provider/a.json")(nil) //<--- function under test
+	l.acquire(putRequest, "landing", "analyst/a.json")(nil)  //<--- function under test
+
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, waits)
+}
+
+func TestLimiterAdaptsToSlowDowns(t *testing.T) {
+	fmt.Println("name: Success when a slow down halves the rate of the prefix and the successes raise it back")
+
+	var waits []time.Duration
+	l := newTestLimiter(Limit{RequestsPerSecond: 100}, Limit{}, &waits)
+	slowDown := awserr.NewRequestFailure(awserr.New("SlowDown", "reduce your request rate", nil), 503, "request-1")
+
+	l.acquire(getRequest, "landing", "analyst/a.json")(slowDown) //<--- function under test
+	l.acquire(getRequest, "landing", "analyst/a.json")(slowDown) //<--- function under test
+	prefix := l.prefixes[prefixKey{kind: getRequest, bucket: "landing", prefix: "analyst"}]
+	assert.Equal(t, float64(25), prefix.rate)
+
+	l.acquire(getRequest, "landing", "analyst/a.json")(errors.New("some s3 error")) //<--- function under test
+	assert.Equal(t, float64(25), prefix.rate)
+
+	for i := 0; i < 100; i++ {
+		l.acquire(getRequest, "landing", "analyst/a.json")(nil) //<--- function under test
+	}
+	assert.Equal(t, float64(100), prefix.rate)
+}
+
+func TestLimiterEvictsIdlePrefixes(t *testing.T) {
+	fmt.Println("name: Success when the prefixes without requests for the ttl are forgotten")
+
+	var waits []time.Duration
+	l := newTestLimiter(Limit{RequestsPerSecond: 100}, Limit{}, &waits)
+	now := l.now()
+	l.now = func() time.Time { return now }
+	l.acquire(getRequest, "landing", "analyst/a.json")(nil)
+	release := l.acquire(getRequest, "landing", "provider/a.json")
+
+	now = now.Add(idlePrefixTTL)
+	l.acquire(getRequest, "landing", "job/a.json")(nil) //<--- function under test
+
+	assert.Equal(t, 2, len(l.prefixes))
+	assert.NotNil(t, l.prefixes[prefixKey{kind: getRequest, bucket: "landing", prefix: "provider"}])
+	assert.NotNil(t, l.prefixes[prefixKey{kind: getRequest, bucket: "landing", prefix: "job"}])
+
+	release(nil)
+	now = now.Add(idlePrefixTTL)
+	l.acquire(getRequest, "landing", "job/a.json")(nil) //<--- function under test
+
+	assert.Equal(t, 1, len(l.prefixes))
+}
+
+func TestLimiterCapsTheConcurrency(t *testing.T) {
+	fmt.Println("name: Success when a request waits for a free slot of its prefix")
+
+	l := NewLimiter(Limit{MaxConcurrency: 1}, Limit{})
+	release := l.acquire(getRequest, "landing", "analyst/a.json")
+	acquired := make(chan struct{})
+
+	go func() {
+		l.acquire(getRequest, "landing", "analyst/b.json")(nil) //<--- function under test
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("the request was not limited")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release(nil)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the request did not get the released slot")
+	}
+}
+
+func TestLimitedSvcClient(t *testing.T) {
+	fmt.Println("name: Success when the slow downs of the service slow down the prefix of the object")
+
+	var waits []time.Duration
+	l := newTestLimiter(Limit{}, Limit{RequestsPerSecond: 10}, &waits)
+	svc := NewLimitedSvcClient(mockS3Client{
+		putObjectError: awserr.NewRequestFailure(awserr.New("SlowDown", "reduce your request rate", nil), 503, "request-1"),
+	}, l)
+
+	_, err := svc.PutObject(&s3.PutObjectInput{Bucket: aws.String("loading"), Key: aws.String("456/a.json")}) //<--- function under test
+
+	assert.NotNil(t, err)
+	assert.Equal(t, float64(5), l.prefixes[prefixKey{kind: putRequest, bucket: "loading", prefix: "456"}].rate)
+}
@@ -0,0 +1,71 @@
+package s3aws
+
+import (
+	"github.com/anhamdan/etl-base/retry"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+)
+
+type retrySvcClient struct {
+	svc     SvcClient
+	retrier retry.Retrier
+}
+
+// NewRetrySvcClient calls svc again after its retryable errors, the operations are named after the s3 api, like
+// GetObject
+func NewRetrySvcClient(svc SvcClient, retrier retry.Retrier) *retrySvcClient {
+	return &retrySvcClient{svc: svc, retrier: retrier}
+}
+
+func (client retrySvcClient) GetObject(input *s3.GetObjectInput) (output *s3.GetObjectOutput, err error) {
+	err = client.retrier.Do("GetObject", func() error {
+		output, err = client.svc.GetObject(input)
+		return err
+	})
+	return output, err
+}
+
+// PutObject sends the body again from where it started on every attempt
+func (client retrySvcClient) PutObject(input *s3.PutObjectInput) (output *s3.PutObjectOutput, err error) {
+	var start int64
+	if input.Body != nil {
+		if start, err = input.Body.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	err = client.retrier.Do("PutObject", func() error {
+		if input.Body != nil {
+			if _, err := input.Body.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		output, err = client.svc.PutObject(input)
+		return err
+	})
+	return output, err
+}
+
+func (client retrySvcClient) ListObjects(input *s3.ListObjectsInput) (output *s3.ListObjectsOutput, err error) {
+	err = client.retrier.Do("ListObjects", func() error {
+		output, err = client.svc.ListObjects(input)
+		return err
+	})
+	return output, err
+}
+
+func (client retrySvcClient) CopyObject(input *s3.CopyObjectInput) (output *s3.CopyObjectOutput, err error) {
+	err = client.retrier.Do("CopyObject", func() error {
+		output, err = client.svc.CopyObject(input)
+		return err
+	})
+	return output, err
+}
+
+func (client retrySvcClient) DeleteObject(input *s3.DeleteObjectInput) (output *s3.DeleteObjectOutput, err error) {
+	err = client.retrier.Do("DeleteObject", func() error {
+		output, err = client.svc.DeleteObject(input)
+		return err
+	})
+	return output, err
+}
@@ -0,0 +1,41 @@
+package s3aws
+
+import (
+	"fmt"
+	"github.com/anhamdan/etl-base/retry"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// flakySvcClient fails the first puts with a slow down, like s3 under load
+type flakySvcClient struct {
+	mockS3Client
+	failures int
+	bodies   []string
+}
+
+func (svc *flakySvcClient) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	body, _ := ioutil.ReadAll(input.Body)
+	svc.bodies = append(svc.bodies, string(body))
+	if len(svc.bodies) <= svc.failures {
+		return nil, awserr.NewRequestFailure(awserr.New("SlowDown", "reduce your request rate", nil), 503, "request-1")
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestRetrySvcClient(t *testing.T) {
+	fmt.Println("name: Success when a put is retried after a slow down with the whole body")
+
+	svc := &flakySvcClient{failures: 2}
+	s3Client := NewS3Client(NewRetrySvcClient(svc, retry.New(retry.Policy{InitialInterval: time.Millisecond})), defaultBucket)
+
+	path, err := s3Client.Insert(defaultPath, []byte(`[{"TreeElemId": 123}]`)) //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, "someBucket/some/path", *path)
+	assert.Equal(t, []string{`[{"TreeElemId": 123}]`, `[{"TreeElemId": 123}]`, `[{"TreeElemId": 123}]`}, svc.bodies)
+}
@@ -2,31 +2,46 @@ package s3aws
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/logging"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"io/ioutil"
+	"net/url"
+	"path"
 )
 
 type S3Client interface {
 	Read(bucket, path string) ([]byte, error)
 	Insert(path string, content []byte) (*string, error)
 	ListObjects(path string) (*[]*string, error)
+	Copy(srcPath, dstPath string) (*string, error)
+	Delete(path string) error
 }
 
 type SvcClient interface {
 	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
 	PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
 	ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error)
+	CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error)
+	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
 }
 
 type s3Client struct {
 	svc    SvcClient
 	bucket string
+	logger logging.Logger
 }
 
 func NewS3Client(svc SvcClient, bucket string) *s3Client {
-	return &s3Client{svc: svc, bucket: bucket}
+	return &s3Client{svc: svc, bucket: bucket, logger: logging.Default()}
+}
+
+func (s3Client *s3Client) SetLogger(logger logging.Logger) {
+	s3Client.logger = logger
 }
 
 func (s3Client s3Client) Read(bucket, path string) ([]byte, error) {
@@ -38,13 +53,13 @@ func (s3Client s3Client) Read(bucket, path string) ([]byte, error) {
 
 	result, err := s3Client.svc.GetObject(requestInput)
 	if err != nil {
-		return nil, err
+		return nil, etlerrors.Wrap(fmt.Sprintf("failed to read s3://%s/%s", bucket, path), err)
 	}
 
 	defer result.Body.Close()
 	body, err := ioutil.ReadAll(result.Body)
 	if err != nil {
-		return nil, err
+		return nil, etlerrors.Wrap(fmt.Sprintf("failed to read s3://%s/%s", bucket, path), err)
 	}
 
 	return body, nil
@@ -59,7 +74,7 @@ func (s3Client s3Client) ListObjects(path string) (*[]*string, error) {
 
 	result, err := s3Client.svc.ListObjects(requestInput)
 	if err != nil {
-		return nil, err
+		return nil, etlerrors.Wrap(fmt.Sprintf("failed to list s3://%s/%s", s3Client.bucket, path), err)
 	}
 
 	fileNames := make([]*string, len(result.Contents))
@@ -81,12 +96,64 @@ func (s3Client s3Client) Insert(path string, content []byte) (*string, error) {
 
 	_, err := s3Client.svc.PutObject(&input)
 	if err != nil {
-		return nil, err
+		return nil, etlerrors.Wrap(fmt.Sprintf("failed to write s3://%s/%s", s3Client.bucket, path), err)
 	}
 
-	fmt.Printf("Inserting into s3 bucket: %s on path: %s\n\n", s3Client.bucket, path)
+	s3Client.logger.Debug("Inserted the object", logging.F("bucket", s3Client.bucket), logging.F("key", path))
 
-	outputPath := s3Client.bucket + path
+	outputPath := s3Client.outputPath(path)
 
 	return &outputPath, nil
 }
+
+// Copy copies the object on srcPath to dstPath inside the client bucket
+func (s3Client s3Client) Copy(srcPath, dstPath string) (*string, error) {
+	source := url.URL{Path: s3Client.bucket + "/" + srcPath}
+
+	input := s3.CopyObjectInput{
+		Bucket:     aws.String(s3Client.bucket),
+		CopySource: aws.String(source.EscapedPath()),
+		Key:        aws.String(dstPath),
+	}
+
+	_, err := s3Client.svc.CopyObject(&input)
+	if err != nil {
+		return nil, etlerrors.Wrap(fmt.Sprintf("failed to copy s3://%s/%s to %s", s3Client.bucket, srcPath, dstPath), err)
+	}
+
+	outputPath := s3Client.outputPath(dstPath)
+
+	return &outputPath, nil
+}
+
+// Delete removes the object on path from the client bucket
+func (s3Client s3Client) Delete(path string) error {
+	input := s3.DeleteObjectInput{
+		Bucket: aws.String(s3Client.bucket),
+		Key:    aws.String(path),
+	}
+
+	_, err := s3Client.svc.DeleteObject(&input)
+	if err != nil {
+		return etlerrors.Wrap(fmt.Sprintf("failed to delete s3://%s/%s", s3Client.bucket, path), err)
+	}
+
+	return nil
+}
+
+// IsNotFound reports whether the error returned by the client is caused by a missing object. A missing bucket is not
+// one, it is an error of the config
+func IsNotFound(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+func (s3Client s3Client) outputPath(key string) string {
+	return path.Join(s3Client.bucket, key)
+}
@@ -3,6 +3,8 @@ package s3aws
 import (
 	"errors"
 	"fmt"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
@@ -31,6 +33,8 @@ type mockS3Client struct {
 	putObjectError     error
 	listObjectResponse *s3.ListObjectsOutput
 	listObjectError    error
+	copyObjectError    error
+	deleteObjectError  error
 }
 
 func (mock mockS3Client) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
@@ -42,6 +46,12 @@ func (mock mockS3Client) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutpu
 func (mock mockS3Client) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
 	return mock.listObjectResponse, mock.listObjectError
 }
+func (mock mockS3Client) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	return &s3.CopyObjectOutput{}, mock.copyObjectError
+}
+func (mock mockS3Client) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	return &s3.DeleteObjectOutput{}, mock.deleteObjectError
+}
 
 var (
 	defaultPath   = "some/path"
@@ -61,14 +71,14 @@ func TestRead(t *testing.T) {
 		{
 			name:          "Fail when trying to get object from s3",
 			s3Client:      mockS3Client{getObjectError: errors.New("some s3 error")},
-			expectedError: errors.New("some s3 error"),
+			expectedError: etlerrors.Wrap("failed to read s3://someBucket/some/path", errors.New("some s3 error")),
 		},
 		{
 			name: "Fail when trying to get object from s3",
 			s3Client: mockS3Client{getObjectResponse: &s3.GetObjectOutput{
 				Body: faultyReadCloser,
 			}},
-			expectedError: errors.New("test error"),
+			expectedError: etlerrors.Wrap("failed to read s3://someBucket/some/path", errors.New("test error")),
 		},
 		{
 			name: "Success when trying to get object from s3",
@@ -98,7 +108,7 @@ func TestInsert(t *testing.T) {
 		{
 			name:          "Fail when trying to put object in s3 bucket",
 			s3Client:      mockS3Client{putObjectError: errors.New("some s3 error")},
-			expectedError: errors.New("some s3 error"),
+			expectedError: etlerrors.Wrap("failed to write s3:///some/path", errors.New("some s3 error")),
 		},
 		{
 			name:         "Success when trying to put object in s3 bucket",
@@ -118,3 +128,64 @@ func TestInsert(t *testing.T) {
 		assert.Equal(t, test.expectedError, err)
 	}
 }
+
+func TestCopy(t *testing.T) {
+	expectedPath := "someBucket/final/path"
+
+	tests := []s3InsertTest{
+		{
+			name:          "Fail when trying to copy object in s3 bucket",
+			s3Client:      mockS3Client{copyObjectError: errors.New("some s3 error")},
+			expectedError: etlerrors.Wrap("failed to copy s3://someBucket/staging/path to final/path", errors.New("some s3 error")),
+		},
+		{
+			name:         "Success when trying to copy object in s3 bucket",
+			expectedPath: &expectedPath,
+			s3Client:     mockS3Client{},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		s3Client := NewS3Client(test.s3Client, defaultBucket)
+
+		path, err := s3Client.Copy("staging/path", "final/path") //<--- function under test
+
+		assert.Equal(t, test.expectedPath, path)
+		assert.Equal(t, test.expectedError, err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []s3InsertTest{
+		{
+			name:          "Fail when trying to delete object from s3 bucket",
+			s3Client:      mockS3Client{deleteObjectError: errors.New("some s3 error")},
+			expectedError: etlerrors.Wrap("failed to delete s3://someBucket/some/path", errors.New("some s3 error")),
+		},
+		{
+			name:     "Success when trying to delete object from s3 bucket",
+			s3Client: mockS3Client{},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		s3Client := NewS3Client(test.s3Client, defaultBucket)
+
+		err := s3Client.Delete(defaultPath) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, IsNotFound(awserr.New(s3.ErrCodeNoSuchKey, "missing", nil)))
+	assert.True(t, IsNotFound(awserr.New("NotFound", "missing", nil)))
+	assert.False(t, IsNotFound(awserr.New("AccessDenied", "denied", nil)))
+	assert.False(t, IsNotFound(errors.New("some s3 error")))
+	assert.False(t, IsNotFound(awserr.New(s3.ErrCodeNoSuchBucket, "missing", nil)))
+	assert.True(t, IsNotFound(etlerrors.Wrap("failed to read s3://someBucket/some/path", awserr.New(s3.ErrCodeNoSuchKey, "missing", nil))))
+}
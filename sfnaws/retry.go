@@ -0,0 +1,33 @@
+package sfnaws
+
+import (
+	"github.com/anhamdan/etl-base/retry"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+type retryMessageClient struct {
+	svc     SFNMessageClient
+	retrier retry.Retrier
+}
+
+// NewRetryMessageClient calls svc again after its retryable errors, the operations are named SendTaskSuccess and
+// SendTaskFailure
+func NewRetryMessageClient(svc SFNMessageClient, retrier retry.Retrier) *retryMessageClient {
+	return &retryMessageClient{svc: svc, retrier: retrier}
+}
+
+func (client retryMessageClient) SendTaskSuccess(input *sfn.SendTaskSuccessInput) (output *sfn.SendTaskSuccessOutput, err error) {
+	err = client.retrier.Do("SendTaskSuccess", func() error {
+		output, err = client.svc.SendTaskSuccess(input)
+		return err
+	})
+	return output, err
+}
+
+func (client retryMessageClient) SendTaskFailure(input *sfn.SendTaskFailureInput) (output *sfn.SendTaskFailureOutput, err error) {
+	err = client.retrier.Do("SendTaskFailure", func() error {
+		output, err = client.svc.SendTaskFailure(input)
+		return err
+	})
+	return output, err
+}
@@ -0,0 +1,73 @@
+package sfnaws
+
+import (
+	"fmt"
+	"github.com/anhamdan/etl-base/retry"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// flakySfnClient throttles the first task successes and fails the task failures with a timed out task
+type flakySfnClient struct {
+	sfnClientMock
+	failures int
+	calls    map[string]int
+}
+
+func (client *flakySfnClient) SendTaskSuccess(input *sfn.SendTaskSuccessInput) (*sfn.SendTaskSuccessOutput, error) {
+	client.calls["SendTaskSuccess"]++
+	if client.calls["SendTaskSuccess"] <= client.failures {
+		return nil, awserr.New("ThrottlingException", "rate exceeded", nil)
+	}
+	return &sfn.SendTaskSuccessOutput{}, nil
+}
+
+func (client *flakySfnClient) SendTaskFailure(input *sfn.SendTaskFailureInput) (*sfn.SendTaskFailureOutput, error) {
+	client.calls["SendTaskFailure"]++
+	return nil, awserr.New(sfn.ErrCodeTaskTimedOut, "task timed out", nil)
+}
+
+func TestRetryMessageClient(t *testing.T) {
+	fmt.Println("name: Success when the throttled calls are retried and the permanent ones are not")
+
+	flaky := &flakySfnClient{failures: 2, calls: map[string]int{}}
+	sfnClient := NewWithSvc(flaky)
+	sfnClient.SetRetrier(retry.New(retry.Policy{InitialInterval: time.Millisecond}))
+	svc := sfnClient.CreateSFNClient(nil, "some role")
+
+	successErr := sfnClient.SendTaskSuccess("{}", "token-1", svc)                 //<--- function under test
+	failureErr := sfnClient.SendTaskFailure("SomeError", "cause", "token-2", svc) //<--- function under test
+
+	assert.Nil(t, successErr)
+	assert.NotNil(t, failureErr)
+	assert.Equal(t, map[string]int{"SendTaskSuccess": 3, "SendTaskFailure": 1}, flaky.calls)
+}
+
+func TestCreateSFNClientRetries(t *testing.T) {
+	fmt.Println("name: Success when the task results are only retried by the retrier, not by the sdk")
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(`{"__type": "InternalError", "message": "try again"}`))
+	}))
+	defer server.Close()
+	sess, err := session.NewSession(&aws.Config{Endpoint: aws.String(server.URL), Region: aws.String("eu-west-1"), Credentials: credentials.NewStaticCredentials("test", "test", "")})
+	assert.Nil(t, err)
+	sfnClient := New()
+	sfnClient.SetRetrier(retry.New(retry.Policy{InitialInterval: time.Millisecond, MaxAttempts: 3}))
+
+	err = sfnClient.SendTaskSuccess("{}", "token-1", sfnClient.CreateSFNClient(sess, "")) //<--- function under test
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, requests)
+}
@@ -1,25 +1,43 @@
 package sfnaws
 
 import (
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/retry"
+	"github.com/anhamdan/etl-base/stsaws"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sfn"
 )
 
 type SFNClient interface {
 	SendTaskSuccess(output, taskToken string, svc SFNMessageClient) error
-	CreateSFNClient(sess *session.Session, roleArn string) *sfn.SFN
+	SendTaskFailure(errorCode, cause, taskToken string, svc SFNMessageClient) error
+	CreateSFNClient(sess *session.Session, roleArn string) SFNMessageClient
 }
 
-type sfnClient struct{}
+type sfnClient struct {
+	svc     SFNMessageClient
+	retrier retry.Retrier
+}
 
 type SFNMessageClient interface {
 	SendTaskSuccess(input *sfn.SendTaskSuccessInput) (*sfn.SendTaskSuccessOutput, error)
+	SendTaskFailure(input *sfn.SendTaskFailureInput) (*sfn.SendTaskFailureOutput, error)
 }
 
+// New retries the task results sent to the step functions with retry.Default()
 func New() *sfnClient {
-	return &sfnClient{}
+	return &sfnClient{retrier: retry.Default()}
+}
+
+// NewWithSvc returns a client that always sends task results through svc instead of assuming a role
+func NewWithSvc(svc SFNMessageClient) *sfnClient {
+	return &sfnClient{svc: svc, retrier: retry.Default()}
+}
+
+// SetRetrier retries the task results sent through the clients created next with retrier
+func (client *sfnClient) SetRetrier(retrier retry.Retrier) {
+	client.retrier = retrier
 }
 
 func (client sfnClient) SendTaskSuccess(output, taskToken string, svc SFNMessageClient) error {
@@ -29,15 +47,32 @@ func (client sfnClient) SendTaskSuccess(output, taskToken string, svc SFNMessage
 	})
 
 	if err != nil {
-		return err
+		return etlerrors.Wrap("failed to send the task success", err)
 	}
 
 	return nil
 }
 
-func (client sfnClient) CreateSFNClient(sess *session.Session, roleArn string) *sfn.SFN {
-	credentials := stscreds.NewCredentials(sess, roleArn)
-	sfnClient := sfn.New(sess, &aws.Config{Credentials: credentials})
+func (client sfnClient) SendTaskFailure(errorCode, cause, taskToken string, svc SFNMessageClient) error {
+	_, err := svc.SendTaskFailure(&sfn.SendTaskFailureInput{
+		Error:     aws.String(errorCode),
+		Cause:     aws.String(cause),
+		TaskToken: aws.String(taskToken),
+	})
+
+	if err != nil {
+		return etlerrors.Wrap("failed to send the task failure", err)
+	}
+
+	return nil
+}
+
+// CreateSFNClient signs with the credentials of the role, they are shared with every client built from sess and
+// only refreshed when they are about to expire. The calls are only retried by the retrier, not by the sdk
+func (client sfnClient) CreateSFNClient(sess *session.Session, roleArn string) SFNMessageClient {
+	if client.svc != nil {
+		return NewRetryMessageClient(client.svc, client.retrier)
+	}
 
-	return sfnClient
+	return NewRetryMessageClient(sfn.New(stsaws.ForSession(sess).Session(roleArn), aws.NewConfig().WithMaxRetries(0)), client.retrier)
 }
@@ -3,6 +3,8 @@ package sfnaws
 import (
 	"errors"
 	"fmt"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/retry"
 	"github.com/aws/aws-sdk-go/service/sfn"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -18,18 +20,24 @@ type sfnTest struct {
 type sfnClientMock struct {
 	sendTaskSuccessOutput *sfn.SendTaskSuccessOutput
 	sendTaskSuccessError  error
+	sendTaskFailureOutput *sfn.SendTaskFailureOutput
+	sendTaskFailureError  error
 }
 
 func (mock sfnClientMock) SendTaskSuccess(input *sfn.SendTaskSuccessInput) (*sfn.SendTaskSuccessOutput, error) {
 	return mock.sendTaskSuccessOutput, mock.sendTaskSuccessError
 }
 
+func (mock sfnClientMock) SendTaskFailure(input *sfn.SendTaskFailureInput) (*sfn.SendTaskFailureOutput, error) {
+	return mock.sendTaskFailureOutput, mock.sendTaskFailureError
+}
+
 func TestSendTaskSuccess(t *testing.T) {
 	tests := []sfnTest{
 		{
 			name:          "Fail when sending task success to step function",
 			sfnClient:     sfnClientMock{sendTaskSuccessError: errors.New("some step function error")},
-			expectedError: errors.New("some step function error"),
+			expectedError: etlerrors.Wrap("failed to send the task success", errors.New("some step function error")),
 		},
 		{
 			name:      "Fail when sending task success to step function",
@@ -47,3 +55,35 @@ func TestSendTaskSuccess(t *testing.T) {
 		assert.Equal(t, test.expectedError, err)
 	}
 }
+
+func TestSendTaskFailure(t *testing.T) {
+	tests := []sfnTest{
+		{
+			name:          "Fail when sending task failure to step function",
+			sfnClient:     sfnClientMock{sendTaskFailureError: errors.New("some step function error")},
+			expectedError: etlerrors.Wrap("failed to send the task failure", errors.New("some step function error")),
+		},
+		{
+			name:      "Success when sending task failure to step function",
+			sfnClient: sfnClientMock{},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		sfnClient := New()
+
+		err := sfnClient.SendTaskFailure("SomeError", "some cause", "", test.sfnClient)
+
+		assert.Equal(t, test.expectedError, err)
+	}
+}
+
+func TestCreateSFNClientWithSvc(t *testing.T) {
+	fmt.Println("name: Success when creating a client bound to a service, retried with the default retrier")
+
+	svc := sfnClientMock{}
+
+	assert.Equal(t, NewRetryMessageClient(svc, retry.Default()), NewWithSvc(svc).CreateSFNClient(nil, "some role"))
+}
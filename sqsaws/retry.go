@@ -0,0 +1,41 @@
+package sqsaws
+
+import (
+	"github.com/anhamdan/etl-base/retry"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+type retryMessageClient struct {
+	sqs     SQSMessageClient
+	retrier retry.Retrier
+}
+
+// NewRetryMessageClient calls sqs again after its retryable errors, the operations are named ReceiveMessage,
+// DeleteMessage and ChangeMessageVisibility
+func NewRetryMessageClient(sqs SQSMessageClient, retrier retry.Retrier) *retryMessageClient {
+	return &retryMessageClient{sqs: sqs, retrier: retrier}
+}
+
+func (client retryMessageClient) ReceiveMessage(input *sqs.ReceiveMessageInput) (output *sqs.ReceiveMessageOutput, err error) {
+	err = client.retrier.Do("ReceiveMessage", func() error {
+		output, err = client.sqs.ReceiveMessage(input)
+		return err
+	})
+	return output, err
+}
+
+func (client retryMessageClient) DeleteMessage(input *sqs.DeleteMessageInput) (output *sqs.DeleteMessageOutput, err error) {
+	err = client.retrier.Do("DeleteMessage", func() error {
+		output, err = client.sqs.DeleteMessage(input)
+		return err
+	})
+	return output, err
+}
+
+func (client retryMessageClient) ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (output *sqs.ChangeMessageVisibilityOutput, err error) {
+	err = client.retrier.Do("ChangeMessageVisibility", func() error {
+		output, err = client.sqs.ChangeMessageVisibility(input)
+		return err
+	})
+	return output, err
+}
@@ -0,0 +1,40 @@
+package sqsaws
+
+import (
+	"fmt"
+	"github.com/anhamdan/etl-base/retry"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// flakySqsClient fails the first receives with a server error
+type flakySqsClient struct {
+	mockSqsClient
+	failures int
+	calls    int
+}
+
+func (client *flakySqsClient) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	client.calls++
+	if client.calls <= client.failures {
+		return nil, awserr.NewRequestFailure(awserr.New("InternalError", "internal error", nil), 500, "request-1")
+	}
+	return client.mockSqsClient.ReceiveMessage(input)
+}
+
+func TestRetryMessageClient(t *testing.T) {
+	fmt.Println("name: Success when a receive is retried after a server error")
+
+	body := "message from sqs"
+	flaky := &flakySqsClient{mockSqsClient: mockSqsClient{receiveMessageResponse: &sqs.ReceiveMessageOutput{Messages: []*sqs.Message{{Body: &body}}}}, failures: 1}
+	client := New(NewRetryMessageClient(flaky, retry.New(retry.Policy{InitialInterval: time.Millisecond})), "")
+
+	messages, err := client.Receive() //<--- function under test
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, flaky.calls)
+	assert.Equal(t, "message from sqs", *messages[0].Body)
+}
@@ -1,67 +1,123 @@
 package sqsaws
 
 import (
-	"errors"
 	"fmt"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/health"
+	"github.com/anhamdan/etl-base/logging"
+	"github.com/anhamdan/etl-base/metrics"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
-	"log"
+	"math"
 	"time"
 )
 
 type SQSClient interface {
 	Poll(chn chan *sqs.Message, errChan chan error)
 	DeleteMessage(msg *sqs.Message) error
+	ChangeVisibility(msg *sqs.Message, timeout time.Duration) error
 }
 
 type SQSMessageClient interface {
 	ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error)
 	DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error)
 }
 
 type sqsClient struct {
-	sqs SQSMessageClient
-	url string
+	sqs     SQSMessageClient
+	url     string
+	logger  logging.Logger
+	metrics metrics.Metrics
+	health  health.Monitor
 }
 
 func New(sqs SQSMessageClient, url string) sqsClient {
-	return sqsClient{sqs: sqs, url: url}
+	return sqsClient{sqs: sqs, url: url, logger: logging.Default(), metrics: metrics.Default(), health: health.Default()}
+}
+
+func (client *sqsClient) SetLogger(logger logging.Logger) {
+	client.logger = logger
+}
+
+// SetMetrics counts the received and deleted messages and the failures of both on m
+func (client *sqsClient) SetMetrics(m metrics.Metrics) {
+	client.metrics = m
+}
+
+// SetHealth reports every poll of the queue to m, the worker is not ready when the last successful one is too old
+func (client *sqsClient) SetHealth(m health.Monitor) {
+	client.health = m
 }
 
 func (client sqsClient) Poll(chn chan *sqs.Message, errChan chan error) {
 	defer close(chn)
 	defer close(errChan)
 
-	log.Printf("Listening on stack queue: %s", client.url)
+	client.logger.Info("Listening on the queue", logging.F("queueURL", client.url))
 
 	for {
-		output, err := client.sqs.ReceiveMessage(&sqs.ReceiveMessageInput{
-			QueueUrl:            &client.url,
-			MaxNumberOfMessages: aws.Int64(1),
-			WaitTimeSeconds:     aws.Int64(2),
-		})
-
+		messages, err := client.Receive()
 		if err != nil {
-			errChan <- errors.New(fmt.Sprintf("failed to fetch sqs message, error: %s", err.Error()))
+			errChan <- err
 			time.Sleep(5 * time.Second)
+			continue
 		}
 
-		for _, message := range output.Messages {
+		for _, message := range messages {
 			chn <- message
 		}
 	}
 }
 
+// Receive long polls the queue once
+func (client sqsClient) Receive() ([]*sqs.Message, error) {
+	output, err := client.sqs.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            &client.url,
+		MaxNumberOfMessages: aws.Int64(1),
+		// The trace context of the event travels in the attributes
+		MessageAttributeNames: aws.StringSlice([]string{"All"}),
+		WaitTimeSeconds:       aws.Int64(2),
+	})
+
+	if err != nil {
+		client.metrics.Count(metrics.MessagesFailed, 1, metrics.L(metrics.Operation, "receive"))
+		err = etlerrors.Wrap("failed to fetch sqs message", err)
+		client.health.PollFailed(err)
+		return nil, err
+	}
+
+	client.health.PollSucceeded()
+	client.metrics.Count(metrics.MessagesReceived, float64(len(output.Messages)))
+	return output.Messages, nil
+}
+
 func (client sqsClient) DeleteMessage(msg *sqs.Message) error {
-	fmt.Printf("Deleting message with id: %s\n", *msg.MessageId)
+	client.logger.Debug("Deleting the message", logging.F(logging.MessageID, *msg.MessageId))
 
 	_, err := client.sqs.DeleteMessage(&sqs.DeleteMessageInput{
 		QueueUrl:      &client.url,
 		ReceiptHandle: msg.ReceiptHandle,
 	})
 	if err != nil {
-		return errors.New(fmt.Sprintf("Deleting message with id: %s failed", *msg.MessageId))
+		client.metrics.Count(metrics.MessagesFailed, 1, metrics.L(metrics.Operation, "delete"))
+		return etlerrors.Wrap(fmt.Sprintf("Deleting message with id: %s failed", *msg.MessageId), err)
 	}
 
+	client.metrics.Count(metrics.MessagesDeleted, 1)
+	return nil
+}
+
+// ChangeVisibility hides the message from the other receivers for timeout from now, rounded up to a second
+func (client sqsClient) ChangeVisibility(msg *sqs.Message, timeout time.Duration) error {
+	_, err := client.sqs.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          &client.url,
+		ReceiptHandle:     msg.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(int64(math.Ceil(timeout.Seconds()))),
+	})
+	if err != nil {
+		client.metrics.Count(metrics.MessagesFailed, 1, metrics.L(metrics.Operation, "change_visibility"))
+		return etlerrors.Wrap(fmt.Sprintf("Changing the visibility of message with id: %s failed", aws.StringValue(msg.MessageId)), err)
+	}
 	return nil
 }
@@ -1,11 +1,16 @@
 package sqsaws
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"github.com/anhamdan/etl-base/etlerrors"
+	"github.com/anhamdan/etl-base/health"
+	"github.com/anhamdan/etl-base/metrics"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 type sqsTestCase struct {
@@ -20,6 +25,8 @@ type mockSqsClient struct {
 	receiveMessageError    error
 	deleteMessageResponse  *sqs.DeleteMessageOutput
 	deleteMessageError     error
+	changeVisibilityError  error
+	visibilityTimeouts     *[]int64
 }
 
 func (m mockSqsClient) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
@@ -30,6 +37,13 @@ func (m mockSqsClient) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.Delete
 	return m.deleteMessageResponse, m.deleteMessageError
 }
 
+func (m mockSqsClient) ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	if m.visibilityTimeouts != nil {
+		*m.visibilityTimeouts = append(*m.visibilityTimeouts, *input.VisibilityTimeout)
+	}
+	return &sqs.ChangeMessageVisibilityOutput{}, m.changeVisibilityError
+}
+
 func TestPollSuccess(t *testing.T) {
 	channel := make(chan *sqs.Message, 1000)
 
@@ -57,7 +71,7 @@ func TestPollSuccess(t *testing.T) {
 
 func TestPollFailure(t *testing.T) {
 	errChan := make(chan error, 1000)
-	expectedError := errors.New("failed to fetch sqs message, error: some sqs error")
+	expectedError := etlerrors.Wrap("failed to fetch sqs message", errors.New("some sqs error"))
 
 	fmt.Println("name: Success when reading messages from the aws sqs service")
 	mockedSQSMessageClient := mockSqsClient{receiveMessageError: errors.New("some sqs error")}
@@ -86,7 +100,7 @@ func TestDeleteMessage(t *testing.T) {
 				ReceiptHandle:          nil,
 			},
 			sqsMessageClient: mockSqsClient{deleteMessageError: errors.New("some delete sqs message error")},
-			expectedError:    errors.New(fmt.Sprintf("Deleting message with id: %s failed", msgID)),
+			expectedError:    etlerrors.Wrap(fmt.Sprintf("Deleting message with id: %s failed", msgID), errors.New("some delete sqs message error")),
 		},
 		{
 			name: "Success when deleting message from sqs queue",
@@ -113,3 +127,86 @@ func TestDeleteMessage(t *testing.T) {
 		assert.Equal(t, test.expectedError, err)
 	}
 }
+
+func TestChangeVisibility(t *testing.T) {
+	msgID := "123"
+	tests := []struct {
+		name                       string
+		timeout                    time.Duration
+		changeVisibilityError      error
+		expectedVisibilityTimeouts []int64
+		expectedError              error
+	}{
+		{
+			name:                       "Success when the visibility timeout is rounded up to a second",
+			timeout:                    1500 * time.Millisecond,
+			expectedVisibilityTimeouts: []int64{2},
+		},
+		{
+			name:                       "Failure when changing the visibility of the message",
+			timeout:                    time.Minute,
+			changeVisibilityError:      errors.New("some change visibility error"),
+			expectedVisibilityTimeouts: []int64{60},
+			expectedError:              etlerrors.Wrap(fmt.Sprintf("Changing the visibility of message with id: %s failed", msgID), errors.New("some change visibility error")),
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		var visibilityTimeouts []int64
+		sqsClient := New(mockSqsClient{changeVisibilityError: test.changeVisibilityError, visibilityTimeouts: &visibilityTimeouts}, "")
+
+		err := sqsClient.ChangeVisibility(&sqs.Message{MessageId: &msgID}, test.timeout) //<--- function under test
+
+		assert.Equal(t, test.expectedError, err)
+		assert.Equal(t, test.expectedVisibilityTimeouts, visibilityTimeouts)
+	}
+}
+
+func TestMessageMetrics(t *testing.T) {
+	fmt.Println("name: Success when counting the received and deleted messages and the failures")
+
+	msgID := "123"
+	registry := metrics.NewRegistry()
+	client := New(mockSqsClient{receiveMessageResponse: &sqs.ReceiveMessageOutput{Messages: []*sqs.Message{{MessageId: &msgID}}}}, "")
+	client.SetMetrics(registry)
+	failingClient := New(mockSqsClient{receiveMessageError: errors.New("some receive error"), deleteMessageError: errors.New("some delete error")}, "")
+	failingClient.SetMetrics(registry)
+
+	_, _ = client.Receive()                                          //<--- function under test
+	_ = client.DeleteMessage(&sqs.Message{MessageId: &msgID})        //<--- function under test
+	_, _ = failingClient.Receive()                                   //<--- function under test
+	_ = failingClient.DeleteMessage(&sqs.Message{MessageId: &msgID}) //<--- function under test
+
+	output := &bytes.Buffer{}
+	assert.Nil(t, registry.WritePrometheus(output))
+	assert.Equal(t, `# TYPE etl_messages_deleted_total counter
+etl_messages_deleted_total 1
+# TYPE etl_messages_failed_total counter
+etl_messages_failed_total{operation="delete"} 1
+etl_messages_failed_total{operation="receive"} 1
+# TYPE etl_messages_received_total counter
+etl_messages_received_total 1
+`, output.String())
+}
+
+func TestPollHealth(t *testing.T) {
+	fmt.Println("name: Success when the successful and failed polls are reported to the health monitor")
+
+	monitor := health.NewMonitor(time.Minute)
+	failingClient := New(mockSqsClient{receiveMessageError: errors.New("some receive error")}, "")
+	failingClient.SetHealth(monitor)
+	client := New(mockSqsClient{receiveMessageResponse: &sqs.ReceiveMessageOutput{}}, "")
+	client.SetHealth(monitor)
+
+	_, _ = failingClient.Receive() //<--- function under test
+	notPolled := monitor.Status()
+	_, _ = client.Receive() //<--- function under test
+	polled := monitor.Status()
+
+	assert.False(t, notPolled.Ready)
+	assert.Equal(t, "failed to fetch sqs message, error: some receive error", notPolled.LastError.Message)
+	assert.True(t, polled.Ready)
+	assert.NotNil(t, polled.LastPollAt)
+}
@@ -0,0 +1,113 @@
+package stsaws
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"sync"
+	"time"
+)
+
+// DefaultExpiryWindow refreshes the assumed role credentials this long before they expire, so no request is signed
+// with credentials about to expire
+const DefaultExpiryWindow = time.Minute
+
+// DefaultMaxRoles is how many roles a cache keeps the credentials of, the least recently used role is forgotten first.
+// The clients already signing with its credentials keep refreshing them
+const DefaultMaxRoles = 100
+
+// CredentialsCache shares the credentials of the assumed roles between the s3, sqs and sfn clients, so a role is
+// only assumed again when its credentials are about to expire
+type CredentialsCache interface {
+	Credentials(roleArn string) *credentials.Credentials
+	Session(roleArn string) *session.Session
+}
+
+type credentialsCache struct {
+	sess           *session.Session
+	newCredentials func(roleArn string) *credentials.Credentials
+	entries        map[string]*roleCredentials
+	maxRoles       int
+	uses           uint64
+	mutex          sync.Mutex
+}
+
+type roleCredentials struct {
+	credentials *credentials.Credentials
+	// usedAt orders the roles by their last use
+	usedAt uint64
+}
+
+var (
+	sharedCaches = map[*session.Session]*credentialsCache{}
+	sharedMutex  sync.Mutex
+)
+
+func NewCredentialsCache(sess *session.Session) *credentialsCache {
+	return NewCredentialsCacheWithProvider(sess, func(roleArn string) *credentials.Credentials {
+		return stscreds.NewCredentials(sess, roleArn, func(provider *stscreds.AssumeRoleProvider) {
+			provider.ExpiryWindow = DefaultExpiryWindow
+		})
+	})
+}
+
+// NewCredentialsCacheWithProvider calls newCredentials once per role, the returned credentials are expected to
+// refresh themselves when they expire
+func NewCredentialsCacheWithProvider(sess *session.Session, newCredentials func(roleArn string) *credentials.Credentials) *credentialsCache {
+	return &credentialsCache{sess: sess, newCredentials: newCredentials, entries: map[string]*roleCredentials{}, maxRoles: DefaultMaxRoles}
+}
+
+// ForSession returns the cache shared by every client built from sess
+func ForSession(sess *session.Session) *credentialsCache {
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+
+	cache, ok := sharedCaches[sess]
+	if !ok {
+		cache = NewCredentialsCache(sess)
+		sharedCaches[sess] = cache
+	}
+	return cache
+}
+
+// Credentials returns the credentials of the role, or the ones of the session when roleArn is empty
+func (cache *credentialsCache) Credentials(roleArn string) *credentials.Credentials {
+	if roleArn == "" {
+		return cache.sess.Config.Credentials
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.entries[roleArn]
+	if !ok {
+		if len(cache.entries) >= cache.maxRoles {
+			cache.evictLeastRecentlyUsed()
+		}
+		entry = &roleCredentials{credentials: cache.newCredentials(roleArn)}
+		cache.entries[roleArn] = entry
+	}
+	cache.uses++
+	entry.usedAt = cache.uses
+	return entry.credentials
+}
+
+func (cache *credentialsCache) evictLeastRecentlyUsed() {
+	var leastRecentlyUsed string
+	for roleArn, entry := range cache.entries {
+		if leastRecentlyUsed == "" || entry.usedAt < cache.entries[leastRecentlyUsed].usedAt {
+			leastRecentlyUsed = roleArn
+		}
+	}
+	delete(cache.entries, leastRecentlyUsed)
+}
+
+// Session returns a copy of the session signing with the credentials of the role, any aws client can be built from
+// it. The session itself is returned when roleArn is empty
+func (cache *credentialsCache) Session(roleArn string) *session.Session {
+	if roleArn == "" {
+		return cache.sess
+	}
+	return cache.sess.Copy(&aws.Config{Credentials: cache.Credentials(roleArn)})
+}
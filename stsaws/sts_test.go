@@ -0,0 +1,124 @@
+package stsaws
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type assumeRoleMock struct {
+	roleArn   string
+	retrieved int
+	expired   bool
+}
+
+func (mock *assumeRoleMock) Retrieve() (credentials.Value, error) {
+	mock.retrieved++
+	mock.expired = false
+	return credentials.Value{AccessKeyID: fmt.Sprintf("%s-%d", mock.roleArn, mock.retrieved), SecretAccessKey: "secret"}, nil
+}
+
+func (mock *assumeRoleMock) IsExpired() bool {
+	return mock.expired
+}
+
+func newTestCache(t *testing.T) (*credentialsCache, map[string]*assumeRoleMock) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String("eu-west-1"), Credentials: credentials.NewStaticCredentials("base", "secret", "")})
+	assert.Nil(t, err)
+
+	providers := map[string]*assumeRoleMock{}
+	return NewCredentialsCacheWithProvider(sess, func(roleArn string) *credentials.Credentials {
+		providers[roleArn] = &assumeRoleMock{roleArn: roleArn}
+		return credentials.NewCredentials(providers[roleArn])
+	}), providers
+}
+
+func TestCredentials(t *testing.T) {
+	fmt.Println("name: Success when the credentials of a role are shared and only refreshed once expired")
+
+	cache, providers := newTestCache(t)
+
+	first := cache.Credentials("arn:aws:iam::111111111111:role/landing")  //<--- function under test
+	second := cache.Credentials("arn:aws:iam::111111111111:role/landing") //<--- function under test
+	other := cache.Credentials("arn:aws:iam::222222222222:role/manager")  //<--- function under test
+
+	assert.True(t, first == second)
+	assert.False(t, first == other)
+
+	for i := 0; i < 3; i++ {
+		value, err := first.Get()
+		assert.Nil(t, err)
+		assert.Equal(t, "arn:aws:iam::111111111111:role/landing-1", value.AccessKeyID)
+	}
+	assert.Equal(t, 1, providers["arn:aws:iam::111111111111:role/landing"].retrieved)
+
+	providers["arn:aws:iam::111111111111:role/landing"].expired = true
+	value, err := second.Get()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:iam::111111111111:role/landing-2", value.AccessKeyID)
+}
+
+func TestCredentialsForgetsTheLeastRecentlyUsedRole(t *testing.T) {
+	fmt.Println("name: Success when the cache is full and the least recently used role is assumed again")
+
+	cache, providers := newTestCache(t)
+	cache.maxRoles = 2
+	landing := cache.Credentials("arn:aws:iam::111111111111:role/landing")
+	manager := cache.Credentials("arn:aws:iam::222222222222:role/manager")
+	cache.Credentials("arn:aws:iam::111111111111:role/landing")
+
+	cache.Credentials("arn:aws:iam::333333333333:role/landing") //<--- function under test
+
+	assert.Equal(t, 2, len(cache.entries))
+	assert.True(t, landing == cache.Credentials("arn:aws:iam::111111111111:role/landing"))
+	assert.False(t, manager == cache.Credentials("arn:aws:iam::222222222222:role/manager")) //<--- function under test
+	assert.Equal(t, 2, len(cache.entries))
+	assert.Equal(t, 3, len(providers))
+}
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		name                string
+		input               string
+		expectedAccessKeyID string
+	}{
+		{
+			name:                "Success when the session signs with the credentials of the role",
+			input:               "arn:aws:iam::111111111111:role/landing",
+			expectedAccessKeyID: "arn:aws:iam::111111111111:role/landing-1",
+		},
+		{
+			name:                "Success when the session keeps its credentials without a role",
+			input:               "",
+			expectedAccessKeyID: "base",
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+		cache, _ := newTestCache(t)
+
+		sess := cache.Session(test.input) //<--- function under test
+
+		value, err := sess.Config.Credentials.Get()
+		assert.Nil(t, err)
+		assert.Equal(t, test.expectedAccessKeyID, value.AccessKeyID)
+		assert.Equal(t, "eu-west-1", aws.StringValue(sess.Config.Region))
+	}
+}
+
+func TestForSession(t *testing.T) {
+	fmt.Println("name: Success when the clients of a session share a single cache")
+
+	sess, err := session.NewSession(&aws.Config{Region: aws.String("eu-west-1")})
+	assert.Nil(t, err)
+	otherSess, err := session.NewSession(&aws.Config{Region: aws.String("eu-west-1")})
+	assert.Nil(t, err)
+
+	assert.True(t, ForSession(sess) == ForSession(sess))       //<--- function under test
+	assert.False(t, ForSession(sess) == ForSession(otherSess)) //<--- function under test
+}
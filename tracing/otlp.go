@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+type OTLPOptions struct {
+	// Endpoint is the host:port of the collector, the traces are posted to its /v1/traces
+	Endpoint    string
+	Insecure    bool
+	ServiceName string
+}
+
+// SetupOTLP exports the spans to an otlp http collector from now on, sampling the traces that were sampled upstream
+// and every new one. The returned function flushes the pending spans and stops the exporter
+func SetupOTLP(ctx context.Context, options OTLPOptions) (shutdown func(context.Context) error, err error) {
+	clientOptions := []otlptracehttp.Option{otlptracehttp.WithEndpoint(options.Endpoint)}
+	if options.Insecure {
+		clientOptions = append(clientOptions, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := NewProvider(exporter, options.ServiceName)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewProvider batches the spans to exporter, the tests give it a tracetest exporter
+func NewProvider(exporter sdktrace.SpanExporter, serviceName string) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MessageAttributesCarrier reads and writes the trace context in the attributes of an sqs message
+type MessageAttributesCarrier map[string]*sqs.MessageAttributeValue
+
+func (carrier MessageAttributesCarrier) Get(key string) string {
+	if value, ok := carrier[key]; ok && value != nil {
+		return aws.StringValue(value.StringValue)
+	}
+	return ""
+}
+
+func (carrier MessageAttributesCarrier) Set(key, value string) {
+	carrier[key] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+}
+
+func (carrier MessageAttributesCarrier) Keys() []string {
+	keys := make([]string, 0, len(carrier))
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// snsAttributesCarrier reads the attributes of an sns notification delivered without raw message delivery, they are
+// in the body instead of the attributes of the sqs message
+type snsAttributesCarrier map[string]struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+func (carrier snsAttributesCarrier) Get(key string) string {
+	return carrier[key].Value
+}
+
+func (carrier snsAttributesCarrier) Set(string, string) {}
+
+func (carrier snsAttributesCarrier) Keys() []string {
+	keys := make([]string, 0, len(carrier))
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Inject writes the trace context of ctx in attributes, to be sent with an sqs message
+func Inject(ctx context.Context, attributes map[string]*sqs.MessageAttributeValue) {
+	Propagator().Inject(ctx, MessageAttributesCarrier(attributes))
+}
+
+// Extract returns ctx with the trace context of message, so the spans of the event continue the trace started
+// upstream. The attributes of the sqs message are read first, then the ones of the sns notification in its body
+func Extract(ctx context.Context, message *sqs.Message) context.Context {
+	if message == nil {
+		return ctx
+	}
+
+	propagator := Propagator()
+	if len(message.MessageAttributes) > 0 {
+		extracted := propagator.Extract(ctx, MessageAttributesCarrier(message.MessageAttributes))
+		if trace.SpanContextFromContext(extracted).IsValid() {
+			return extracted
+		}
+	}
+
+	var notification struct {
+		MessageAttributes snsAttributesCarrier `json:"MessageAttributes"`
+	}
+	if message.Body == nil || json.Unmarshal([]byte(*message.Body), &notification) != nil || len(notification.MessageAttributes) == 0 {
+		return ctx
+	}
+	return propagator.Extract(ctx, notification.MessageAttributes)
+}
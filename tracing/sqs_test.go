@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func upstreamContext() context.Context {
+	ctx, _ := sdktrace.NewTracerProvider().Tracer("workflow-manager").Start(context.Background(), "start-import")
+	return ctx
+}
+
+func TestExtract(t *testing.T) {
+	upstream := upstreamContext()
+	attributes := map[string]*sqs.MessageAttributeValue{}
+	Inject(upstream, attributes)
+	traceparent := attributes["traceparent"].StringValue
+
+	tests := []struct {
+		name            string
+		message         *sqs.Message
+		expectedTraceID trace.TraceID
+	}{
+		{
+			name:            "Success when the trace context is in the attributes of the sqs message",
+			message:         &sqs.Message{Body: aws.String("{}"), MessageAttributes: attributes},
+			expectedTraceID: trace.SpanContextFromContext(upstream).TraceID(),
+		},
+		{
+			name:            "Success when the trace context is in the attributes of the sns notification",
+			message:         &sqs.Message{Body: aws.String(fmt.Sprintf(`{"Type": "Notification", "Message": "{}", "MessageAttributes": {"traceparent": {"Type": "String", "Value": "%s"}}}`, *traceparent))},
+			expectedTraceID: trace.SpanContextFromContext(upstream).TraceID(),
+		},
+		{
+			name:    "Success when the message has no trace context",
+			message: &sqs.Message{Body: aws.String(`{"Type": "Notification", "Message": "{}"}`)},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Println(test.name)
+
+		ctx := Extract(context.Background(), test.message) //<--- function under test
+
+		assert.Equal(t, test.expectedTraceID, trace.SpanContextFromContext(ctx).TraceID())
+		assert.Equal(t, test.expectedTraceID.IsValid(), trace.SpanContextFromContext(ctx).IsRemote())
+	}
+}
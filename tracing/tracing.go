@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of the spans of the helpers
+const TracerName = "github.com/anhamdan/etl-base"
+
+// Names of the spans of the stages of an event
+const (
+	ReceiveSpan           = "sqs.receive"
+	ParseSpan             = "event.parse"
+	ProcessSpan           = "etl.process_event"
+	LandingZoneReadSpan   = "landing_zone.read"
+	TransformSpan         = "etl.transform"
+	LoadingZoneWriteSpan  = "loading_zone.write"
+	LoadingZoneCommitSpan = "loading_zone.commit"
+	SendTaskSuccessSpan   = "sfn.send_task_success"
+	SendTaskFailureSpan   = "sfn.send_task_failure"
+)
+
+// Keys of the span attributes, the ids of the event match the fields of its log lines
+const (
+	ImportJobID = attribute.Key("etl.import_job_id")
+	ProcessID   = attribute.Key("etl.process_id")
+	ProviderID  = attribute.Key("etl.provider_id")
+	DataSource  = attribute.Key("etl.data_source")
+	File        = attribute.Key("etl.file")
+	Records     = attribute.Key("etl.records")
+	Bytes       = attribute.Key("etl.bytes")
+	MessageID   = attribute.Key("messaging.message_id")
+	Queue       = attribute.Key("messaging.destination")
+)
+
+// Start starts a span of the tracer provider set with otel.SetTracerProvider, which discards them until an exporter
+// is configured
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends span, recording err as its status when it is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Propagator carries the trace context and the baggage in the W3C headers, traceparent, tracestate and baggage
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}